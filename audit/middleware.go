@@ -0,0 +1,185 @@
+package audit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"strings"
+	"github.com/Sigaeasu/go-mwe/config"
+	"github.com/Sigaeasu/go-mwe/models"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/repository"
+	"github.com/Sigaeasu/go-mwe/service"
+	"github.com/Sigaeasu/go-mwe/utils/validation"
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+)
+
+// HeaderRequestID is echoed in every response and stored with the audit
+// entry. A client may send its own; one is generated otherwise.
+const HeaderRequestID = "X-Request-ID"
+
+const maxRequestIDLength = 64
+
+type key int
+
+const entryKey key = iota
+
+// Middleware writes an audit entry for every request that is not a GET, HEAD
+// or OPTIONS, whatever its outcome. It must run after the authentication
+// middleware so the actor is known. The subject wallet is the caller's, or
+// the {customer_xid} of admin routes; handlers without either name it with
+// SetSubject.
+func Middleware(repo repository.MiniWalletRepoInterface) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requestID := readRequestID(r)
+			w.Header().Set(HeaderRequestID, requestID)
+			switch r.Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			entry := &entity.AuditEntry{
+				Action: action(r),
+				RequestID: requestID,
+				ClientIP: clientIP(r),
+			}
+			setActor(r, entry)
+			if entry.CustomerXId != "" {
+				entry.Before = snapshot(repo, entry.CustomerXId)
+			}
+
+			rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), entryKey, entry)))
+
+			entry.StatusCode = rec.status
+			if entry.CustomerXId != "" {
+				entry.After = snapshot(repo, entry.CustomerXId)
+			}
+			if _, err := repo.AppendAudit(*entry); err != nil {
+				logrus.Errorf("Fail to write audit entry of request %s: %v", requestID, err)
+			}
+		})
+	}
+}
+
+// SetSubject names the wallet a request acts on when the middleware could
+// not tell, e.g. the customer of POST /init. No before state is recorded
+// then.
+func SetSubject(ctx context.Context, customerXId string) {
+	if entry, ok := ctx.Value(entryKey).(*entity.AuditEntry); ok && entry.CustomerXId == "" {
+		entry.CustomerXId = customerXId
+	}
+}
+
+func setActor(r *http.Request, entry *entity.AuditEntry) {
+	if admin := service.AdminFromContext(r.Context()); admin != "" {
+		entry.ActorType = entity.ActorAdmin
+		entry.Actor = admin
+		if customerXId := mux.Vars(r)["customer_xid"]; validation.IsUUID(customerXId) {
+			entry.CustomerXId = strings.ToLower(customerXId)
+		}
+		return
+	}
+	if customerXId := service.CustomerFromContext(r.Context()); customerXId != "" {
+		entry.ActorType = entity.ActorCustomer
+		entry.Actor = customerXId
+		entry.CustomerXId = customerXId
+		return
+	}
+	if clientID := service.ClientFromContext(r.Context()); clientID != "" {
+		entry.ActorType = entity.ActorClient
+		entry.Actor = clientID
+		return
+	}
+	entry.ActorType = entity.ActorAnonymous
+}
+
+// action is the method and route template, e.g. "POST /api/v1/wallet/deposits".
+func action(r *http.Request) string {
+	if route := mux.CurrentRoute(r); route != nil {
+		if template, err := route.GetPathTemplate(); err == nil {
+			return r.Method + " " + template
+		}
+	}
+	return r.Method + " " + r.URL.Path
+}
+
+// snapshot returns the wallet as JSON, or nil when there is none.
+func snapshot(repo repository.MiniWalletRepoInterface, customerXId string) json.RawMessage {
+	wallet, err := repo.FetchMiniWalletByID(customerXId)
+	if err != nil {
+		logrus.Errorf("Fail to snapshot wallet of %s for the audit log: %v", customerXId, err)
+		return nil
+	}
+	if wallet.ID == "" {
+		return nil
+	}
+	state := models.WalletState{
+		ID: wallet.ID,
+		Status: wallet.StatusName(),
+		Balances: []models.BalanceState{},
+	}
+	for _, b := range wallet.Balances {
+		state.Balances = append(state.Balances, models.BalanceState{
+			Currency: b.Currency,
+			Balance: b.Balance,
+			Held: b.Held,
+		})
+	}
+	data, _ := json.Marshal(state)
+	return data
+}
+
+func readRequestID(r *http.Request) string {
+	id := r.Header.Get(HeaderRequestID)
+	if id != "" && len(id) <= maxRequestIDLength && isPrintable(id) {
+		return id
+	}
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+func clientIP(r *http.Request) string {
+	if config.Config.AuditCfg.TrustForwardedFor {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func isPrintable(s string) bool {
+	for _, c := range s {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// statusRecorder remembers the status code the handler wrote.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"path/filepath"
+	"time"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
@@ -11,6 +12,9 @@ var Config config
 
 type config struct {
 	Environment string `mapstructure:"environment"`
+	StorageCfg struct {
+		Driver string `mapstructure:"driver"`
+	} `mapstructure:"storage"`
 	PostgresCfg struct {
 		Database    string `mapstructure:"database"`
 		Host        string `mapstructure:"host"`
@@ -21,13 +25,63 @@ type config struct {
 		MinIdleConn int    `mapstructure:"min_idle_conn"`
 		MaxRetries  int    `mapstructure:"max_retries"`
 	} `mapstructure:"postgres"`
+	HoldsCfg struct {
+		TTL            time.Duration `mapstructure:"ttl"`
+		ExpiryInterval time.Duration `mapstructure:"expiry_interval"`
+	} `mapstructure:"holds"`
+	WebhooksCfg struct {
+		MaxAttempts  int           `mapstructure:"max_attempts"`
+		BaseDelay    time.Duration `mapstructure:"base_delay"`
+		MaxDelay     time.Duration `mapstructure:"max_delay"`
+		Timeout      time.Duration `mapstructure:"timeout"`
+		PollInterval time.Duration `mapstructure:"poll_interval"`
+		AllowedNetworks []string  `mapstructure:"allowed_networks"`
+	} `mapstructure:"webhooks"`
+	EventsCfg struct {
+		PollInterval time.Duration `mapstructure:"poll_interval"`
+		Heartbeat    time.Duration `mapstructure:"heartbeat"`
+	} `mapstructure:"events"`
+	WebSocketCfg struct {
+		AllowedOrigins []string `mapstructure:"allowed_origins"`
+	} `mapstructure:"websocket"`
+	LimitsCfg map[string]map[string]LimitRule `mapstructure:"limits"`
+	AuditCfg struct {
+		TrustForwardedFor bool `mapstructure:"trust_forwarded_for"`
+	} `mapstructure:"audit"`
+	AdminCfg struct {
+		Keys map[string]string `mapstructure:"keys"`
+	} `mapstructure:"admin"`
 	JWTCfg struct {
-		Issuer  string `mapstructure:"issuer"`
-		Exp     int    `mapstructure:"exp"`
-		SignKey string `mapstructure:"sign_key"`
+		Issuer          string        `mapstructure:"issuer"`
+		Audience        string        `mapstructure:"audience"`
+		Leeway          time.Duration `mapstructure:"leeway"`
+		AccessTTL       time.Duration `mapstructure:"access_ttl"`
+		RefreshTTL      time.Duration `mapstructure:"refresh_ttl"`
+		PurgeInterval   time.Duration `mapstructure:"purge_interval"`
+		RotationOverlap time.Duration `mapstructure:"rotation_overlap"`
+		Keys            []JWTKey      `mapstructure:"keys"`
 	} `mapstructure:"jwt"`
 }
 
+// JWTKey is a key of the token signing schedule, see service.KeySet. Times
+// are RFC 3339; an empty sign_from or sign_until leaves that end open.
+type JWTKey struct {
+	ID             string `mapstructure:"kid"`
+	Algorithm      string `mapstructure:"algorithm"`
+	PrivateKeyFile string `mapstructure:"private_key_file"`
+	SignFrom       string `mapstructure:"sign_from"`
+	SignUntil      string `mapstructure:"sign_until"`
+}
+
+// LimitRule caps one transaction type in one currency, see limits.Rule.
+type LimitRule struct {
+	Min         string `mapstructure:"min"`
+	Max         string `mapstructure:"max"`
+	Daily       string `mapstructure:"daily"`
+	Monthly     string `mapstructure:"monthly"`
+	HourlyCount int    `mapstructure:"hourly_count"`
+}
+
 func init() {
 	var err error
 
@@ -44,10 +98,17 @@ func init() {
 	}
 }
 
+// GetAppBasePath returns the nearest go-mwe directory above the working
+// directory, or the working directory itself when there is none.
 func GetAppBasePath() string {
-	basePath, _ := filepath.Abs(".")
+	workDir, _ := filepath.Abs(".")
+	basePath := workDir
 	for filepath.Base(basePath) != "go-mwe" {
-		basePath = filepath.Dir(basePath)
+		parent := filepath.Dir(basePath)
+		if parent == basePath {
+			return workDir
+		}
+		basePath = parent
 	}
 
 	return basePath
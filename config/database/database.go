@@ -1,7 +1,9 @@
 package database
 
 import (
+	"context"
 	pg "github.com/go-pg/pg/v10"
+	"github.com/Sigaeasu/go-mwe/config"
 	"github.com/sirupsen/logrus"
 )
 
@@ -30,4 +32,26 @@ func DatabaseConnection(params ParametersConnection) *pg.DB {
 	})
 
 	return db
-}
\ No newline at end of file
+}
+
+// ConnectFromConfig opens the database configured under postgres in the
+// application config and exits when it cannot be reached.
+func ConnectFromConfig() *pg.DB {
+	postgresConfig := config.Config.PostgresCfg
+	db := DatabaseConnection(ParametersConnection{
+		Username: postgresConfig.Username,
+		Password: postgresConfig.Password,
+		Host: postgresConfig.Host,
+		Port: postgresConfig.Port,
+		Database: postgresConfig.Database,
+		MaxConnection: postgresConfig.MaxConn,
+		MinIdleConnection: postgresConfig.MinIdleConn,
+		MaxRetries: postgresConfig.MaxRetries,
+	})
+
+	err := db.Ping(context.Background())
+	if err != nil {
+		logrus.Fatalf("Ping DB error: %v", err)
+	}
+	return db
+}
@@ -0,0 +1,403 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"github.com/Sigaeasu/go-mwe/models"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/models/money"
+	"github.com/Sigaeasu/go-mwe/repository"
+	"github.com/Sigaeasu/go-mwe/service"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
+	"github.com/Sigaeasu/go-mwe/utils/response"
+	"github.com/sirupsen/logrus"
+)
+
+var ErrInvalidOwnedBy = apperror.New(apperror.CodeBadRequest, "owned_by must be the start of a customer_xid")
+
+type adminHandler struct {
+	miniWalletRepo repository.MiniWalletRepoInterface
+}
+
+// AdminHandlerInterface serves /admin/v1. Every call, including reads and
+// failed attempts, is recorded in the admin audit log.
+type AdminHandlerInterface interface {
+	SearchWallets(w http.ResponseWriter, r *http.Request)
+	ViewWalletTransactions(w http.ResponseWriter, r *http.Request)
+	EnableWallet(w http.ResponseWriter, r *http.Request)
+	DisableWallet(w http.ResponseWriter, r *http.Request)
+	FreezeWallet(w http.ResponseWriter, r *http.Request)
+	CloseWallet(w http.ResponseWriter, r *http.Request)
+	ViewWalletTransitions(w http.ResponseWriter, r *http.Request)
+	AdjustBalance(w http.ResponseWriter, r *http.Request)
+	ReverseTransaction(w http.ResponseWriter, r *http.Request)
+	CreateClient(w http.ResponseWriter, r *http.Request)
+	ViewClients(w http.ResponseWriter, r *http.Request)
+	RevokeClient(w http.ResponseWriter, r *http.Request)
+	AssignCustomer(w http.ResponseWriter, r *http.Request)
+	ViewAuditLog(w http.ResponseWriter, r *http.Request)
+	VerifyAuditLog(w http.ResponseWriter, r *http.Request)
+}
+
+func AdminHandler(miniWalletRepo repository.MiniWalletRepoInterface) AdminHandlerInterface {
+	return &adminHandler{
+		miniWalletRepo: miniWalletRepo,
+	}
+}
+
+// SearchWallets lists the wallets whose owned_by starts with ?owned_by=.
+func (h *adminHandler) SearchWallets(w http.ResponseWriter, r *http.Request) {
+	ownedBy := strings.ToLower(r.URL.Query().Get("owned_by"))
+	action := h.action(r, entity.AdminActionSearchWallets, "", "", map[string]string{"owned_by": ownedBy})
+
+	limit, err := readLimit(r)
+	if err == nil && !isOwnedByPrefix(ownedBy) {
+		err = ErrInvalidOwnedBy
+	}
+	var wallets []entity.Wallet
+	if err == nil {
+		wallets, err = h.miniWalletRepo.SearchWallets(ownedBy, limit)
+	}
+	if err = h.record(action, err); err != nil {
+		response.WriteError(w, err)
+		return
+	}
+
+	res := make([]ResponseWallet, 0, len(wallets))
+	for i := range wallets {
+		res = append(res, walletResponse(&wallets[i], wallets[i].StatusName(), money.DefaultCurrency))
+	}
+	response.Write(w, response.ResponseAPI{
+		Status: "success",
+		Data: res,
+	}, http.StatusOK)
+}
+
+// ViewWalletTransactions is the transaction history of any wallet, enabled
+// or not, with the filters of GET /api/v1/wallet/transactions.
+func (h *adminHandler) ViewWalletTransactions(w http.ResponseWriter, r *http.Request) {
+	custXId, err := readPathCustomerXId(r)
+	action := h.action(r, entity.AdminActionViewTransactions, custXId, "", map[string]string{"query": r.URL.RawQuery})
+
+	var filter models.TransactionFilter
+	if err == nil {
+		filter, err = parseTransactionFilter(r, custXId)
+	}
+	if err == nil {
+		err = h.walletExists(custXId)
+	}
+	var transaction []entity.Transaction
+	var nextCursor string
+	if err == nil {
+		transaction, nextCursor, err = h.miniWalletRepo.FetchTransactions(filter)
+	}
+	if err = h.record(action, err); err != nil {
+		response.WriteError(w, err)
+		return
+	}
+
+	transactions := make([]ResponseTransactions, 0, len(transaction))
+	for _, t := range transaction {
+		transactions = append(transactions, transactionResponse(t))
+	}
+	response.Write(w, response.ResponseAPI{
+		Status: "success",
+		Data: ResponseTransactionPage{
+			Transactions: transactions,
+			NextCursor: nextCursor,
+		},
+	}, http.StatusOK)
+}
+
+func (h *adminHandler) EnableWallet(w http.ResponseWriter, r *http.Request) {
+	h.forceStatus(w, r, entity.WalletStatusActive, entity.AdminActionEnableWallet)
+}
+
+func (h *adminHandler) DisableWallet(w http.ResponseWriter, r *http.Request) {
+	h.forceStatus(w, r, entity.WalletStatusDisabled, entity.AdminActionDisableWallet)
+}
+
+// FreezeWallet stops all use of the wallet until an admin enables or
+// disables it again. The owner cannot lift a freeze.
+func (h *adminHandler) FreezeWallet(w http.ResponseWriter, r *http.Request) {
+	h.forceStatus(w, r, entity.WalletStatusFrozen, entity.AdminActionFreezeWallet)
+}
+
+// CloseWallet closes the wallet for good. It must be empty, or sweep=true
+// pays out what is left.
+func (h *adminHandler) CloseWallet(w http.ResponseWriter, r *http.Request) {
+	h.forceStatus(w, r, entity.WalletStatusClosed, entity.AdminActionCloseWallet)
+}
+
+// forceStatus moves the wallet to the state whatever its owner asked for.
+func (h *adminHandler) forceStatus(w http.ResponseWriter, r *http.Request, status string, name string) {
+	custXId, err := readPathCustomerXId(r)
+	var req closeRequest
+	if err == nil {
+		req, err = readCloseRequest(w, r, true)
+	}
+	var details map[string]string
+	if status == entity.WalletStatusClosed {
+		details = map[string]string{"sweep": strconv.FormatBool(req.Sweep)}
+	}
+	action := h.action(r, name, custXId, req.Reason, details)
+	if err != nil {
+		h.record(action, err)
+		response.WriteError(w, err)
+		return
+	}
+
+	wallet, err := h.miniWalletRepo.ForceWalletStatus(models.ParamsTransition{
+		CustomerXId: custXId,
+		To: status,
+		ActorType: entity.ActorAdmin,
+		Actor: action.Actor,
+		Reason: req.Reason,
+		Sweep: req.Sweep && status == entity.WalletStatusClosed,
+	}, action)
+	if err != nil {
+		h.record(action, err)
+		response.WriteError(w, err)
+		return
+	}
+	response.Write(w, response.ResponseAPI{
+		Status: "success",
+		Data: walletResponse(wallet, wallet.StatusName(), money.DefaultCurrency),
+	}, http.StatusOK)
+}
+
+// ViewWalletTransitions is the lifecycle history of the wallet: every
+// status change with who made it and why.
+func (h *adminHandler) ViewWalletTransitions(w http.ResponseWriter, r *http.Request) {
+	custXId, err := readPathCustomerXId(r)
+	action := h.action(r, entity.AdminActionViewTransitions, custXId, "", nil)
+
+	var transitions []entity.WalletTransition
+	if err == nil {
+		transitions, err = h.miniWalletRepo.FetchWalletTransitions(custXId)
+	}
+	if err = h.record(action, err); err != nil {
+		response.WriteError(w, err)
+		return
+	}
+
+	res := make([]ResponseWalletTransition, 0, len(transitions))
+	for _, t := range transitions {
+		res = append(res, ResponseWalletTransition{
+			ID: t.ID,
+			From: t.FromStatus,
+			To: t.ToStatus,
+			ActorType: t.ActorType,
+			Actor: t.Actor,
+			Reason: t.Reason,
+			CreatedAt: t.CreatedAt.String(),
+		})
+	}
+	response.Write(w, response.ResponseAPI{
+		Status: "success",
+		Data: res,
+	}, http.StatusOK)
+}
+
+// AdjustBalance credits or debits any wallet by a signed amount, e.g. to
+// correct a failed payout by hand.
+func (h *adminHandler) AdjustBalance(w http.ResponseWriter, r *http.Request) {
+	custXId, err := readPathCustomerXId(r)
+	var req adjustmentRequest
+	if err == nil {
+		req, err = readAdjustmentRequest(w, r)
+	}
+	action := h.action(r, entity.AdminActionAdjustBalance, custXId, req.Reason, map[string]string{
+		"amount": req.Amount.String(req.Currency),
+		"currency": req.Currency,
+		"reference_id": req.ReferenceID,
+	})
+	if err != nil {
+		h.record(action, err)
+		response.WriteError(w, err)
+		return
+	}
+
+	adjustment, err := h.miniWalletRepo.AdjustBalance(models.ParamsAdjustment{
+		Amount: req.Amount,
+		Currency: req.Currency,
+		ReferenceID: req.ReferenceID,
+		CreatedBy: custXId,
+	}, action)
+	if err != nil {
+		h.record(action, err)
+		response.WriteError(w, err)
+		return
+	}
+	response.Write(w, response.ResponseAPI{
+		Status: "success",
+		Data: transactionResponse(*adjustment),
+	}, http.StatusCreated)
+}
+
+// ReverseTransaction undoes all or part of a deposit or withdrawal of any
+// wallet that is not closed, e.g. a payout the bank returned.
+func (h *adminHandler) ReverseTransaction(w http.ResponseWriter, r *http.Request) {
+	custXId, err := readPathCustomerXId(r)
+	var id string
+	if err == nil {
+		id, err = readPathID(r)
+	}
+	var req reversalRequest
+	if err == nil {
+		req, err = readReversalRequest(w, r, true)
+	}
+	action := h.action(r, entity.AdminActionReverseTransaction, custXId, req.Reason, map[string]string{
+		"transaction_id": id,
+		"amount": req.Amount.String(req.Currency),
+		"reference_id": req.ReferenceID,
+	})
+	if err != nil {
+		h.record(action, err)
+		response.WriteError(w, err)
+		return
+	}
+
+	reversal, err := h.miniWalletRepo.ForceReversal(models.ParamsReversal{
+		TransactionID: id,
+		Amount: req.Amount,
+		Currency: req.Currency,
+		ReferenceID: req.ReferenceID,
+		CreatedBy: custXId,
+	}, action)
+	if err != nil {
+		h.record(action, err)
+		response.WriteError(w, err)
+		return
+	}
+	response.Write(w, response.ResponseAPI{
+		Status: "success",
+		Data: transactionResponse(*reversal),
+	}, http.StatusCreated)
+}
+
+// ViewAuditLog pages through the audit log of mutating requests, oldest
+// first. Pass next_after_id as ?after_id= for the next page.
+func (h *adminHandler) ViewAuditLog(w http.ResponseWriter, r *http.Request) {
+	filter, err := readAuditFilter(r)
+	action := h.action(r, entity.AdminActionViewAudit, filter.CustomerXId, "", map[string]string{"query": r.URL.RawQuery})
+
+	var entries []entity.AuditEntry
+	if err == nil {
+		entries, err = h.miniWalletRepo.FetchAuditEntries(filter)
+	}
+	if err = h.record(action, err); err != nil {
+		response.WriteError(w, err)
+		return
+	}
+
+	page := ResponseAuditPage{Entries: make([]ResponseAuditEntry, 0, len(entries))}
+	for _, e := range entries {
+		page.Entries = append(page.Entries, auditEntryResponse(e))
+	}
+	if len(entries) == filter.Limit {
+		page.NextAfterID = entries[len(entries)-1].ID
+	}
+	response.Write(w, response.ResponseAPI{
+		Status: "success",
+		Data: page,
+	}, http.StatusOK)
+}
+
+// VerifyAuditLog recomputes the whole hash chain and reports the first entry
+// that was changed, removed or inserted.
+func (h *adminHandler) VerifyAuditLog(w http.ResponseWriter, r *http.Request) {
+	action := h.action(r, entity.AdminActionVerifyAudit, "", "", nil)
+	verification, err := h.miniWalletRepo.VerifyAudit()
+	if err = h.record(action, err); err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	response.Write(w, response.ResponseAPI{
+		Status: "success",
+		Data: verification,
+	}, http.StatusOK)
+}
+
+// action starts the audit log entry of the request.
+func (h *adminHandler) action(r *http.Request, name string, custXId string, reason string, details map[string]string) entity.AdminAction {
+	action := entity.AdminAction{
+		Actor: service.AdminFromContext(r.Context()),
+		Action: name,
+		CustomerXId: custXId,
+		Reason: reason,
+		Outcome: entity.AdminOutcomeSuccess,
+	}
+	if details != nil {
+		action.Details, _ = json.Marshal(details)
+	}
+	return action
+}
+
+// record writes the action with the outcome of err and returns err. When the
+// action succeeded but cannot be recorded, the failure to record is returned
+// so nothing is shown that the log does not know about.
+func (h *adminHandler) record(action entity.AdminAction, err error) error {
+	if err != nil {
+		action.Outcome = string(apperror.CodeOf(err))
+	}
+	if recordErr := h.miniWalletRepo.RecordAdminAction(action); recordErr != nil {
+		logrus.Errorf("Fail to record admin action %s by %s: %v", action.Action, action.Actor, recordErr)
+		if err == nil {
+			return recordErr
+		}
+	}
+	return err
+}
+
+func (h *adminHandler) walletExists(custXId string) error {
+	wallet, err := h.miniWalletRepo.FetchMiniWalletByID(custXId)
+	if err != nil {
+		return err
+	}
+	if wallet.ID == "" {
+		return repository.ErrCustomerNotFound
+	}
+	return nil
+}
+
+// isOwnedByPrefix only accepts UUID characters, so the prefix cannot carry
+// LIKE wildcards.
+func isOwnedByPrefix(s string) bool {
+	if s == "" || len(s) > 36 {
+		return false
+	}
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+func auditEntryResponse(e entity.AuditEntry) ResponseAuditEntry {
+	return ResponseAuditEntry{
+		ID: e.ID,
+		ActorType: e.ActorType,
+		Actor: e.Actor,
+		Action: e.Action,
+		CustomerXId: e.CustomerXId,
+		Before: orJSONNull(e.Before),
+		After: orJSONNull(e.After),
+		StatusCode: e.StatusCode,
+		RequestID: e.RequestID,
+		ClientIP: e.ClientIP,
+		CreatedAt: e.CreatedAt.String(),
+		PrevHash: e.PrevHash,
+		Hash: e.Hash,
+	}
+}
+
+func orJSONNull(data json.RawMessage) json.RawMessage {
+	if len(data) == 0 {
+		return json.RawMessage("null")
+	}
+	return data
+}
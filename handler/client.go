@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/service"
+	"github.com/Sigaeasu/go-mwe/utils/response"
+)
+
+// CreateClient registers a partner's API client for /init. The secret is
+// only shown in this response.
+func (h *adminHandler) CreateClient(w http.ResponseWriter, r *http.Request) {
+	req, err := readClientRequest(w, r)
+	var secret string
+	var client entity.APIClient
+	if err == nil {
+		secret, client, err = service.NewAPIClient(req.Name, time.Now())
+	}
+	action := h.action(r, entity.AdminActionCreateClient, "", req.Reason, map[string]string{
+		"client_id": client.ID,
+		"name": req.Name,
+	})
+	if err != nil {
+		h.record(action, err)
+		response.WriteError(w, err)
+		return
+	}
+
+	created, err := h.miniWalletRepo.CreateAPIClient(client, action)
+	if err != nil {
+		h.record(action, err)
+		response.WriteError(w, err)
+		return
+	}
+	res := clientResponse(*created)
+	res.Secret = secret
+	response.Write(w, response.ResponseAPI{
+		Status: "success",
+		Data: res,
+	}, http.StatusCreated)
+}
+
+func (h *adminHandler) ViewClients(w http.ResponseWriter, r *http.Request) {
+	action := h.action(r, entity.AdminActionViewClients, "", "", nil)
+	clients, err := h.miniWalletRepo.FetchAPIClients()
+	if err = h.record(action, err); err != nil {
+		response.WriteError(w, err)
+		return
+	}
+
+	res := make([]ResponseAPIClient, 0, len(clients))
+	for _, c := range clients {
+		res = append(res, clientResponse(c))
+	}
+	response.Write(w, response.ResponseAPI{
+		Status: "success",
+		Data: res,
+	}, http.StatusOK)
+}
+
+// RevokeClient stops the client from opening new sessions. Sessions it
+// opened last until they expire or log out.
+func (h *adminHandler) RevokeClient(w http.ResponseWriter, r *http.Request) {
+	clientID, err := readPathClientID(r)
+	var reason string
+	if err == nil {
+		reason, err = readReason(w, r)
+	}
+	action := h.action(r, entity.AdminActionRevokeClient, "", reason, map[string]string{"client_id": clientID})
+	if err != nil {
+		h.record(action, err)
+		response.WriteError(w, err)
+		return
+	}
+
+	client, err := h.miniWalletRepo.RevokeAPIClient(clientID, time.Now(), action)
+	if err != nil {
+		h.record(action, err)
+		response.WriteError(w, err)
+		return
+	}
+	response.Write(w, response.ResponseAPI{
+		Status: "success",
+		Data: clientResponse(*client),
+	}, http.StatusOK)
+}
+
+// AssignCustomer moves a customer into the scope of the client, e.g. one
+// whose wallet was opened before clients existed, or who changed partner.
+func (h *adminHandler) AssignCustomer(w http.ResponseWriter, r *http.Request) {
+	clientID, err := readPathClientID(r)
+	var req assignRequest
+	if err == nil {
+		req, err = readAssignRequest(w, r)
+	}
+	action := h.action(r, entity.AdminActionAssignCustomer, req.CustomerXId, req.Reason, map[string]string{"client_id": clientID})
+	if err != nil {
+		h.record(action, err)
+		response.WriteError(w, err)
+		return
+	}
+
+	err = h.miniWalletRepo.AssignCustomer(clientID, req.CustomerXId, action)
+	if err != nil {
+		h.record(action, err)
+		response.WriteError(w, err)
+		return
+	}
+	response.Write(w, response.ResponseAPI{
+		Status: "success",
+		Data: EmptyResponse{},
+	}, http.StatusOK)
+}
+
+func clientResponse(c entity.APIClient) ResponseAPIClient {
+	res := ResponseAPIClient{
+		ClientID: c.ID,
+		Name: c.Name,
+		CreatedAt: c.CreatedAt.String(),
+	}
+	if !c.RevokedAt.IsZero() {
+		res.RevokedAt = c.RevokedAt.String()
+	}
+	return res
+}
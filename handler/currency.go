@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"github.com/Sigaeasu/go-mwe/models/entity"
+)
+
+// walletResponse shows the balance in the requested currency together with
+// every balance the wallet holds.
+func walletResponse(wallet *entity.Wallet, status string, currency string) ResponseWallet {
+	balances := make([]ResponseBalance, 0, len(wallet.Balances))
+	for _, b := range wallet.Balances {
+		balances = append(balances, ResponseBalance{
+			Currency: b.Currency,
+			Balance: b.Balance.Number(b.Currency),
+			Available: b.Available().Number(b.Currency),
+		})
+	}
+	return ResponseWallet{
+		ID: wallet.ID,
+		OwnedBy: wallet.OwnedBy,
+		Status: status,
+		EnabledAt: wallet.EnabledAt.String(),
+		Currency: currency,
+		Balance: wallet.Balance(currency).Number(currency),
+		Available: wallet.Available(currency).Number(currency),
+		Balances: balances,
+	}
+}
@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"github.com/Sigaeasu/go-mwe/config"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/service"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
+	"github.com/Sigaeasu/go-mwe/utils/response"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultEventPollInterval = time.Second
+	DefaultEventHeartbeat = 15 * time.Second
+	EventBatchSize = 100
+)
+
+var ErrInvalidLastEventID = apperror.New(apperror.CodeInvalidCursor, "Last-Event-ID must be the id of a previous event")
+
+// StreamEvents streams the customer's wallet events as Server-Sent Events.
+// Without Last-Event-ID (header, or ?last_event_id= for clients that cannot
+// set it) only events from now on are sent; with it every later event is
+// replayed first. The stream ends with an error event once the access token
+// it was opened with expires or is revoked.
+func (h *miniWalletHandler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	claims, ok := service.ClaimsFromContext(r.Context())
+	if !ok {
+		response.WriteError(w, service.ErrInvalidToken)
+		return
+	}
+	custXId := claims.CustomerXId
+
+	lastID, resume, err := readLastEventID(r)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	if _, err := h.existingWallet(custXId); err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	if !resume {
+		if lastID, err = h.miniWalletRepo.LatestEventID(custXId); err != nil {
+			response.WriteError(w, err)
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	// The stream outlives the server's write timeout.
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", eventPollInterval().Milliseconds())
+	if err := rc.Flush(); err != nil {
+		logrus.Errorf("Fail to start event stream: %v", err)
+		return
+	}
+
+	poll := time.NewTicker(eventPollInterval())
+	defer poll.Stop()
+	heartbeat := time.NewTicker(eventHeartbeat())
+	defer heartbeat.Stop()
+	expiry := time.NewTimer(time.Until(claims.ExpiresAt.Time))
+	defer expiry.Stop()
+	for {
+		events, err := h.miniWalletRepo.FetchEvents(custXId, lastID, EventBatchSize)
+		if err != nil {
+			logrus.Errorf("Fail to fetch events of %s: %v", custXId, err)
+			return
+		}
+		for _, event := range events {
+			if err := writeEvent(w, event); err != nil {
+				return
+			}
+			lastID = event.ID
+		}
+		if len(events) > 0 {
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+		if len(events) == EventBatchSize {
+			continue
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-poll.C:
+		case <-expiry.C:
+			endStream(w, rc, service.ErrTokenExpired)
+			return
+		case <-heartbeat.C:
+			revoked, err := h.miniWalletRepo.IsTokenRevoked(claims.ID)
+			if err != nil {
+				logrus.Errorf("Fail to check token of %s: %v", custXId, err)
+				return
+			}
+			if revoked {
+				endStream(w, rc, service.ErrTokenRevoked)
+				return
+			}
+			// Comments keep proxies from closing an idle stream.
+			fmt.Fprint(w, ": heartbeat\n\n")
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event entity.WalletEvent) error {
+	data, err := json.Marshal(eventResponse(event))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
+
+// endStream sends err as an error event in the body of a failed response.
+// Reconnecting with the same token then fails, which stops EventSource.
+func endStream(w http.ResponseWriter, rc *http.ResponseController, err error) {
+	body, _ := response.FromError(err)
+	data, err := json.Marshal(body)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "event: error\ndata: %s\n\n", data)
+	rc.Flush()
+}
+
+// readLastEventID reports the event the client saw last and whether it sent
+// one at all.
+func readLastEventID(r *http.Request) (int64, bool, error) {
+	raw := r.Header.Get("Last-Event-ID")
+	if raw == "" {
+		raw = r.URL.Query().Get("last_event_id")
+	}
+	if raw == "" {
+		return 0, false, nil
+	}
+	id, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || id < 0 {
+		return 0, false, ErrInvalidLastEventID
+	}
+	return id, true, nil
+}
+
+func eventPollInterval() time.Duration {
+	if interval := config.Config.EventsCfg.PollInterval; interval > 0 {
+		return interval
+	}
+	return DefaultEventPollInterval
+}
+
+func eventHeartbeat() time.Duration {
+	if heartbeat := config.Config.EventsCfg.Heartbeat; heartbeat > 0 {
+		return heartbeat
+	}
+	return DefaultEventHeartbeat
+}
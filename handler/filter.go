@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/Sigaeasu/go-mwe/models"
+	"github.com/Sigaeasu/go-mwe/models/money"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
+)
+
+const (
+	MaxLimit = 100
+)
+
+// parseTransactionFilter reads the history query string:
+// ?cursor=&limit=&type=&status=&currency=&from=&to=&min_amount=&max_amount=
+// Dates are RFC 3339 timestamps or plain YYYY-MM-DD days; "to" is exclusive
+// for timestamps and inclusive for days.
+func parseTransactionFilter(r *http.Request, createdBy string) (models.TransactionFilter, error) {
+	query := r.URL.Query()
+	filter := models.TransactionFilter{
+		CreatedBy: createdBy,
+		Type: query.Get("type"),
+		Status: query.Get("status"),
+		Currency: strings.ToUpper(query.Get("currency")),
+	}
+
+	if raw := query.Get("cursor"); raw != "" {
+		cursor, err := models.DecodeTransactionCursor(raw)
+		if err != nil {
+			return filter, err
+		}
+		filter.After = cursor
+	}
+	var err error
+	if filter.Limit, err = readLimit(r); err != nil {
+		return filter, err
+	}
+	if filter.From, err = parseFilterTime(query.Get("from"), false); err != nil {
+		return filter, apperror.New(apperror.CodeBadRequest, "Invalid from date")
+	}
+	if filter.To, err = parseFilterTime(query.Get("to"), true); err != nil {
+		return filter, apperror.New(apperror.CodeBadRequest, "Invalid to date")
+	}
+	if filter.Currency != "" {
+		if _, err = money.Exponent(filter.Currency); err != nil {
+			return filter, err
+		}
+	}
+	if query.Get("min_amount") != "" || query.Get("max_amount") != "" {
+		// Amounts are only comparable within one currency.
+		if filter.Currency == "" {
+			filter.Currency = money.DefaultCurrency
+		}
+		if filter.MinAmount, err = parseFilterAmount(query.Get("min_amount"), filter.Currency); err != nil {
+			return filter, err
+		}
+		if filter.MaxAmount, err = parseFilterAmount(query.Get("max_amount"), filter.Currency); err != nil {
+			return filter, err
+		}
+	}
+	return filter, nil
+}
+
+// readLimit returns the ?limit= page size, Limit when it is absent.
+func readLimit(r *http.Request) (int, error) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return Limit, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 1 || limit > MaxLimit {
+		return 0, apperror.New(apperror.CodeBadRequest, "limit must be between 1 and " + strconv.Itoa(MaxLimit))
+	}
+	return limit, nil
+}
+
+func parseFilterTime(raw string, endOfDay bool) (time.Time, error) {
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if day, err := time.ParseInLocation("2006-01-02", raw, time.Local); err == nil {
+		if endOfDay {
+			day = day.AddDate(0, 0, 1)
+		}
+		return day, nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+func parseFilterAmount(raw string, currency string) (*money.Amount, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	amount, err := money.Parse(raw, currency)
+	if err != nil {
+		return nil, err
+	}
+	return &amount, nil
+}
@@ -1,14 +1,17 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
-	"strconv"
-	"encoding/json"
+	"time"
+	"github.com/Sigaeasu/go-mwe/audit"
 	"github.com/Sigaeasu/go-mwe/models"
-	"github.com/Sigaeasu/go-mwe/service"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/models/money"
+	"github.com/Sigaeasu/go-mwe/realtime"
 	"github.com/Sigaeasu/go-mwe/repository"
+	"github.com/Sigaeasu/go-mwe/service"
 	"github.com/Sigaeasu/go-mwe/utils/response"
-	"github.com/golang-jwt/jwt/v4"
 )
 
 const (
@@ -17,6 +20,7 @@ const (
 
 type miniWalletHandler struct {
 	miniWalletRepo repository.MiniWalletRepoInterface
+	hub *realtime.Hub
 }
 
 type MiniWalletHandlerInterface interface {
@@ -25,373 +29,399 @@ type MiniWalletHandlerInterface interface {
 	ViewTransactions(w http.ResponseWriter, r *http.Request)
 	EnableMiniWallet(w http.ResponseWriter, r *http.Request)
 	DisableMiniWallet(w http.ResponseWriter, r *http.Request)
+	CloseMiniWallet(w http.ResponseWriter, r *http.Request)
 	DepositToMiniWallet(w http.ResponseWriter, r *http.Request)
 	WithdrawFromMiniWallet(w http.ResponseWriter, r *http.Request)
+	CaptureWithdrawal(w http.ResponseWriter, r *http.Request)
+	VoidWithdrawal(w http.ResponseWriter, r *http.Request)
+	TransferFromMiniWallet(w http.ResponseWriter, r *http.Request)
+	ReverseTransaction(w http.ResponseWriter, r *http.Request)
+	CreateWebhook(w http.ResponseWriter, r *http.Request)
+	ViewWebhooks(w http.ResponseWriter, r *http.Request)
+	DeleteWebhook(w http.ResponseWriter, r *http.Request)
+	ViewWebhookDeliveries(w http.ResponseWriter, r *http.Request)
+	StreamEvents(w http.ResponseWriter, r *http.Request)
+	WalletSocket(w http.ResponseWriter, r *http.Request)
+	RefreshToken(w http.ResponseWriter, r *http.Request)
+	Logout(w http.ResponseWriter, r *http.Request)
 }
 
-func MiniWalletHandler(miniWalletRepo repository.MiniWalletRepoInterface) MiniWalletHandlerInterface {
+// MiniWalletHandler serves /api/v1. Wallet sockets are woken by hub, which
+// must be running.
+func MiniWalletHandler(miniWalletRepo repository.MiniWalletRepoInterface, hub *realtime.Hub) MiniWalletHandlerInterface {
 	return &miniWalletHandler{
 		miniWalletRepo: miniWalletRepo,
+		hub: hub,
 	}
 }
 
+// AuthMiniWallet opens a session for a customer in the scope of the calling
+// API client, creating the wallet on first use.
 func (h *miniWalletHandler) AuthMiniWallet(w http.ResponseWriter, r *http.Request) {
-	customerXId := r.FormValue("customer_xid")
-	if customerXId == "" {
-		apiResponse(w, response.ResponseAPI{
-			Status: "fail",
-			Data: &response.ApiError{
-				Error: "Missing data for required field.",
-			},
-		}, http.StatusBadRequest)
+	customerXId, err := readCustomerXId(w, r)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	audit.SetSubject(r.Context(), customerXId)
+	clientID := service.ClientFromContext(r.Context())
+	err = h.miniWalletRepo.ClaimCustomer(clientID, customerXId)
+	if err != nil {
+		response.WriteError(w, err)
 		return
 	}
-	token, err := service.GenerateToken(customerXId)
+	wallet, err := h.miniWalletRepo.CreateMiniWallet(customerXId)
 	if err != nil {
-		apiResponse(w, response.ResponseAPI{
-			Status: "fail",
-			Data: &response.ApiError{
-				Error: err.Error(),
-			},
-		}, http.StatusBadRequest)
+		response.WriteError(w, err)
 		return
 	}
-	apiResponse(w, response.ResponseAPI{
+	tokens, err := h.startSession(customerXId, clientID)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	tokens.WalletID = wallet.ID
+	response.Write(w, response.ResponseAPI{
 		Status: "success",
-		Data: map[string]string{
-			"token": token,
-		},
+		Data: tokens,
 	}, http.StatusOK)
 }
 
 func (h *miniWalletHandler) ViewMiniWalletBalance(w http.ResponseWriter, r *http.Request) {
-	cus := r.Context().Value(service.Customer).(jwt.MapClaims)
-	custXId := cus["customer_xid"].(string)
-
-	wallet, err := h.miniWalletRepo.FetchMiniWalletByID(custXId)
+	custXId, err := readCustomer(r)
 	if err != nil {
-		apiResponse(w, response.ResponseAPI{
-			Status: "fail",
-			Data: &response.ApiError{
-				Error: err.Error(),
-			},
-		}, http.StatusInternalServerError)
+		response.WriteError(w, err)
 		return
 	}
-	if wallet.ID == "" {
-		customerUnregistered(w)
+
+	currency, err := readCurrency(w, r)
+	if err != nil {
+		response.WriteError(w, err)
 		return
 	}
-	if !wallet.IsEnabled {
-		walletIsDisabled(w)
+
+	wallet, err := h.enabledWallet(custXId)
+	if err != nil {
+		response.WriteError(w, err)
 		return
 	}
-	apiResponse(w, response.ResponseAPI{
+	response.Write(w, response.ResponseAPI{
 		Status: "success",
-		Data: ResponseWallet{
-			ID:        wallet.ID,
-			OwnedBy:   wallet.OwnedBy,
-			Status:    "enabled",
-			EnabledAt: wallet.EnabledAt.String(),
-			Balance:   wallet.Balance,
-		},
+		Data: walletResponse(wallet, "enabled", currency),
 	}, http.StatusOK)
 }
 
 func (h *miniWalletHandler) ViewTransactions(w http.ResponseWriter, r *http.Request) {
-	cus := r.Context().Value(service.Customer).(jwt.MapClaims)
-	custXId := cus["customer_xid"].(string)
-
-	wallet, err := h.miniWalletRepo.FetchMiniWalletByID(custXId)
+	custXId, err := readCustomer(r)
 	if err != nil {
-		apiResponse(w, response.ResponseAPI{
-			Status: "fail",
-			Data: &response.ApiError{
-				Error: err.Error(),
-			},
-		}, http.StatusInternalServerError)
+		response.WriteError(w, err)
 		return
 	}
-	if wallet.ID == "" {
-		customerUnregistered(w)
+
+	wallet, err := h.enabledWallet(custXId)
+	if err != nil {
+		response.WriteError(w, err)
 		return
 	}
-	if !wallet.IsEnabled {
-		walletIsDisabled(w)
+
+	filter, err := parseTransactionFilter(r, wallet.OwnedBy)
+	if err != nil {
+		response.WriteError(w, err)
 		return
 	}
 
-	transaction, err := h.miniWalletRepo.FetchTransactionByID(wallet.OwnedBy)
+	transaction, nextCursor, err := h.miniWalletRepo.FetchTransactions(filter)
 	if err != nil {
-		apiResponse(w, response.ResponseAPI{
-			Status: "fail",
-			Data: &response.ApiError{
-				Error: err.Error(),
-			},
-		}, http.StatusInternalServerError)
+		response.WriteError(w, err)
 		return
 	}
 
-	apiResponse(w, response.ResponseAPI{
+	transactions := make([]ResponseTransactions, 0, len(transaction))
+	for _, t := range transaction {
+		transactions = append(transactions, transactionResponse(t))
+	}
+
+	response.Write(w, response.ResponseAPI{
 		Status: "success",
-		Data: transaction,
+		Data: ResponseTransactionPage{
+			Transactions: transactions,
+			NextCursor: nextCursor,
+		},
 	}, http.StatusOK)
 }
 
 func (h *miniWalletHandler) EnableMiniWallet(w http.ResponseWriter, r *http.Request) {
-	cus := r.Context().Value(service.Customer).(jwt.MapClaims)
-	custXId := cus["customer_xid"].(string)
+	custXId, err := readCustomer(r)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
 
 	res, err := h.miniWalletRepo.ChangeStatusOnMiniWallet(custXId, true)
 	if err != nil {
-		apiResponse(w, response.ResponseAPI{
-			Status: "fail",
-			Data: &response.ApiError{
-				Error: err.Error(),
-			},
-		}, http.StatusInternalServerError)
+		response.WriteError(w, err)
 		return
 	}
 
-	status := "enabled"
-	if !res.IsEnabled {
-		status = "disabled"
-	}
-	apiResponse(w, response.ResponseAPI{
+	response.Write(w, response.ResponseAPI{
 		Status: "success",
-		Data: ResponseWallet{
-			ID: res.ID,
-			OwnedBy: res.OwnedBy,
-			Status: status,
-			EnabledAt: res.EnabledAt.String(),
-			Balance: res.Balance,
-		},
+		Data: walletResponse(res, res.StatusName(), money.DefaultCurrency),
 	}, http.StatusOK)
 }
 
 func (h *miniWalletHandler) DisableMiniWallet(w http.ResponseWriter, r *http.Request) {
-	cus := r.Context().Value(service.Customer).(jwt.MapClaims)
-	custXId := cus["customer_xid"].(string)
+	custXId, err := readCustomer(r)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
 
 	res, err := h.miniWalletRepo.ChangeStatusOnMiniWallet(custXId, false)
 	if err != nil {
-		apiResponse(w, response.ResponseAPI{
-			Status: "fail",
-			Data: &response.ApiError{
-				Error: err.Error(),
-			},
-		}, http.StatusInternalServerError)
+		response.WriteError(w, err)
 		return
 	}
 
-	status := "enabled"
-	if !res.IsEnabled {
-		status = "disabled"
-	}
-	apiResponse(w, response.ResponseAPI{
+	response.Write(w, response.ResponseAPI{
 		Status: "success",
-		Data: ResponseWallet{
-			ID: res.ID,
-			OwnedBy: res.OwnedBy,
-			Status: status,
-			EnabledAt: res.EnabledAt.String(),
-			Balance: res.Balance,
-		},
+		Data: walletResponse(res, res.StatusName(), money.DefaultCurrency),
 	}, http.StatusOK)
 }
 
-func (h *miniWalletHandler) DepositToMiniWallet(w http.ResponseWriter, r *http.Request) {
-	cus := r.Context().Value(service.Customer).(jwt.MapClaims)
-	custXId := cus["customer_xid"].(string)
+// CloseMiniWallet closes the customer's wallet for good. The wallet must be
+// empty unless sweep=true, which pays out every remaining balance first.
+func (h *miniWalletHandler) CloseMiniWallet(w http.ResponseWriter, r *http.Request) {
+	custXId, err := readCustomer(r)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+
+	req, err := readCloseRequest(w, r, false)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+
+	res, err := h.miniWalletRepo.TransitionWallet(models.ParamsTransition{
+		CustomerXId: custXId,
+		To: entity.WalletStatusClosed,
+		ActorType: entity.ActorCustomer,
+		Actor: custXId,
+		Reason: req.Reason,
+		Sweep: req.Sweep,
+	})
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
 
-	rawAmount := r.FormValue("amount")
-	amount, err := strconv.ParseFloat(rawAmount, 64)
-	referenceId := r.FormValue("reference_id")
+	response.Write(w, response.ResponseAPI{
+		Status: "success",
+		Data: walletResponse(res, res.StatusName(), money.DefaultCurrency),
+	}, http.StatusOK)
+}
 
-	reference, err := h.miniWalletRepo.CheckReferenceID(referenceId)
+func (h *miniWalletHandler) DepositToMiniWallet(w http.ResponseWriter, r *http.Request) {
+	custXId, err := readCustomer(r)
 	if err != nil {
-		apiResponse(w, response.ResponseAPI{
-			Status: "fail",
-			Data: &response.ApiError{
-				Error: "Duplicate Reference ID",
-			},
-		}, http.StatusInternalServerError)
-		if reference != nil {
-			return
-		}
+		response.WriteError(w, err)
 		return
 	}
 
-	wallet, err := h.miniWalletRepo.FetchMiniWalletByID(custXId)
+	req, err := readWalletRequest(w, r)
 	if err != nil {
-		apiResponse(w, response.ResponseAPI{
-			Status: "fail",
-			Data: &response.ApiError{
-				Error: err.Error(),
-			},
-		}, http.StatusInternalServerError)
+		response.WriteError(w, err)
 		return
 	}
-	if wallet.ID == "" {
-		customerUnregistered(w)
+	amount, currency, referenceId := req.Amount, req.Currency, req.ReferenceID
+
+	if h.replayResponse(w, referenceId, custXId, "deposit") {
 		return
 	}
-	if !wallet.IsEnabled {
-		walletIsDisabled(w)
+
+	wallet, err := h.enabledWallet(custXId)
+	if err != nil {
+		response.WriteError(w, err)
 		return
 	}
 	
+	idempotent := &idempotentRequest{referenceId: referenceId, custXId: custXId, requestType: "deposit"}
 	params := models.ParamsWallet{
 		Amount: amount,
-		Balance: wallet.Balance,
+		Currency: currency,
 		ReferenceID: referenceId,
 		CreatedBy: wallet.OwnedBy,
+		Respond: func(deposit entity.Transaction) (*entity.IdempotentResponse, error) {
+			return idempotent.respond(response.ResponseAPI{
+				Status: "success",
+				Data: ResponseDepositWallet{
+					ID: deposit.ID,
+					DepositedBy: custXId,
+					Status: "success",
+					DepositAt: deposit.CreatedAt.String(),
+					Amount: amount.Number(currency),
+					Currency: currency,
+					ReferenceId: referenceId,
+				},
+			})
+		},
+	}
+	_, err = h.miniWalletRepo.Deposit(params)
+	if errors.Is(err, repository.ErrDuplicateReference) {
+		h.referenceInProgress(w, referenceId, custXId, "deposit")
+		return
 	}
-	deposit, err := h.miniWalletRepo.Deposit(params)
 	if err != nil {
 		h.miniWalletRepo.FailedTransaction(params, "deposit")
-		apiResponse(w, response.ResponseAPI{
-			Status: "fail",
-			Data: &response.ApiError{
-				Error: err.Error(),
-			},
-		}, http.StatusInternalServerError)
+		h.idempotentError(w, referenceId, custXId, "deposit", err)
 		return
 	}
-	
-	transaction, err := h.miniWalletRepo.NewTransaction(params, "deposit")
+	idempotent.write(w)
+}
+
+func (h *miniWalletHandler) WithdrawFromMiniWallet(w http.ResponseWriter, r *http.Request) {
+	custXId, err := readCustomer(r)
 	if err != nil {
-		apiResponse(w, response.ResponseAPI{
-			Status: "fail",
-			Data: &response.ApiError{
-				Error: err.Error(),
-			},
-		}, http.StatusInternalServerError)
+		response.WriteError(w, err)
 		return
 	}
 
-	apiResponse(w, response.ResponseAPI{
-		Status: "success",
-		Data: ResponseDepositWallet{
-			ID: deposit.ID,
-			DepositedBy: custXId,
-			Status: "success",
-			DepositAt: transaction.CreatedAt.String(),
-			Amount: amount,
-			ReferenceId: referenceId,
-		},
-	}, http.StatusOK)
-}
+	req, err := readWithdrawRequest(w, r)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	amount, currency, referenceId := req.Amount, req.Currency, req.ReferenceID
 
-func (h *miniWalletHandler) WithdrawFromMiniWallet(w http.ResponseWriter, r *http.Request) {
-	cus := r.Context().Value(service.Customer).(jwt.MapClaims)
-	custXId := cus["customer_xid"].(string)
+	if h.replayResponse(w, referenceId, custXId, "withdraw") {
+		return
+	}
 
-	rawAmount := r.FormValue("amount")
-	amount, err := strconv.ParseFloat(rawAmount, 64)
-	referenceId := r.FormValue("reference_id")
+	wallet, err := h.enabledWallet(custXId)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
 
-	wallet, err := h.miniWalletRepo.FetchMiniWalletByID(custXId)
+	idempotent := &idempotentRequest{referenceId: referenceId, custXId: custXId, requestType: "withdraw"}
+	params := models.ParamsWallet{
+		Amount: amount,
+		Currency: currency,
+		ReferenceID: referenceId,
+		CreatedBy: wallet.OwnedBy,
+		Respond: func(withdraw entity.Transaction) (*entity.IdempotentResponse, error) {
+			return idempotent.respond(response.ResponseAPI{
+				Status: "success",
+				Data: withdrawalResponse(&withdraw),
+			})
+		},
+	}
+	if req.Capture {
+		_, err = h.miniWalletRepo.Withdraw(params)
+	} else {
+		_, err = h.miniWalletRepo.HoldWithdrawal(params, time.Now().Add(holdTTL()))
+	}
+	if errors.Is(err, repository.ErrDuplicateReference) {
+		h.referenceInProgress(w, referenceId, custXId, "withdraw")
+		return
+	}
 	if err != nil {
-		apiResponse(w, response.ResponseAPI{
-			Status: "fail",
-			Data: &response.ApiError{
-				Error: err.Error(),
-			},
-		}, http.StatusInternalServerError)
+		h.miniWalletRepo.FailedTransaction(params, "withdraw")
+		h.idempotentError(w, referenceId, custXId, "withdraw", err)
 		return
 	}
-	if wallet.ID == "" {
-		customerUnregistered(w)
+	idempotent.write(w)
+}
+
+func (h *miniWalletHandler) TransferFromMiniWallet(w http.ResponseWriter, r *http.Request) {
+	custXId, err := readCustomer(r)
+	if err != nil {
+		response.WriteError(w, err)
 		return
 	}
-	if !wallet.IsEnabled {
-		walletIsDisabled(w)
+
+	req, err := readTransferRequest(w, r)
+	if err != nil {
+		response.WriteError(w, err)
 		return
 	}
+	amount, currency, referenceId := req.Amount, req.Currency, req.ReferenceID
 
-	if wallet.Balance < amount {
-		apiResponse(w, response.ResponseAPI{
-			Status: "fail",
-			Data: &response.ApiError{
-				Error: "Balance is insufficient",
-			},
-		}, http.StatusInternalServerError)
+	if h.replayResponse(w, referenceId, custXId, "transfer") {
 		return
 	}
 
-	if !wallet.IsEnabled {
-		apiResponse(w, response.ResponseAPI{
-			Status: "fail",
-			Data: &response.ApiError{
-				Error: "Wallet disabled",
-			},
-		}, http.StatusInternalServerError)
+	wallet, err := h.enabledWallet(custXId)
+	if err != nil {
+		response.WriteError(w, err)
 		return
 	}
-	
-	params := models.ParamsWallet{
+
+	idempotent := &idempotentRequest{referenceId: referenceId, custXId: custXId, requestType: "transfer"}
+	params := models.ParamsTransfer{
 		Amount: amount,
-		Balance: wallet.Balance,
+		Currency: currency,
 		ReferenceID: referenceId,
 		CreatedBy: wallet.OwnedBy,
+		ToCustomerXId: req.ToCustomerXId,
+		ToWalletID: req.ToWalletID,
+		Respond: func(transfer models.TransferResult) (*entity.IdempotentResponse, error) {
+			return idempotent.respond(response.ResponseAPI{
+				Status: "success",
+				Data: ResponseTransferWallet{
+					ID: transfer.TransferID,
+					TransferredBy: custXId,
+					TransferredTo: transfer.Credit.CreatedBy,
+					Status: "success",
+					TransferredAt: transfer.Debit.CreatedAt.String(),
+					Amount: amount.Number(currency),
+					Currency: currency,
+					ReferenceId: referenceId,
+				},
+			})
+		},
 	}
-	withdraw, err := h.miniWalletRepo.Withdraw(params)
-	if err != nil {
-		h.miniWalletRepo.FailedTransaction(params, "withdrawn")
-		apiResponse(w, response.ResponseAPI{
-			Status: "fail",
-			Data: &response.ApiError{
-				Error: err.Error(),
-			},
-		}, http.StatusInternalServerError)
+	_, err = h.miniWalletRepo.Transfer(params)
+	if errors.Is(err, repository.ErrDuplicateReference) {
+		h.referenceInProgress(w, referenceId, custXId, "transfer")
 		return
 	}
-	
-	transaction, err := h.miniWalletRepo.NewTransaction(params, "withdraw")
 	if err != nil {
-		apiResponse(w, response.ResponseAPI{
-			Status: "fail",
-			Data: &response.ApiError{
-				Error: err.Error(),
-			},
-		}, http.StatusInternalServerError)
+		h.miniWalletRepo.FailedTransaction(models.ParamsWallet{
+			Amount: amount,
+			Currency: currency,
+			ReferenceID: referenceId,
+			CreatedBy: wallet.OwnedBy,
+		}, "transfer_out")
+		h.idempotentError(w, referenceId, custXId, "transfer", err)
 		return
 	}
-
-	apiResponse(w, response.ResponseAPI{
-		Status: "success",
-		Data: ResponseWithdrawWallet{
-			ID: withdraw.ID,
-			WithdrawnBy: custXId,
-			Status: "success",
-			WithdrawnAt: transaction.CreatedAt.String(),
-			Amount: amount,
-			ReferenceId: referenceId,
-		},
-	}, http.StatusOK)
+	idempotent.write(w)
 }
 
-func apiResponse(ar http.ResponseWriter, data interface{}, statusCode int) {
-	ar.Header().Set("Content-type", "application/json")
-	ar.WriteHeader(statusCode)
-	json.NewEncoder(ar).Encode(data)
+// existingWallet fetches the customer's wallet, whatever its status, and
+// fails unless it exists.
+func (h *miniWalletHandler) existingWallet(custXId string) (*entity.Wallet, error) {
+	wallet, err := h.miniWalletRepo.FetchMiniWalletByID(custXId)
+	if err != nil {
+		return nil, err
+	}
+	if wallet.ID == "" {
+		return nil, repository.ErrCustomerNotFound
+	}
+	return wallet, nil
 }
 
-func customerUnregistered(w http.ResponseWriter) {
-	apiResponse(w, response.ResponseAPI{
-		Status: "fail",
-		Data: &response.ApiError{
-			Error: "Customer is not registered",
-		},
-	}, http.StatusInternalServerError)
+// enabledWallet fetches the customer's wallet and fails unless it exists and
+// is active.
+func (h *miniWalletHandler) enabledWallet(custXId string) (*entity.Wallet, error) {
+	wallet, err := h.existingWallet(custXId)
+	if err != nil {
+		return nil, err
+	}
+	if err := repository.CheckActive(wallet); err != nil {
+		return nil, err
+	}
+	return wallet, nil
 }
-
-func walletIsDisabled(w http.ResponseWriter) {
-	apiResponse(w, response.ResponseAPI{
-		Status: "fail",
-		Data: &response.ApiError{
-			Error: "Wallet disabled",
-		},
-	}, http.StatusInternalServerError)
-}
\ No newline at end of file
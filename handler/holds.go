@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+	"github.com/Sigaeasu/go-mwe/config"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/utils/response"
+)
+
+const (
+	DefaultHoldTTL = 24 * time.Hour
+)
+
+// CaptureWithdrawal debits a withdrawal made with capture=false.
+func (h *miniWalletHandler) CaptureWithdrawal(w http.ResponseWriter, r *http.Request) {
+	custXId, err := readCustomer(r)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+
+	id, err := readPathID(r)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	if _, err := h.enabledWallet(custXId); err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	withdraw, err := h.miniWalletRepo.CaptureWithdrawal(custXId, id)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	response.Write(w, response.ResponseAPI{
+		Status: "success",
+		Data: withdrawalResponse(withdraw),
+	}, http.StatusOK)
+}
+
+// VoidWithdrawal releases the funds held by a withdrawal made with
+// capture=false. Unlike a capture it also works on a wallet that is not
+// active, so a frozen wallet's funds are not stuck until the hold expires.
+func (h *miniWalletHandler) VoidWithdrawal(w http.ResponseWriter, r *http.Request) {
+	custXId, err := readCustomer(r)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+
+	id, err := readPathID(r)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	if _, err := h.existingWallet(custXId); err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	withdraw, err := h.miniWalletRepo.VoidWithdrawal(custXId, id)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	response.Write(w, response.ResponseAPI{
+		Status: "success",
+		Data: withdrawalResponse(withdraw),
+	}, http.StatusOK)
+}
+
+func withdrawalResponse(withdraw *entity.Transaction) ResponseWithdrawWallet {
+	res := ResponseWithdrawWallet{
+		ID: withdraw.ID,
+		WithdrawnBy: withdraw.CreatedBy,
+		Status: withdraw.Status,
+		WithdrawnAt: withdraw.CreatedAt.String(),
+		Amount: withdraw.Amount.Number(withdraw.Currency),
+		Currency: withdraw.Currency,
+		ReferenceId: withdraw.ReferenceID,
+	}
+	if withdraw.Status == entity.TransactionStatusPending {
+		res.ExpiresAt = withdraw.ExpiresAt.String()
+	}
+	return res
+}
+
+// holdTTL is how long a withdrawal made with capture=false holds its funds.
+func holdTTL() time.Duration {
+	if ttl := config.Config.HoldsCfg.TTL; ttl > 0 {
+		return ttl
+	}
+	return DefaultHoldTTL
+}
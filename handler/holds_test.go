@@ -0,0 +1,102 @@
+package handler_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"github.com/Sigaeasu/go-mwe/handler"
+	"github.com/Sigaeasu/go-mwe/limits"
+	"github.com/Sigaeasu/go-mwe/models"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/models/money"
+	"github.com/Sigaeasu/go-mwe/repository"
+	"github.com/Sigaeasu/go-mwe/service"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
+	"github.com/Sigaeasu/go-mwe/utils/response"
+	"github.com/gorilla/mux"
+)
+
+const (
+	customer = "8b6f5c1e-3d2a-4f7b-9c0d-1e2f3a4b5c6d"
+	stranger = "0f1e2d3c-4b5a-4968-8776-655443322110"
+)
+
+// TestHoldsOfFrozenWallet checks that a frozen wallet's hold can be voided
+// but not captured.
+func TestHoldsOfFrozenWallet(t *testing.T) {
+	repo := repository.MiniWalletMemoryRepository(limits.Policy{})
+	h := handler.MiniWalletHandler(repo, nil)
+	if _, err := repo.CreateMiniWallet(customer); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.ChangeStatusOnMiniWallet(customer, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.Deposit(models.ParamsWallet{Amount: 1000, Currency: money.DefaultCurrency, ReferenceID: "deposit", CreatedBy: customer}); err != nil {
+		t.Fatal(err)
+	}
+	hold, err := repo.HoldWithdrawal(models.ParamsWallet{Amount: 300, Currency: money.DefaultCurrency, ReferenceID: "hold", CreatedBy: customer}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = repo.ForceWalletStatus(models.ParamsTransition{
+		CustomerXId: customer,
+		To: entity.WalletStatusFrozen,
+		ActorType: entity.ActorAdmin,
+		Actor: "ops",
+		Reason: "test",
+	}, entity.AdminAction{Actor: "ops", Reason: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		serve http.HandlerFunc
+		customer string
+		status int
+		code apperror.Code
+	}{
+		{"capture", h.CaptureWithdrawal, customer, http.StatusConflict, apperror.CodeWalletFrozen},
+		{"void of an unknown customer", h.VoidWithdrawal, stranger, http.StatusNotFound, apperror.CodeCustomerNotFound},
+		{"void", h.VoidWithdrawal, customer, http.StatusOK, ""},
+		{"void again", h.VoidWithdrawal, customer, http.StatusConflict, apperror.CodeHoldNotPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/v1/wallet/withdrawals/"+hold.ID, nil)
+			r = r.WithContext(context.WithValue(r.Context(), service.Customer, &service.MyClaims{CustomerXId: tt.customer}))
+			r = mux.SetURLVars(r, map[string]string{"id": hold.ID})
+			w := httptest.NewRecorder()
+			tt.serve(w, r)
+
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			var body response.ResponseAPI
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if tt.code == "" {
+				if body.Status != "success" {
+					t.Errorf("body = %s, want success", w.Body)
+				}
+				return
+			}
+			if body.Error_ == nil || body.Error_.Code != tt.code {
+				t.Errorf("body = %s, want code %s", w.Body, tt.code)
+			}
+		})
+	}
+
+	wallet, err := repo.FetchMiniWalletByID(customer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := wallet.Available(money.DefaultCurrency); got != 1000 {
+		t.Errorf("available balance = %s, want all of it back", got.String(money.DefaultCurrency))
+	}
+}
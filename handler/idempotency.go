@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/repository"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
+	"github.com/Sigaeasu/go-mwe/utils/response"
+	"github.com/sirupsen/logrus"
+)
+
+var ErrReferenceInProgress = apperror.New(apperror.CodeReferenceInProgress, "A request with this reference ID is still being processed")
+
+// replayResponse writes the stored response of an earlier request with the
+// same reference ID. It reports whether a response was written, in which case
+// the caller must not process the request again.
+func (h *miniWalletHandler) replayResponse(w http.ResponseWriter, referenceId string, custXId string, requestType string) bool {
+	stored, err := h.miniWalletRepo.FetchIdempotentResponse(referenceId)
+	if err != nil {
+		response.WriteError(w, err)
+		return true
+	}
+	if stored == nil {
+		return false
+	}
+	if stored.CustomerXId != custXId || stored.RequestType != requestType {
+		response.WriteError(w, repository.ErrDuplicateReference)
+		return true
+	}
+
+	w.Header().Set("Idempotent-Replayed", "true")
+	writeStored(w, stored)
+	return true
+}
+
+// referenceInProgress answers a request that lost the race for its reference
+// ID: the winner's response is replayed if it is already stored.
+func (h *miniWalletHandler) referenceInProgress(w http.ResponseWriter, referenceId string, custXId string, requestType string) {
+	if h.replayResponse(w, referenceId, custXId, requestType) {
+		return
+	}
+	response.WriteError(w, ErrReferenceInProgress)
+}
+
+// idempotentRequest builds the success response of a request with a
+// reference ID. The repository calls respond in the database transaction
+// that books the request and stores the result there, so the response is
+// saved exactly when the balance changes.
+type idempotentRequest struct {
+	referenceId string
+	custXId string
+	requestType string
+	stored *entity.IdempotentResponse
+}
+
+// respond marshals data as the 200 response of the request and keeps it for
+// write.
+func (req *idempotentRequest) respond(data response.ResponseAPI) (*entity.IdempotentResponse, error) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	req.stored = &entity.IdempotentResponse{
+		ReferenceID: req.referenceId,
+		CustomerXId: req.custXId,
+		RequestType: req.requestType,
+		StatusCode: http.StatusOK,
+		Body: body,
+	}
+	return req.stored, nil
+}
+
+// write sends the response the repository stored.
+func (req *idempotentRequest) write(w http.ResponseWriter) {
+	writeStored(w, req.stored)
+}
+
+func writeStored(w http.ResponseWriter, stored *entity.IdempotentResponse) {
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(stored.StatusCode)
+	w.Write(stored.Body)
+}
+
+// idempotentResponse stores a failure response under the reference ID before
+// sending it, so a retry of the same request gets the same answer. Nothing
+// was booked, so a failed save is only logged: the retry runs again.
+func (h *miniWalletHandler) idempotentResponse(w http.ResponseWriter, referenceId string, custXId string, requestType string, data response.ResponseAPI, statusCode int) {
+	body, err := json.Marshal(data)
+	if err == nil {
+		err = h.miniWalletRepo.SaveIdempotentResponse(entity.IdempotentResponse{
+			ReferenceID: referenceId,
+			CustomerXId: custXId,
+			RequestType: requestType,
+			StatusCode: statusCode,
+			Body: body,
+		})
+	}
+	if err != nil {
+		logrus.Errorf("Fail to store response for reference %s: %v", referenceId, err)
+	}
+	response.Write(w, data, statusCode)
+}
+
+// idempotentError stores business failures such as insufficient funds like
+// any other response. Internal errors are sent without being stored so the
+// client can retry.
+func (h *miniWalletHandler) idempotentError(w http.ResponseWriter, referenceId string, custXId string, requestType string, err error) {
+	data, statusCode := response.FromError(err)
+	if statusCode >= http.StatusInternalServerError {
+		response.Write(w, data, statusCode)
+		return
+	}
+	h.idempotentResponse(w, referenceId, custXId, requestType, data, statusCode)
+}
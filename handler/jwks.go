@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+	"github.com/Sigaeasu/go-mwe/service"
+	"github.com/Sigaeasu/go-mwe/utils/response"
+)
+
+// JWKS serves the public keys tokens are verified with, as a bare RFC 7517
+// key set so standard JWT libraries can fetch it. It includes keys about to
+// sign and keys whose tokens are still valid.
+func JWKS(w http.ResponseWriter, r *http.Request) {
+	keys, err := service.Keys()
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(keys.JWKS(time.Now()))
+}
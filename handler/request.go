@@ -0,0 +1,295 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"github.com/Sigaeasu/go-mwe/models"
+	"github.com/Sigaeasu/go-mwe/models/money"
+	"github.com/Sigaeasu/go-mwe/service"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
+	"github.com/Sigaeasu/go-mwe/utils/validation"
+	"github.com/gorilla/mux"
+)
+
+// readCustomer returns the customer_xid of the access token of the request.
+func readCustomer(r *http.Request) (string, error) {
+	custXId := service.CustomerFromContext(r.Context())
+	if custXId == "" {
+		return "", service.ErrInvalidToken
+	}
+	return custXId, nil
+}
+
+// walletRequest is the body of deposits and withdrawals.
+type walletRequest struct {
+	Amount money.Amount
+	Currency string
+	ReferenceID string
+}
+
+// withdrawRequest only holds the funds when Capture is false.
+type withdrawRequest struct {
+	walletRequest
+	Capture bool
+}
+
+// reversalRequest undoes Amount, or all that is left when Amount is zero.
+type reversalRequest struct {
+	Amount money.Amount
+	Currency string
+	ReferenceID string
+	Reason string
+}
+
+// transferRequest names the receiving wallet by customer or by wallet ID.
+type transferRequest struct {
+	walletRequest
+	ToCustomerXId string
+	ToWalletID string
+}
+
+// adjustmentRequest credits the wallet, or debits it when Amount is negative.
+type adjustmentRequest struct {
+	Amount money.Amount
+	Currency string
+	ReferenceID string
+	Reason string
+}
+
+// clientRequest registers a partner's API client.
+type clientRequest struct {
+	Name string
+	Reason string
+}
+
+// assignRequest puts CustomerXId in the scope of a client.
+type assignRequest struct {
+	CustomerXId string
+	Reason string
+}
+
+// closeRequest pays out whatever is left in the wallet when Sweep is set.
+type closeRequest struct {
+	Reason string
+	Sweep bool
+}
+
+func readCustomerXId(w http.ResponseWriter, r *http.Request) (string, error) {
+	form, err := validation.ReadForm(w, r)
+	if err != nil {
+		return "", err
+	}
+	var v validation.Validator
+	customerXId := v.UUID(form, "customer_xid", true)
+	return customerXId, v.Err()
+}
+
+func readRefreshToken(w http.ResponseWriter, r *http.Request) (string, error) {
+	form, err := validation.ReadForm(w, r)
+	if err != nil {
+		return "", err
+	}
+	var v validation.Validator
+	token := v.Required(form, "refresh_token")
+	return token, v.Err()
+}
+
+func readCurrency(w http.ResponseWriter, r *http.Request) (string, error) {
+	form, err := validation.ReadForm(w, r)
+	if err != nil {
+		return "", err
+	}
+	var v validation.Validator
+	currency := v.Currency(form, "currency")
+	return currency, v.Err()
+}
+
+func readWalletRequest(w http.ResponseWriter, r *http.Request) (walletRequest, error) {
+	form, err := validation.ReadForm(w, r)
+	if err != nil {
+		return walletRequest{}, err
+	}
+	var v validation.Validator
+	req := validateWalletRequest(&v, form)
+	return req, v.Err()
+}
+
+func readWithdrawRequest(w http.ResponseWriter, r *http.Request) (withdrawRequest, error) {
+	form, err := validation.ReadForm(w, r)
+	if err != nil {
+		return withdrawRequest{}, err
+	}
+	var v validation.Validator
+	req := withdrawRequest{
+		walletRequest: validateWalletRequest(&v, form),
+		Capture: v.Bool(form, "capture", true),
+	}
+	return req, v.Err()
+}
+
+func readTransferRequest(w http.ResponseWriter, r *http.Request) (transferRequest, error) {
+	form, err := validation.ReadForm(w, r)
+	if err != nil {
+		return transferRequest{}, err
+	}
+	var v validation.Validator
+	req := transferRequest{
+		walletRequest: validateWalletRequest(&v, form),
+		ToCustomerXId: v.UUID(form, "to_customer_xid", false),
+		ToWalletID: v.UUID(form, "to_wallet_id", false),
+	}
+	if form["to_customer_xid"] == "" && form["to_wallet_id"] == "" {
+		v.Reject("to_customer_xid", apperror.New(apperror.CodeMissingField, "Either to_customer_xid or to_wallet_id is required"))
+	}
+	return req, v.Err()
+}
+
+// readReversalRequest reads amount, currency, reference_id and, for admins,
+// the required reason.
+func readReversalRequest(w http.ResponseWriter, r *http.Request, reasonRequired bool) (reversalRequest, error) {
+	form, err := validation.ReadForm(w, r)
+	if err != nil {
+		return reversalRequest{}, err
+	}
+	var v validation.Validator
+	req := reversalRequest{
+		Currency: v.Currency(form, "currency"),
+		ReferenceID: v.UUID(form, "reference_id", true),
+	}
+	if form["amount"] != "" {
+		req.Amount = v.Amount(form, "amount", req.Currency)
+	}
+	if reasonRequired {
+		req.Reason = v.Required(form, "reason")
+	}
+	return req, v.Err()
+}
+
+func readReason(w http.ResponseWriter, r *http.Request) (string, error) {
+	form, err := validation.ReadForm(w, r)
+	if err != nil {
+		return "", err
+	}
+	var v validation.Validator
+	reason := v.Required(form, "reason")
+	return reason, v.Err()
+}
+
+// readCloseRequest reads reason and sweep. Admins must give a reason,
+// customers may.
+func readCloseRequest(w http.ResponseWriter, r *http.Request, reasonRequired bool) (closeRequest, error) {
+	form, err := validation.ReadForm(w, r)
+	if err != nil {
+		return closeRequest{}, err
+	}
+	var v validation.Validator
+	req := closeRequest{
+		Reason: form["reason"],
+		Sweep: v.Bool(form, "sweep", false),
+	}
+	if reasonRequired {
+		req.Reason = v.Required(form, "reason")
+	}
+	return req, v.Err()
+}
+
+func readAdjustmentRequest(w http.ResponseWriter, r *http.Request) (adjustmentRequest, error) {
+	form, err := validation.ReadForm(w, r)
+	if err != nil {
+		return adjustmentRequest{}, err
+	}
+	var v validation.Validator
+	currency := v.Currency(form, "currency")
+	req := adjustmentRequest{
+		Amount: v.SignedAmount(form, "amount", currency),
+		Currency: currency,
+		ReferenceID: v.UUID(form, "reference_id", true),
+		Reason: v.Required(form, "reason"),
+	}
+	return req, v.Err()
+}
+
+func readClientRequest(w http.ResponseWriter, r *http.Request) (clientRequest, error) {
+	form, err := validation.ReadForm(w, r)
+	if err != nil {
+		return clientRequest{}, err
+	}
+	var v validation.Validator
+	req := clientRequest{
+		Name: v.Required(form, "name"),
+		Reason: v.Required(form, "reason"),
+	}
+	return req, v.Err()
+}
+
+func readAssignRequest(w http.ResponseWriter, r *http.Request) (assignRequest, error) {
+	form, err := validation.ReadForm(w, r)
+	if err != nil {
+		return assignRequest{}, err
+	}
+	var v validation.Validator
+	req := assignRequest{
+		CustomerXId: v.UUID(form, "customer_xid", true),
+		Reason: v.Required(form, "reason"),
+	}
+	return req, v.Err()
+}
+
+func validateWalletRequest(v *validation.Validator, form validation.Form) walletRequest {
+	currency := v.Currency(form, "currency")
+	return walletRequest{
+		Amount: v.Amount(form, "amount", currency),
+		Currency: currency,
+		ReferenceID: v.UUID(form, "reference_id", true),
+	}
+}
+
+// readPathID returns the {id} route variable, which must be a UUID.
+func readPathID(r *http.Request) (string, error) {
+	var v validation.Validator
+	id := v.UUID(validation.Form(mux.Vars(r)), "id", true)
+	return id, v.Err()
+}
+
+// readPathCustomerXId returns the {customer_xid} route variable, which must
+// be a UUID.
+func readPathCustomerXId(r *http.Request) (string, error) {
+	var v validation.Validator
+	customerXId := v.UUID(validation.Form(mux.Vars(r)), "customer_xid", true)
+	return customerXId, v.Err()
+}
+
+// readPathClientID returns the {client_id} route variable, which must be a
+// UUID.
+func readPathClientID(r *http.Request) (string, error) {
+	var v validation.Validator
+	clientID := v.UUID(validation.Form(mux.Vars(r)), "client_id", true)
+	return clientID, v.Err()
+}
+
+// readAuditFilter reads ?customer_xid=&actor=&action=&after_id=&limit=.
+func readAuditFilter(r *http.Request) (models.AuditFilter, error) {
+	form := validation.Form{}
+	for name, values := range r.URL.Query() {
+		form[name] = values[0]
+	}
+	var v validation.Validator
+	filter := models.AuditFilter{
+		CustomerXId: v.UUID(form, "customer_xid", false),
+		Actor: form["actor"],
+		Action: form["action"],
+	}
+	if raw := form["after_id"]; raw != "" {
+		afterID, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || afterID < 0 {
+			v.Reject("after_id", apperror.New(apperror.CodeInvalidCursor, "Must be the id of an audit entry"))
+		}
+		filter.AfterID = afterID
+	}
+	limit, err := readLimit(r)
+	if err != nil {
+		v.Reject("limit", err)
+	}
+	filter.Limit = limit
+	return filter, v.Err()
+}
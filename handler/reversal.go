@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"github.com/Sigaeasu/go-mwe/models"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/repository"
+	"github.com/Sigaeasu/go-mwe/utils/response"
+)
+
+// ReverseTransaction undoes all or part of one of the customer's deposits
+// with a reversal row that links back to it. Withdrawals can only be
+// reversed through the admin API.
+func (h *miniWalletHandler) ReverseTransaction(w http.ResponseWriter, r *http.Request) {
+	custXId, err := readCustomer(r)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+
+	id, err := readPathID(r)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	req, err := readReversalRequest(w, r, false)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+
+	if h.replayResponse(w, req.ReferenceID, custXId, "reversal") {
+		return
+	}
+
+	wallet, err := h.enabledWallet(custXId)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+
+	idempotent := &idempotentRequest{referenceId: req.ReferenceID, custXId: custXId, requestType: "reversal"}
+	_, err = h.miniWalletRepo.Reverse(models.ParamsReversal{
+		TransactionID: id,
+		Amount: req.Amount,
+		Currency: req.Currency,
+		ReferenceID: req.ReferenceID,
+		CreatedBy: wallet.OwnedBy,
+		Respond: func(reversal entity.Transaction) (*entity.IdempotentResponse, error) {
+			return idempotent.respond(response.ResponseAPI{
+				Status: "success",
+				Data: transactionResponse(reversal),
+			})
+		},
+	})
+	if errors.Is(err, repository.ErrDuplicateReference) {
+		h.referenceInProgress(w, req.ReferenceID, custXId, "reversal")
+		return
+	}
+	if err != nil {
+		h.idempotentError(w, req.ReferenceID, custXId, "reversal", err)
+		return
+	}
+	idempotent.write(w)
+}
+
+func transactionResponse(t entity.Transaction) ResponseTransactions {
+	return ResponseTransactions{
+		ID: t.ID,
+		Status: t.Status,
+		TransactedAt: t.CreatedAt.String(),
+		Type: t.Type,
+		Amount: t.Amount.Number(t.Currency),
+		Currency: t.Currency,
+		ReferenceId: t.ReferenceID,
+		ReversalOf: t.ReversalOf,
+	}
+}
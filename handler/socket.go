@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"github.com/Sigaeasu/go-mwe/config"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/models/money"
+	"github.com/Sigaeasu/go-mwe/service"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
+	"github.com/Sigaeasu/go-mwe/utils/response"
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+// Messages pushed over the wallet WebSocket.
+const (
+	SocketMessageBalance = "balance"
+	SocketMessageEvent = "event"
+)
+
+const (
+	SocketWriteTimeout = 10 * time.Second
+	SocketMaxMessageSize = 512
+)
+
+var errSessionEnded = errors.New("session ended")
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize: 1024,
+	WriteBufferSize: 1024,
+	CheckOrigin: checkSocketOrigin,
+}
+
+// WalletSocket pushes the customer's balance on connect and then every
+// wallet event as it is committed, followed by the new balance. Every
+// session of the customer, on any instance, receives the same messages. The
+// socket is closed with the error code as reason once the wallet stops
+// being active or the access token it was opened with expires or is revoked.
+func (h *miniWalletHandler) WalletSocket(w http.ResponseWriter, r *http.Request) {
+	claims, ok := service.ClaimsFromContext(r.Context())
+	if !ok {
+		response.WriteError(w, service.ErrInvalidToken)
+		return
+	}
+	custXId := claims.CustomerXId
+
+	wallet, err := h.enabledWallet(custXId)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	// Subscribe before the first read of the log so no event falls between.
+	wake, cancel := h.hub.Subscribe(custXId)
+	defer cancel()
+	lastID, err := h.miniWalletRepo.LatestEventID(custXId)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has answered the request already.
+		return
+	}
+	defer conn.Close()
+
+	closed := make(chan struct{})
+	go readSocket(conn, closed)
+
+	err = writeSocket(conn, SocketMessageBalance, walletResponse(wallet, wallet.StatusName(), money.DefaultCurrency))
+	if err != nil {
+		return
+	}
+	ping := time.NewTicker(eventHeartbeat())
+	defer ping.Stop()
+	expiry := time.NewTimer(time.Until(claims.ExpiresAt.Time))
+	defer expiry.Stop()
+	for {
+		select {
+		case <-closed:
+			return
+		case <-expiry.C:
+			closeSocket(conn, service.ErrTokenExpired)
+			return
+		case <-wake:
+		case <-ping.C:
+			revoked, err := h.miniWalletRepo.IsTokenRevoked(claims.ID)
+			if err != nil {
+				logrus.Errorf("Fail to check token of %s: %v", custXId, err)
+				return
+			}
+			if revoked {
+				closeSocket(conn, service.ErrTokenRevoked)
+				return
+			}
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(SocketWriteTimeout))
+			if err != nil {
+				return
+			}
+			// Also catch up on events whose notification was lost.
+		}
+		if lastID, err = h.pushEvents(conn, custXId, lastID); err != nil {
+			if err != errSessionEnded {
+				logrus.Errorf("Fail to push events of %s: %v", custXId, err)
+			}
+			return
+		}
+	}
+}
+
+// pushEvents sends every event after lastID and then the balance, and
+// returns the ID of the last event sent.
+func (h *miniWalletHandler) pushEvents(conn *websocket.Conn, custXId string, lastID int64) (int64, error) {
+	sent := false
+	for {
+		events, err := h.miniWalletRepo.FetchEvents(custXId, lastID, EventBatchSize)
+		if err != nil {
+			return lastID, err
+		}
+		for _, event := range events {
+			if err := writeSocket(conn, SocketMessageEvent, eventResponse(event)); err != nil {
+				return lastID, errSessionEnded
+			}
+			lastID = event.ID
+			sent = true
+		}
+		if len(events) < EventBatchSize {
+			break
+		}
+	}
+	if !sent {
+		return lastID, nil
+	}
+
+	wallet, err := h.enabledWallet(custXId)
+	if err != nil {
+		closeSocket(conn, err)
+		return lastID, errSessionEnded
+	}
+	err = writeSocket(conn, SocketMessageBalance, walletResponse(wallet, wallet.StatusName(), money.DefaultCurrency))
+	if err != nil {
+		return lastID, errSessionEnded
+	}
+	return lastID, nil
+}
+
+func writeSocket(conn *websocket.Conn, messageType string, data interface{}) error {
+	conn.SetWriteDeadline(time.Now().Add(SocketWriteTimeout))
+	return conn.WriteJSON(ResponseSocketMessage{
+		Type: messageType,
+		Data: data,
+	})
+}
+
+// closeSocket tells the client why the session ends with a policy violation
+// close frame whose reason is the error code.
+func closeSocket(conn *websocket.Conn, err error) {
+	reason := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, string(apperror.CodeOf(err)))
+	conn.WriteControl(websocket.CloseMessage, reason, time.Now().Add(SocketWriteTimeout))
+}
+
+// readSocket drains what the client sends, which also answers pings and
+// close frames, and closes closed once the client is gone or has not
+// answered two pings.
+func readSocket(conn *websocket.Conn, closed chan struct{}) {
+	defer close(closed)
+	timeout := 2 * eventHeartbeat()
+	conn.SetReadLimit(SocketMaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(timeout))
+	})
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+// checkSocketOrigin accepts clients that send no Origin, like the mobile
+// app, the API's own origin and those listed in websocket.allowed_origins.
+func checkSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range config.Config.WebSocketCfg.AllowedOrigins {
+		if strings.EqualFold(origin, allowed) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+func eventResponse(event entity.WalletEvent) ResponseEvent {
+	return ResponseEvent{
+		ID: event.ID,
+		Type: event.Type,
+		WalletID: event.WalletID,
+		CreatedAt: event.CreatedAt.String(),
+		Data: event.Data,
+	}
+}
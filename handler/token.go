@@ -0,0 +1,91 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+	"github.com/Sigaeasu/go-mwe/audit"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/service"
+	"github.com/Sigaeasu/go-mwe/utils/response"
+)
+
+// RefreshToken swaps a refresh token for a new access token and a new
+// refresh token. Each refresh token works once; using one again revokes
+// every token issued from it.
+func (h *miniWalletHandler) RefreshToken(w http.ResponseWriter, r *http.Request) {
+	refreshToken, err := readRefreshToken(w, r)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+
+	now := time.Now()
+	next, record, err := service.NewRefreshToken(now)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	rotated, err := h.miniWalletRepo.RotateRefreshToken(service.HashRefreshToken(refreshToken), record, now)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	audit.SetSubject(r.Context(), rotated.CustomerXId)
+
+	tokens, err := accessTokens(*rotated, next)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	response.Write(w, response.ResponseAPI{
+		Status: "success",
+		Data: tokens,
+	}, http.StatusOK)
+}
+
+// Logout revokes the access token of the request and the refresh token
+// issued with it.
+func (h *miniWalletHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	claims, ok := service.ClaimsFromContext(r.Context())
+	if !ok {
+		response.WriteError(w, service.ErrInvalidToken)
+		return
+	}
+
+	err := h.miniWalletRepo.RevokeSession(claims.ID, claims.CustomerXId, claims.ExpiresAt.Time, time.Now())
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	response.Write(w, response.ResponseAPI{
+		Status: "success",
+		Data: EmptyResponse{},
+	}, http.StatusOK)
+}
+
+// startSession issues the first tokens of a new refresh token family, opened
+// by the API client.
+func (h *miniWalletHandler) startSession(customerXId string, clientID string) (*ResponseTokens, error) {
+	refreshToken, record, err := service.NewRefreshToken(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	record.CustomerXId = customerXId
+	record.ClientID = clientID
+	if err := h.miniWalletRepo.CreateRefreshToken(record); err != nil {
+		return nil, err
+	}
+	return accessTokens(record, refreshToken)
+}
+
+func accessTokens(record entity.RefreshToken, refreshToken string) (*ResponseTokens, error) {
+	token, err := service.GenerateToken(record.CustomerXId, record.AccessJTI, record.AccessExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &ResponseTokens{
+		Token: token,
+		RefreshToken: refreshToken,
+		ExpiresAt: record.AccessExpiresAt.String(),
+	}, nil
+}
@@ -1,11 +1,29 @@
 package handler
 
+import "encoding/json"
+
+type ResponseTokens struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresAt    string `json:"expires_at"`
+	WalletID     string `json:"wallet_id,omitempty"`
+}
+
 type ResponseWallet struct {
-	ID        string  `json:"id"`
-	OwnedBy   string  `json:"owned_by"`
-	Status    string  `json:"status"`
-	EnabledAt string  `json:"enabled_at"`
-	Balance   float64 `json:"balance"`
+	ID        string            `json:"id"`
+	OwnedBy   string            `json:"owned_by"`
+	Status    string            `json:"status"`
+	EnabledAt string            `json:"enabled_at"`
+	Currency  string            `json:"currency"`
+	Balance   json.Number       `json:"balance"`
+	Available json.Number       `json:"available_balance"`
+	Balances  []ResponseBalance `json:"balances"`
+}
+
+type ResponseBalance struct {
+	Currency  string      `json:"currency"`
+	Balance   json.Number `json:"balance"`
+	Available json.Number `json:"available_balance"`
 }
 
 type ResponseDepositWallet struct {
@@ -13,7 +31,8 @@ type ResponseDepositWallet struct {
 	DepositedBy string  `json:"deposited_by"`
 	Status      string  `json:"status"`
 	DepositAt   string  `json:"deposited_at"`
-	Amount      float64 `json:"amount"`
+	Amount      json.Number `json:"amount"`
+	Currency    string  `json:"currency"`
 	ReferenceId string  `json:"reference_id"`
 }
 
@@ -22,17 +41,110 @@ type ResponseWithdrawWallet struct {
 	WithdrawnBy string  `json:"withdrawn_by"`
 	Status      string  `json:"status"`
 	WithdrawnAt string  `json:"withdrawn_at"`
-	Amount      float64 `json:"amount"`
+	ExpiresAt   string  `json:"expires_at,omitempty"`
+	Amount      json.Number `json:"amount"`
+	Currency    string  `json:"currency"`
 	ReferenceId string  `json:"reference_id"`
 }
 
+type ResponseTransferWallet struct {
+	ID            string      `json:"id"`
+	TransferredBy string      `json:"transferred_by"`
+	TransferredTo string      `json:"transferred_to"`
+	Status        string      `json:"status"`
+	TransferredAt string      `json:"transferred_at"`
+	Amount        json.Number `json:"amount"`
+	Currency      string      `json:"currency"`
+	ReferenceId   string      `json:"reference_id"`
+}
+
 type ResponseTransactions struct {
 	ID          	string  `json:"id"`
 	Status      	string  `json:"status"`
 	TransactedAt	string  `json:"transacted_at"`
 	Type 			string  `json:"type"`
-	Amount      	float64 `json:"amount"`
+	Amount      	json.Number `json:"amount"`
+	Currency    	string  `json:"currency"`
 	ReferenceId 	string  `json:"reference_id"`
+	ReversalOf  	string  `json:"reversal_of,omitempty"`
+}
+
+type ResponseTransactionPage struct {
+	Transactions []ResponseTransactions `json:"transactions"`
+	NextCursor   string                 `json:"next_cursor,omitempty"`
+}
+
+type ResponseWebhook struct {
+	ID        string   `json:"id"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	Secret    string   `json:"secret,omitempty"`
+	CreatedAt string   `json:"created_at"`
+}
+
+type ResponseWebhookDelivery struct {
+	ID             string `json:"id"`
+	EventID        string `json:"event_id"`
+	EventType      string `json:"event_type"`
+	Status         string `json:"status"`
+	Attempts       int    `json:"attempts"`
+	NextAttemptAt  string `json:"next_attempt_at,omitempty"`
+	LastStatusCode int    `json:"last_status_code,omitempty"`
+	LastError      string `json:"last_error,omitempty"`
+	DeliveredAt    string `json:"delivered_at,omitempty"`
+	CreatedAt      string `json:"created_at"`
+}
+
+type ResponseWalletTransition struct {
+	ID        int64  `json:"id"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+	ActorType string `json:"actor_type"`
+	Actor     string `json:"actor"`
+	Reason    string `json:"reason,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+type ResponseAPIClient struct {
+	ClientID  string `json:"client_id"`
+	Name      string `json:"name"`
+	Secret    string `json:"client_secret,omitempty"`
+	CreatedAt string `json:"created_at"`
+	RevokedAt string `json:"revoked_at,omitempty"`
+}
+
+type ResponseEvent struct {
+	ID        int64           `json:"id"`
+	Type      string          `json:"type"`
+	WalletID  string          `json:"wallet_id"`
+	CreatedAt string          `json:"created_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+type ResponseSocketMessage struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+type ResponseAuditEntry struct {
+	ID          int64           `json:"id"`
+	ActorType   string          `json:"actor_type"`
+	Actor       string          `json:"actor,omitempty"`
+	Action      string          `json:"action"`
+	CustomerXId string          `json:"customer_xid,omitempty"`
+	Before      json.RawMessage `json:"before"`
+	After       json.RawMessage `json:"after"`
+	StatusCode  int             `json:"status_code"`
+	RequestID   string          `json:"request_id"`
+	ClientIP    string          `json:"client_ip"`
+	CreatedAt   string          `json:"created_at"`
+	PrevHash    string          `json:"prev_hash"`
+	Hash        string          `json:"hash"`
+}
+
+type ResponseAuditPage struct {
+	Entries []ResponseAuditEntry `json:"entries"`
+	NextAfterID int64 `json:"next_after_id,omitempty"`
 }
 
 type EmptyResponse struct {
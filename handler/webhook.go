@@ -0,0 +1,172 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/utils/response"
+	"github.com/Sigaeasu/go-mwe/utils/validation"
+	"github.com/Sigaeasu/go-mwe/webhook"
+)
+
+// CreateWebhook subscribes a URL to events of the caller's wallet. The URL
+// must resolve to public addresses. The signing secret is only shown in this
+// response.
+func (h *miniWalletHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	custXId, err := readCustomer(r)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+
+	form, err := validation.ReadForm(w, r)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	var v validation.Validator
+	subscription := entity.WebhookSubscription{
+		CustomerXId: custXId,
+		URL: v.URL(form, "url"),
+		Events: v.OneOf(form, "events", entity.EventTypes),
+	}
+	if subscription.URL != "" {
+		if err := webhook.CheckURL(subscription.URL); err != nil {
+			v.Reject("url", err)
+		}
+	}
+	if err := v.Err(); err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	if _, err := h.enabledWallet(custXId); err != nil {
+		response.WriteError(w, err)
+		return
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	subscription.Secret = hex.EncodeToString(secret)
+	created, err := h.miniWalletRepo.CreateWebhook(subscription)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	res := webhookResponse(*created)
+	res.Secret = created.Secret
+	response.Write(w, response.ResponseAPI{
+		Status: "success",
+		Data: res,
+	}, http.StatusCreated)
+}
+
+func (h *miniWalletHandler) ViewWebhooks(w http.ResponseWriter, r *http.Request) {
+	custXId, err := readCustomer(r)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+
+	subscriptions, err := h.miniWalletRepo.FetchWebhooks(custXId)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	webhooks := make([]ResponseWebhook, 0, len(subscriptions))
+	for _, s := range subscriptions {
+		webhooks = append(webhooks, webhookResponse(s))
+	}
+	response.Write(w, response.ResponseAPI{
+		Status: "success",
+		Data: webhooks,
+	}, http.StatusOK)
+}
+
+func (h *miniWalletHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	custXId, err := readCustomer(r)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+
+	id, err := readPathID(r)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	if err := h.miniWalletRepo.DeleteWebhook(custXId, id); err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	response.Write(w, response.ResponseAPI{
+		Status: "success",
+		Data: EmptyResponse{},
+	}, http.StatusOK)
+}
+
+// ViewWebhookDeliveries is the delivery log of one subscription, newest
+// first; ?limit= takes up to MaxLimit entries.
+func (h *miniWalletHandler) ViewWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	custXId, err := readCustomer(r)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+
+	id, err := readPathID(r)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	limit, err := readLimit(r)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	deliveries, err := h.miniWalletRepo.FetchWebhookDeliveries(custXId, id, limit)
+	if err != nil {
+		response.WriteError(w, err)
+		return
+	}
+	log := make([]ResponseWebhookDelivery, 0, len(deliveries))
+	for _, d := range deliveries {
+		log = append(log, webhookDeliveryResponse(d))
+	}
+	response.Write(w, response.ResponseAPI{
+		Status: "success",
+		Data: log,
+	}, http.StatusOK)
+}
+
+func webhookResponse(s entity.WebhookSubscription) ResponseWebhook {
+	return ResponseWebhook{
+		ID: s.ID,
+		URL: s.URL,
+		Events: s.Events,
+		CreatedAt: s.CreatedAt.String(),
+	}
+}
+
+func webhookDeliveryResponse(d entity.WebhookDelivery) ResponseWebhookDelivery {
+	res := ResponseWebhookDelivery{
+		ID: d.ID,
+		EventID: d.EventID,
+		EventType: d.EventType,
+		Status: d.Status,
+		Attempts: d.Attempts,
+		LastStatusCode: d.LastStatusCode,
+		LastError: d.LastError,
+		CreatedAt: d.CreatedAt.String(),
+	}
+	if d.Status == entity.WebhookStatusPending {
+		res.NextAttemptAt = d.NextAttemptAt.String()
+	}
+	if !d.DeliveredAt.IsZero() {
+		res.DeliveredAt = d.DeliveredAt.String()
+	}
+	return res
+}
@@ -0,0 +1,139 @@
+package limits
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"github.com/Sigaeasu/go-mwe/config"
+	"github.com/Sigaeasu/go-mwe/models/money"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
+)
+
+var (
+	ErrBelowMinimum = apperror.New(apperror.CodeAmountBelowMinimum, "Amount is below the minimum")
+	ErrAboveMaximum = apperror.New(apperror.CodeAmountAboveMaximum, "Amount is above the maximum")
+	ErrDailyLimit = apperror.New(apperror.CodeDailyLimitExceeded, "Daily limit exceeded")
+	ErrMonthlyLimit = apperror.New(apperror.CodeMonthlyLimitExceeded, "Monthly limit exceeded")
+	ErrHourlyCount = apperror.New(apperror.CodeVelocityLimitExceeded, "Too many transactions in the last hour")
+)
+
+// Rule caps one transaction type in one currency. Zero fields are not
+// enforced.
+type Rule struct {
+	Min money.Amount
+	Max money.Amount
+	Daily money.Amount
+	Monthly money.Amount
+	HourlyCount int
+}
+
+// Usage is what a wallet has already done in the windows of a Rule, counting
+// successful, captured and pending transactions of the same type and currency.
+type Usage struct {
+	Daily money.Amount
+	Monthly money.Amount
+	HourlyCount int
+}
+
+// Windows are the start times of the periods a Usage covers.
+type Windows struct {
+	Day time.Time
+	Month time.Time
+	Hour time.Time
+}
+
+// Policy holds the rules of every (transaction type, currency) pair. The zero
+// Policy allows everything.
+type Policy struct {
+	rules map[string]Rule
+}
+
+// FromConfig builds the policy in the limits section of the application
+// config. Amounts are written in major units, e.g. "10000.50".
+func FromConfig() (Policy, error) {
+	policy := Policy{rules: map[string]Rule{}}
+	for currency, types := range config.Config.LimitsCfg {
+		// viper lower-cases map keys.
+		currency = strings.ToUpper(currency)
+		for transactionType, cfg := range types {
+			var rule Rule
+			var err error
+			for _, field := range []struct {
+				name string
+				raw string
+				amount *money.Amount
+			}{
+				{"min", cfg.Min, &rule.Min},
+				{"max", cfg.Max, &rule.Max},
+				{"daily", cfg.Daily, &rule.Daily},
+				{"monthly", cfg.Monthly, &rule.Monthly},
+			} {
+				if field.raw == "" {
+					continue
+				}
+				if *field.amount, err = money.Parse(field.raw, currency); err != nil {
+					return Policy{}, fmt.Errorf("limits.%s.%s.%s: %w", currency, transactionType, field.name, err)
+				}
+			}
+			rule.HourlyCount = cfg.HourlyCount
+			policy.rules[key(transactionType, currency)] = rule
+		}
+	}
+	return policy, nil
+}
+
+// Rule returns the rule of the transaction type and currency, if there is one.
+func (p Policy) Rule(transactionType string, currency string) (Rule, bool) {
+	rule, ok := p.rules[key(transactionType, currency)]
+	return rule, ok
+}
+
+// WindowsAt returns the current day, month and hour windows. Days and months
+// follow the server's local time like the created_at column does.
+func WindowsAt(now time.Time) Windows {
+	year, month, day := now.Date()
+	return Windows{
+		Day: time.Date(year, month, day, 0, 0, 0, 0, now.Location()),
+		Month: time.Date(year, month, 1, 0, 0, 0, 0, now.Location()),
+		Hour: now.Add(-time.Hour),
+	}
+}
+
+// Earliest returns the start of the longest window.
+func (w Windows) Earliest() time.Time {
+	if w.Hour.Before(w.Month) {
+		return w.Hour
+	}
+	return w.Month
+}
+
+// Check reports the first rule the amount breaks given the usage so far.
+func (r Rule) Check(amount money.Amount, usage Usage, currency string) error {
+	if r.Min > 0 && amount < r.Min {
+		return fmt.Errorf("%w of %s %s", ErrBelowMinimum, r.Min.String(currency), currency)
+	}
+	if r.Max > 0 && amount > r.Max {
+		return fmt.Errorf("%w of %s %s", ErrAboveMaximum, r.Max.String(currency), currency)
+	}
+	if r.HourlyCount > 0 && usage.HourlyCount >= r.HourlyCount {
+		return fmt.Errorf("%w, at most %d are allowed", ErrHourlyCount, r.HourlyCount)
+	}
+	if r.Daily > 0 && usage.Daily+amount > r.Daily {
+		return fmt.Errorf("%w, %s of %s %s remain today", ErrDailyLimit, remaining(r.Daily, usage.Daily).String(currency), r.Daily.String(currency), currency)
+	}
+	if r.Monthly > 0 && usage.Monthly+amount > r.Monthly {
+		return fmt.Errorf("%w, %s of %s %s remain this month", ErrMonthlyLimit, remaining(r.Monthly, usage.Monthly).String(currency), r.Monthly.String(currency), currency)
+	}
+	return nil
+}
+
+func remaining(limit money.Amount, used money.Amount) money.Amount {
+	if used >= limit {
+		return 0
+	}
+	return limit - used
+}
+
+func key(transactionType string, currency string) string {
+	return transactionType + "/" + currency
+}
@@ -1,9 +1,15 @@
 package main
 
 import (
+	"os"
+	"github.com/Sigaeasu/go-mwe/reconcile"
 	"github.com/Sigaeasu/go-mwe/server"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "reconcile" {
+		reconcile.RunReconcile(os.Args[2:])
+		return
+	}
 	server.RunServer();
-}
\ No newline at end of file
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"github.com/Sigaeasu/go-mwe/models/money"
+)
+
+// AuditFilter selects audit entries with an ID above AfterID, oldest first.
+// Empty fields match everything.
+type AuditFilter struct {
+	CustomerXId string
+	Actor string
+	Action string
+	AfterID int64
+	Limit int
+}
+
+// AuditVerification is the result of walking the whole audit chain. When
+// Valid is false, BrokenAt is the first entry whose hash or link is wrong.
+// LastHash may be kept elsewhere to later prove no entry was cut off the end.
+type AuditVerification struct {
+	Entries int `json:"entries"`
+	Valid bool `json:"valid"`
+	BrokenAt int64 `json:"broken_at,omitempty"`
+	Problem string `json:"problem,omitempty"`
+	LastHash string `json:"last_hash"`
+}
+
+// WalletState is the snapshot of a wallet stored before and after an audited
+// request. Amounts are in minor units.
+type WalletState struct {
+	ID string `json:"id"`
+	Status string `json:"status"`
+	Balances []BalanceState `json:"balances"`
+}
+
+type BalanceState struct {
+	Currency string `json:"currency"`
+	Balance money.Amount `json:"balance"`
+	Held money.Amount `json:"held"`
+}
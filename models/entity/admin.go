@@ -0,0 +1,43 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Actions recorded in the admin audit log.
+const (
+	AdminActionSearchWallets = "wallet.search"
+	AdminActionViewTransactions = "wallet.transactions"
+	AdminActionEnableWallet = "wallet.enable"
+	AdminActionDisableWallet = "wallet.disable"
+	AdminActionFreezeWallet = "wallet.freeze"
+	AdminActionCloseWallet = "wallet.close"
+	AdminActionViewTransitions = "wallet.transitions"
+	AdminActionAdjustBalance = "wallet.adjust"
+	AdminActionReverseTransaction = "wallet.reverse"
+	AdminActionViewAudit = "audit.view"
+	AdminActionVerifyAudit = "audit.verify"
+	AdminActionCreateClient = "client.create"
+	AdminActionViewClients = "client.list"
+	AdminActionRevokeClient = "client.revoke"
+	AdminActionAssignCustomer = "client.assign"
+)
+
+// AdminOutcomeSuccess is the outcome of an action that succeeded; failed
+// actions record the error code instead.
+const AdminOutcomeSuccess = "success"
+
+// AdminAction is a row of the admin audit log. Actions that change a wallet
+// are written in the same transaction as the change.
+type AdminAction struct {
+	tableName	struct{} 		`pg:"admin_audit_log"`
+	ID 			int64 			`pg:"id,pk"`
+	Actor 		string 			`pg:"actor"`
+	Action 		string 			`pg:"action"`
+	CustomerXId string 			`pg:"customer_xid"`
+	Reason 		string 			`pg:"reason"`
+	Details 	json.RawMessage `pg:"details"`
+	Outcome 	string 			`pg:"outcome"`
+	CreatedAt 	time.Time 		`pg:"created_at"`
+}
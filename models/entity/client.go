@@ -0,0 +1,24 @@
+package entity
+
+import "time"
+
+// APIClient is a partner allowed to open sessions with POST /init. Only the
+// SHA-256 of its secret is stored. A revoked client cannot open new
+// sessions.
+type APIClient struct {
+	tableName	struct{} 	`pg:"api_clients"`
+	ID 			string 		`pg:"id,pk"`
+	Name 		string 		`pg:"name"`
+	SecretHash 	string 		`pg:"secret_hash"`
+	CreatedAt 	time.Time 	`pg:"created_at"`
+	RevokedAt 	time.Time 	`pg:"revoked_at"`
+}
+
+// ClientCustomer puts a customer in the scope of one client, the only one
+// that may open sessions for them.
+type ClientCustomer struct {
+	tableName	struct{} 	`pg:"api_client_customers"`
+	CustomerXId string 		`pg:"customer_xid,pk"`
+	ClientID 	string 		`pg:"client_id"`
+	CreatedAt 	time.Time 	`pg:"created_at"`
+}
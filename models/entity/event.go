@@ -0,0 +1,32 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event types that are only streamed, webhooks cannot subscribe to them. No
+// subscription exists before the wallet does, adjustments are made by
+// operations staff, and the rest only keep the customer's own screens up to
+// date with the balance.
+const (
+	EventWalletCreated = "wallet.created"
+	EventBalanceAdjusted = "balance.adjusted"
+	EventTransferSent = "transfer.sent"
+	EventTransferReceived = "transfer.received"
+	EventWithdrawalHeld = "withdrawal.held"
+	EventWithdrawalVoided = "withdrawal.voided"
+	EventWithdrawalExpired = "withdrawal.expired"
+)
+
+// WalletEvent is a row of the append-only log of wallet changes. IDs grow
+// with every event and are used as the SSE event ID.
+type WalletEvent struct {
+	tableName	struct{} 		`pg:"wallet_events"`
+	ID 			int64 			`pg:"id,pk"`
+	CustomerXId string 			`pg:"customer_xid"`
+	WalletID 	string 			`pg:"wallet_id"`
+	Type 		string 			`pg:"type"`
+	Data 		json.RawMessage `pg:"data"`
+	CreatedAt 	time.Time 		`pg:"created_at"`
+}
@@ -0,0 +1,16 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type IdempotentResponse struct {
+	tableName	struct{} 		`pg:"idempotent_responses"`
+	ReferenceID string 			`pg:"reference_id,pk"`
+	CustomerXId string 			`pg:"customer_xid"`
+	RequestType string 			`pg:"request_type"`
+	StatusCode 	int 			`pg:"status_code"`
+	Body 		json.RawMessage `pg:"body"`
+	CreatedAt 	time.Time 		`pg:"created_at"`
+}
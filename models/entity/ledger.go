@@ -0,0 +1,41 @@
+package entity
+
+import (
+	"time"
+	"github.com/Sigaeasu/go-mwe/models/money"
+)
+
+const (
+	AccountTypeWallet = "wallet"
+	AccountTypeSystem = "system"
+)
+
+type LedgerAccount struct {
+	tableName struct{} `pg:"ledger_accounts"`
+	ID string `json:"id" pg:"id,pk"`
+	Code string `json:"code" pg:"code"`
+	Type string `json:"type" pg:"type"`
+	WalletID string `json:"wallet_id,omitempty" pg:"wallet_id"`
+	Currency string `json:"currency" pg:"currency"`
+	Balance money.Amount `json:"-" pg:"balance,use_zero"`
+	CreatedAt time.Time `json:"created_at" pg:"created_at"`
+}
+
+type JournalEntry struct {
+	tableName struct{} `pg:"journal_entries"`
+	ID string `json:"id" pg:"id,pk"`
+	TransactionID string `json:"transaction_id,omitempty" pg:"transaction_id"`
+	Description string `json:"description" pg:"description"`
+	Currency string `json:"currency" pg:"currency"`
+	CreatedAt time.Time `json:"created_at" pg:"created_at"`
+}
+
+// Posting moves Amount into the account; a negative amount moves it out.
+type Posting struct {
+	tableName struct{} `pg:"postings"`
+	ID int64 `json:"id" pg:"id,pk"`
+	JournalEntryID string `json:"journal_entry_id" pg:"journal_entry_id"`
+	AccountID string `json:"account_id" pg:"account_id"`
+	Amount money.Amount `json:"-" pg:"amount,use_zero"`
+	CreatedAt time.Time `json:"created_at" pg:"created_at"`
+}
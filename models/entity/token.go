@@ -0,0 +1,32 @@
+package entity
+
+import "time"
+
+// RefreshToken is a server-side refresh token. Only the SHA-256 of the token
+// is stored. Every refresh rotates it: the token is marked rotated and a new
+// one of the same family is issued, so a rotated token shown again means it
+// was stolen and the whole family is revoked. ClientID is the API client
+// that opened the session, empty for sessions older than API clients.
+type RefreshToken struct {
+	tableName		struct{} 	`pg:"refresh_tokens"`
+	ID 				string 		`pg:"id,pk"`
+	FamilyID 		string 		`pg:"family_id"`
+	CustomerXId 	string 		`pg:"customer_xid"`
+	ClientID 		string 		`pg:"client_id"`
+	TokenHash 		string 		`pg:"token_hash"`
+	AccessJTI 		string 		`pg:"access_jti"`
+	AccessExpiresAt time.Time 	`pg:"access_expires_at"`
+	CreatedAt 		time.Time 	`pg:"created_at"`
+	ExpiresAt 		time.Time 	`pg:"expires_at"`
+	RotatedAt 		time.Time 	`pg:"rotated_at"`
+	RevokedAt 		time.Time 	`pg:"revoked_at"`
+}
+
+// RevokedToken lists an access token that must be refused until it expires.
+type RevokedToken struct {
+	tableName	struct{} 	`pg:"revoked_tokens"`
+	JTI 		string 		`pg:"jti,pk"`
+	CustomerXId string 		`pg:"customer_xid"`
+	ExpiresAt 	time.Time 	`pg:"expires_at"`
+	RevokedAt 	time.Time 	`pg:"revoked_at"`
+}
@@ -1,14 +1,59 @@
 package entity
 
-import "time"
+import (
+	"time"
+	"github.com/Sigaeasu/go-mwe/models/money"
+)
+
+const (
+	TransactionTypeDeposit = "deposit"
+	TransactionTypeWithdraw = "withdraw"
+	TransactionTypeTransferIn = "transfer_in"
+	TransactionTypeTransferOut = "transfer_out"
+	// TransactionTypeAdjustment carries a signed amount written by reconciliation.
+	TransactionTypeAdjustment = "adjustment"
+	// TransactionTypeReversal carries a signed amount that undoes part or all
+	// of the transaction in ReversalOf.
+	TransactionTypeReversal = "reversal"
+)
+
+const (
+	TransactionStatusSuccess = "success"
+	TransactionStatusFailed = "failed"
+	// A pending withdrawal holds funds until it is captured, voided or expires.
+	TransactionStatusPending = "pending"
+	TransactionStatusCaptured = "captured"
+	TransactionStatusVoided = "voided"
+	TransactionStatusExpired = "expired"
+)
 
 type Transaction struct {
-	tableName	struct{} 	`pg:"transactions"`
-	ID 			string 		`json:"id" pg:"id,pk"`
-	Amount 		float64 	`json:"amount" pg:"amount"`
-	Type 		string 		`json:"type" pg:"type"`
-	ReferenceID string 		`json:"reference_id" pg:"reference_id"`
-	Status 		string 		`json:"status" pg:"status"`
-	CreatedBy 	string 		`json:"-" pg:"created_by"`
-	CreatedAt 	time.Time 	`json:"transacted_at" pg:"created_at"`
+	tableName	struct{} 		`pg:"transactions"`
+	ID 			string 			`json:"id" pg:"id,pk"`
+	Amount 		money.Amount 	`json:"amount" pg:"amount,use_zero"`
+	Currency 	string 			`json:"currency" pg:"currency"`
+	Type 		string 			`json:"type" pg:"type"`
+	ReferenceID string 			`json:"reference_id" pg:"reference_id"`
+	Status 		string 			`json:"status" pg:"status"`
+	TransferID 	string 			`json:"transfer_id,omitempty" pg:"transfer_id"`
+	ExpiresAt 	time.Time 		`json:"-" pg:"expires_at"`
+	ReversalOf 	string 			`json:"reversal_of,omitempty" pg:"reversal_of"`
+	CreatedBy 	string 			`json:"-" pg:"created_by"`
+	CreatedAt 	time.Time 		`json:"transacted_at" pg:"created_at"`
+}
+
+// Booked reports whether the transaction has changed the balance.
+func (t Transaction) Booked() bool {
+	return t.Status == TransactionStatusSuccess || t.Status == TransactionStatusCaptured
+}
+
+// SignedAmount is the effect of a booked transaction on the balance.
+func (t Transaction) SignedAmount() money.Amount {
+	switch t.Type {
+	case TransactionTypeDeposit, TransactionTypeTransferIn, TransactionTypeAdjustment, TransactionTypeReversal:
+		return t.Amount
+	case TransactionTypeWithdraw, TransactionTypeTransferOut:
+		return -t.Amount
+	}
+	return 0
 }
@@ -1,13 +1,74 @@
 package entity
 
-import "time"
+import (
+	"time"
+	"github.com/Sigaeasu/go-mwe/models/money"
+)
+
+// Lifecycle states of a wallet. Only active wallets move money; see
+// repository.checkTransition for the allowed transitions.
+const (
+	WalletStatusActive = "active"
+	// WalletStatusDisabled is set by the customer, who may enable it again.
+	WalletStatusDisabled = "disabled"
+	// WalletStatusFrozen is set by an admin; only an admin can lift it.
+	WalletStatusFrozen = "frozen"
+	// WalletStatusClosed is final. A wallet is closed with no balance left.
+	WalletStatusClosed = "closed"
+)
 
 type Wallet struct {
 	tableName struct{} `pg:"mini_wallets"`
 	ID string `json:"id" pg:"id,pk"`
 	OwnedBy string `json:"-" pg:"owned_by"`
-	Balance float64 `json:"-" pg:"balance"`
+	Status string `json:"-" pg:"status"`
+	// IsEnabled mirrors Status == WalletStatusActive.
 	IsEnabled bool `json:"-" pg:"is_enabled"`
 	EnabledAt time.Time `json:"-" pg:"enabled_at"`
 	DisabledAt time.Time `json:"-" pg:"disabled_at"`
+	Balances []*WalletBalance `json:"-" pg:"rel:has-many"`
+}
+
+// Balance returns the wallet's balance in the currency, zero when the wallet
+// has never held that currency.
+func (w *Wallet) Balance(currency string) money.Amount {
+	for _, b := range w.Balances {
+		if b.Currency == currency {
+			return b.Balance
+		}
+	}
+	return 0
+}
+
+// Available returns the wallet's balance in the currency minus its pending
+// withdrawals.
+func (w *Wallet) Available(currency string) money.Amount {
+	for _, b := range w.Balances {
+		if b.Currency == currency {
+			return b.Available()
+		}
+	}
+	return 0
+}
+
+// StatusName is the status shown by the API, which has always called active
+// wallets enabled.
+func (w *Wallet) StatusName() string {
+	if w.Status == WalletStatusActive {
+		return "enabled"
+	}
+	return w.Status
+}
+
+// WalletTransition records one change of a wallet's lifecycle state.
+type WalletTransition struct {
+	tableName	struct{} 	`pg:"wallet_status_transitions"`
+	ID 			int64 		`pg:"id,pk"`
+	WalletID 	string 		`pg:"wallet_id"`
+	FromStatus 	string 		`pg:"from_status"`
+	ToStatus 	string 		`pg:"to_status"`
+	ActorType 	string 		`pg:"actor_type"`
+	Actor 		string 		`pg:"actor"`
+	Reason 		string 		`pg:"reason"`
+	CreatedAt 	time.Time 	`pg:"created_at"`
 }
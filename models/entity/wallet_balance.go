@@ -0,0 +1,16 @@
+package entity
+
+import "github.com/Sigaeasu/go-mwe/models/money"
+
+type WalletBalance struct {
+	tableName struct{} `pg:"wallet_balances"`
+	WalletID string `json:"-" pg:"wallet_id,pk"`
+	Currency string `json:"currency" pg:"currency,pk"`
+	Balance money.Amount `json:"-" pg:"balance,use_zero"`
+	Held money.Amount `json:"-" pg:"held,use_zero"`
+}
+
+// Available is the part of the balance not reserved by pending withdrawals.
+func (b *WalletBalance) Available() money.Amount {
+	return b.Balance - b.Held
+}
@@ -0,0 +1,77 @@
+package entity
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Event types a webhook subscription can ask for.
+const (
+	EventDepositSucceeded = "deposit.succeeded"
+	EventDepositFailed = "deposit.failed"
+	EventWithdrawalSucceeded = "withdrawal.succeeded"
+	EventWithdrawalFailed = "withdrawal.failed"
+	EventTransactionReversed = "transaction.reversed"
+	EventWalletEnabled = "wallet.enabled"
+	EventWalletDisabled = "wallet.disabled"
+	EventWalletFrozen = "wallet.frozen"
+	EventWalletClosed = "wallet.closed"
+)
+
+// EventTypes lists every event type in the order they are documented.
+var EventTypes = []string{
+	EventDepositSucceeded,
+	EventDepositFailed,
+	EventWithdrawalSucceeded,
+	EventWithdrawalFailed,
+	EventTransactionReversed,
+	EventWalletEnabled,
+	EventWalletDisabled,
+	EventWalletFrozen,
+	EventWalletClosed,
+}
+
+const (
+	WebhookStatusPending = "pending"
+	WebhookStatusDelivered = "delivered"
+	// WebhookStatusFailed is final: the delivery ran out of attempts or its
+	// subscription was deleted.
+	WebhookStatusFailed = "failed"
+)
+
+type WebhookSubscription struct {
+	tableName	struct{} 		`pg:"webhook_subscriptions"`
+	ID 			string 			`pg:"id,pk"`
+	CustomerXId string 			`pg:"customer_xid"`
+	URL 		string 			`pg:"url"`
+	Events 		[]string 		`pg:"events,array"`
+	Secret 		string 			`pg:"secret"`
+	CreatedAt 	time.Time 		`pg:"created_at"`
+	DeletedAt 	time.Time 		`pg:"deleted_at"`
+}
+
+// Subscribes reports whether the subscription asks for the event type.
+func (s WebhookSubscription) Subscribes(eventType string) bool {
+	for _, e := range s.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type WebhookDelivery struct {
+	tableName		struct{} 		`pg:"webhook_deliveries"`
+	ID 				string 			`pg:"id,pk"`
+	SubscriptionID 	string 			`pg:"subscription_id"`
+	EventID 		string 			`pg:"event_id"`
+	EventType 		string 			`pg:"event_type"`
+	Payload 		json.RawMessage `pg:"payload"`
+	Status 			string 			`pg:"status"`
+	Attempts 		int 			`pg:"attempts,use_zero"`
+	NextAttemptAt 	time.Time 		`pg:"next_attempt_at"`
+	LastStatusCode 	int 			`pg:"last_status_code"`
+	LastError 		string 			`pg:"last_error"`
+	DeliveredAt 	time.Time 		`pg:"delivered_at"`
+	CreatedAt 		time.Time 		`pg:"created_at"`
+}
@@ -0,0 +1,103 @@
+package money
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
+)
+
+// DefaultCurrency is used when a request does not name a currency.
+const DefaultCurrency = "IDR"
+
+var (
+	ErrInvalidAmount   = apperror.New(apperror.CodeInvalidAmount, "Invalid amount")
+	ErrTooManyDecimals = apperror.New(apperror.CodeInvalidAmount, "Amount has more decimal places than the currency allows")
+	ErrAmountOverflow  = apperror.New(apperror.CodeInvalidAmount, "Amount is too large")
+	ErrUnsupportedCurrency = apperror.New(apperror.CodeUnsupportedCurrency, "Unsupported currency")
+)
+
+// exponents holds the ISO-4217 minor unit of every supported currency.
+var exponents = map[string]int{
+	"IDR": 2,
+	"MYR": 2,
+	"PHP": 2,
+	"SGD": 2,
+	"THB": 2,
+	"USD": 2,
+	"VND": 0,
+}
+
+// Amount is a quantity of money in the minor unit of its currency, e.g. cents.
+type Amount int64
+
+// Exponent returns the number of decimal places of the currency.
+func Exponent(currency string) (int, error) {
+	exp, ok := exponents[currency]
+	if !ok {
+		return 0, fmt.Errorf("%w %q", ErrUnsupportedCurrency, currency)
+	}
+	return exp, nil
+}
+
+// Parse reads a decimal string such as "10000.50" into minor units without
+// going through floating point.
+func Parse(value string, currency string) (Amount, error) {
+	exp, err := Exponent(currency)
+	if err != nil {
+		return 0, err
+	}
+
+	value = strings.TrimSpace(value)
+	whole, fraction, hasPoint := strings.Cut(value, ".")
+	if whole == "" || (hasPoint && fraction == "") || !isDigits(whole) || !isDigits(fraction) {
+		return 0, ErrInvalidAmount
+	}
+	if len(fraction) > exp {
+		return 0, ErrTooManyDecimals
+	}
+	fraction += strings.Repeat("0", exp-len(fraction))
+
+	minor, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return 0, ErrAmountOverflow
+	}
+	return Amount(minor), nil
+}
+
+// String formats the amount in major units with exactly as many decimals as
+// the currency has.
+func (a Amount) String(currency string) string {
+	exp, err := Exponent(currency)
+	if err != nil || exp == 0 {
+		return strconv.FormatInt(int64(a), 10)
+	}
+
+	sign := ""
+	abs := uint64(a)
+	if a < 0 {
+		sign = "-"
+		abs = uint64(-(a + 1)) + 1
+	}
+	digits := strconv.FormatUint(abs, 10)
+	if len(digits) <= exp {
+		digits = strings.Repeat("0", exp-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+}
+
+// Number formats the amount for JSON responses so it is still encoded as a
+// number rather than a string.
+func (a Amount) Number(currency string) json.Number {
+	return json.Number(a.String(currency))
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
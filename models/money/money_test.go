@@ -0,0 +1,81 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value string
+		currency string
+		want Amount
+		err error
+	}{
+		{"10000", "IDR", 1000000, nil},
+		{"10000.5", "IDR", 1000050, nil},
+		{"10000.50", "IDR", 1000050, nil},
+		{" 0.01 ", "USD", 1, nil},
+		{"0", "IDR", 0, nil},
+		{"25000", "VND", 25000, nil},
+		{"92233720368547758.07", "IDR", math.MaxInt64, nil},
+		{"92233720368547758.08", "IDR", 0, ErrAmountOverflow},
+		{"10000.505", "IDR", 0, ErrTooManyDecimals},
+		{"25000.5", "VND", 0, ErrTooManyDecimals},
+		{"", "IDR", 0, ErrInvalidAmount},
+		{".50", "IDR", 0, ErrInvalidAmount},
+		{"10.", "IDR", 0, ErrInvalidAmount},
+		{"-10", "IDR", 0, ErrInvalidAmount},
+		{"+10", "IDR", 0, ErrInvalidAmount},
+		{"1e3", "IDR", 0, ErrInvalidAmount},
+		{"1,000", "IDR", 0, ErrInvalidAmount},
+		{"10", "EUR", 0, ErrUnsupportedCurrency},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.value, tt.currency)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Parse(%q, %s) error = %v, want %v", tt.value, tt.currency, err, tt.err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Parse(%q, %s) = %d, want %d", tt.value, tt.currency, got, tt.want)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		amount Amount
+		currency string
+		want string
+	}{
+		{1000050, "IDR", "10000.50"},
+		{1, "USD", "0.01"},
+		{10, "USD", "0.10"},
+		{0, "IDR", "0.00"},
+		{-150, "IDR", "-1.50"},
+		{-5, "IDR", "-0.05"},
+		{math.MinInt64, "IDR", "-92233720368547758.08"},
+		{25000, "VND", "25000"},
+		{1234, "EUR", "1234"},
+	}
+	for _, tt := range tests {
+		if got := tt.amount.String(tt.currency); got != tt.want {
+			t.Errorf("Amount(%d).String(%s) = %q, want %q", tt.amount, tt.currency, got, tt.want)
+		}
+	}
+}
+
+// TestRoundTrip checks that String gives back what Parse read.
+func TestRoundTrip(t *testing.T) {
+	for _, value := range []string{"0.00", "0.07", "10000.50", "92233720368547758.07"} {
+		amount, err := Parse(value, "IDR")
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", value, err)
+		}
+		if got := amount.String("IDR"); got != value {
+			t.Errorf("Parse(%q).String() = %q", value, got)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"encoding/base64"
+	"strings"
+	"time"
+	"github.com/Sigaeasu/go-mwe/models/money"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
+	"github.com/Sigaeasu/go-mwe/utils/validation"
+)
+
+var ErrInvalidCursor = apperror.New(apperror.CodeInvalidCursor, "Invalid cursor")
+
+// TransactionFilter narrows a customer's transaction history. Zero values mean
+// "no filter" except Limit, which must be positive.
+type TransactionFilter struct {
+	CreatedBy string
+	After *TransactionCursor
+	Limit int
+	Type string
+	Status string
+	Currency string
+	From time.Time
+	To time.Time
+	MinAmount *money.Amount
+	MaxAmount *money.Amount
+}
+
+// TransactionCursor points at the last transaction of a page in the
+// (created_at, id) ordering.
+type TransactionCursor struct {
+	CreatedAt time.Time
+	ID string
+}
+
+func (c TransactionCursor) Encode() string {
+	raw := c.CreatedAt.Format(time.RFC3339Nano) + "|" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeTransactionCursor reverses Encode. The ID must be a UUID, as it is
+// compared with the uuid id column.
+func DecodeTransactionCursor(cursor string) (*TransactionCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok || !validation.IsUUID(id) {
+		return nil, ErrInvalidCursor
+	}
+	t, err := time.Parse(time.RFC3339Nano, createdAt)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &TransactionCursor{CreatedAt: t, ID: id}, nil
+}
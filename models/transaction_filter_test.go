@@ -0,0 +1,48 @@
+package models
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDecodeTransactionCursor(t *testing.T) {
+	id := "0b5c3f6e-8a1d-4c2e-9f47-5d6e7a8b9c0d"
+	createdAt := time.Date(2024, 3, 1, 9, 30, 15, 123456000, time.UTC)
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+
+	tests := []struct {
+		name string
+		cursor string
+		want *TransactionCursor
+	}{
+		{"round trip", TransactionCursor{CreatedAt: createdAt, ID: id}.Encode(), &TransactionCursor{CreatedAt: createdAt, ID: id}},
+		{"not base64", "not base64!", nil},
+		{"no separator", encode("2024-03-01T09:30:15Z"), nil},
+		{"no id", encode("2024-03-01T09:30:15Z|"), nil},
+		{"id not a UUID", encode("2024-03-01T09:30:15Z|junk"), nil},
+		{"id with a quote", encode("2024-03-01T09:30:15Z|0b5c3f6e-8a1d-4c2e-9f47-5d6e7a8b9c0'"), nil},
+		{"bad time", encode("yesterday|" + id), nil},
+		{"empty", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeTransactionCursor(tt.cursor)
+			if tt.want == nil {
+				if !errors.Is(err, ErrInvalidCursor) {
+					t.Fatalf("got %+v, %v, want %v", got, err, ErrInvalidCursor)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !got.CreatedAt.Equal(tt.want.CreatedAt) || got.ID != tt.want.ID {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,8 +1,93 @@
 package models
 
+import (
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/models/money"
+)
+
+// Respond builds the response kept under the reference ID of a request from
+// the transaction it booked. The repository stores it in the database
+// transaction of the booking, so the two commit together. A nil Respond
+// stores nothing.
+type Respond func(transaction entity.Transaction) (*entity.IdempotentResponse, error)
+
+// RespondTransfer is the Respond of a transfer.
+type RespondTransfer func(result TransferResult) (*entity.IdempotentResponse, error)
+
 type ParamsWallet struct {
-	Amount float64
-	Balance float64
+	Amount money.Amount
+	Currency string
+	ReferenceID string
+	CreatedBy string
+	Respond Respond
+}
+
+// ParamsReversal undoes Amount of a deposit or withdrawal, or whatever is
+// left of it when Amount is zero.
+type ParamsReversal struct {
+	TransactionID string
+	Amount money.Amount
+	Currency string
 	ReferenceID string
 	CreatedBy string
+	Respond Respond
+}
+
+// ParamsTransition moves the wallet of CustomerXId to the To state. Closing
+// fails while the wallet holds money unless Sweep pays it all out first.
+type ParamsTransition struct {
+	CustomerXId string
+	To string
+	ActorType string
+	Actor string
+	Reason string
+	Sweep bool
+}
+
+// ParamsAdjustment is a manual correction of the CreatedBy wallet by
+// operations staff. Amount is signed: positive credits, negative debits.
+type ParamsAdjustment struct {
+	Amount money.Amount
+	Currency string
+	ReferenceID string
+	CreatedBy string
+}
+
+// ParamsTransfer moves Amount from the CreatedBy wallet to the wallet owned by
+// ToCustomerXId or, when that is empty, the wallet with ID ToWalletID.
+type ParamsTransfer struct {
+	Amount money.Amount
+	Currency string
+	ReferenceID string
+	CreatedBy string
+	ToCustomerXId string
+	ToWalletID string
+	Respond RespondTransfer
+}
+
+type TransferResult struct {
+	TransferID string
+	Debit *entity.Transaction
+	Credit *entity.Transaction
+}
+
+// LedgerMismatch is a wallet balance that differs from the sum of the
+// postings on its ledger account.
+type LedgerMismatch struct {
+	OwnedBy string `json:"owned_by"`
+	WalletID string `json:"wallet_id"`
+	Currency string `json:"currency"`
+	Balance money.Amount `json:"balance"`
+	LedgerBalance money.Amount `json:"ledger_balance"`
+}
+
+// BalanceDrift compares a wallet balance with the sum of the successful
+// transactions in its currency. Drift is Balance - TransactionsTotal.
+type BalanceDrift struct {
+	OwnedBy string `json:"owned_by"`
+	WalletID string `json:"wallet_id"`
+	Currency string `json:"currency"`
+	Balance money.Amount `json:"balance"`
+	TransactionsTotal money.Amount `json:"transactions_total"`
+	Drift money.Amount `json:"drift"`
 }
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+)
+
+// WebhookEvent is the body POSTed to subscribers.
+type WebhookEvent struct {
+	ID string `json:"id"`
+	Type string `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Data interface{} `json:"data"`
+}
+
+type TransactionEventData struct {
+	ID string `json:"id"`
+	CustomerXId string `json:"customer_xid"`
+	Type string `json:"type"`
+	Status string `json:"status"`
+	Amount json.Number `json:"amount"`
+	Currency string `json:"currency"`
+	ReferenceID string `json:"reference_id"`
+	TransactedAt time.Time `json:"transacted_at"`
+}
+
+type WalletEventData struct {
+	ID string `json:"id"`
+	CustomerXId string `json:"customer_xid"`
+	Status string `json:"status"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// DueDelivery is a claimed outbox row with where and how to send it.
+type DueDelivery struct {
+	Delivery entity.WebhookDelivery
+	URL string
+	Secret string
+}
+
+func NewTransactionEventData(t entity.Transaction) TransactionEventData {
+	return TransactionEventData{
+		ID: t.ID,
+		CustomerXId: t.CreatedBy,
+		Type: t.Type,
+		Status: t.Status,
+		Amount: t.Amount.Number(t.Currency),
+		Currency: t.Currency,
+		ReferenceID: t.ReferenceID,
+		TransactedAt: t.CreatedAt,
+	}
+}
@@ -0,0 +1,88 @@
+package realtime
+
+import (
+	"context"
+	"sync"
+	"time"
+	"github.com/Sigaeasu/go-mwe/repository"
+	"github.com/sirupsen/logrus"
+)
+
+const DefaultRetryDelay = 5 * time.Second
+
+// Hub wakes the connected sessions of a customer whenever an event of theirs
+// is committed, by this instance or any other sharing the database.
+type Hub struct {
+	repo repository.EventRepoInterface
+	mutex sync.Mutex
+	sessions map[string]map[chan struct{}]struct{}
+	RetryDelay time.Duration
+}
+
+func NewHub(repo repository.EventRepoInterface) *Hub {
+	return &Hub{
+		repo: repo,
+		sessions: map[string]map[chan struct{}]struct{}{},
+		RetryDelay: DefaultRetryDelay,
+	}
+}
+
+// Run listens for new events forever. When the listener fails every session
+// is woken so none misses what was committed while it reconnects.
+func (h *Hub) Run() {
+	for {
+		err := h.repo.ListenEvents(context.Background(), h.Notify)
+		logrus.Errorf("Fail to listen for wallet events, retrying in %s: %v", h.RetryDelay, err)
+		h.notifyAll()
+		time.Sleep(h.RetryDelay)
+	}
+}
+
+// Subscribe returns a channel that receives a value when the customer may
+// have new events. Wakes are coalesced, so a slow session sees one for many
+// events and must read the log itself. Call cancel when the session ends.
+func (h *Hub) Subscribe(customerXId string) (<-chan struct{}, func()) {
+	wake := make(chan struct{}, 1)
+	h.mutex.Lock()
+	if h.sessions[customerXId] == nil {
+		h.sessions[customerXId] = map[chan struct{}]struct{}{}
+	}
+	h.sessions[customerXId][wake] = struct{}{}
+	h.mutex.Unlock()
+
+	cancel := func() {
+		h.mutex.Lock()
+		defer h.mutex.Unlock()
+		delete(h.sessions[customerXId], wake)
+		if len(h.sessions[customerXId]) == 0 {
+			delete(h.sessions, customerXId)
+		}
+	}
+	return wake, cancel
+}
+
+// Notify wakes every session of the customer without blocking.
+func (h *Hub) Notify(customerXId string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for wake := range h.sessions[customerXId] {
+		wakeUp(wake)
+	}
+}
+
+func (h *Hub) notifyAll() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for _, sessions := range h.sessions {
+		for wake := range sessions {
+			wakeUp(wake)
+		}
+	}
+}
+
+func wakeUp(wake chan struct{}) {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
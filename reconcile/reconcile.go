@@ -0,0 +1,163 @@
+package reconcile
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"github.com/Sigaeasu/go-mwe/repository"
+	"github.com/sirupsen/logrus"
+)
+
+// Checks a wallet balance is compared against.
+const (
+	CheckTransactions = "transactions"
+	CheckLedger = "ledger"
+)
+
+// Report is what the reconcile command prints in JSON format.
+type Report struct {
+	WalletsScanned int `json:"wallets_scanned"`
+	Drifts []Drift `json:"drifts"`
+	Adjustments []Adjustment `json:"adjustments,omitempty"`
+}
+
+// Drift is a balance that differs from what Check expects it to be. Amounts
+// are formatted in major units; Drift is Balance - Expected.
+type Drift struct {
+	Check string `json:"check"`
+	OwnedBy string `json:"owned_by"`
+	WalletID string `json:"wallet_id"`
+	Currency string `json:"currency"`
+	Balance json.Number `json:"balance"`
+	Expected json.Number `json:"expected"`
+	Drift json.Number `json:"drift"`
+}
+
+type Adjustment struct {
+	OwnedBy string `json:"owned_by"`
+	Currency string `json:"currency"`
+	TransactionID string `json:"transaction_id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// RunReconcile implements `go-mwe reconcile [-format json|csv] [-output file] [-fix]`.
+// It compares each wallet balance with the sum of its successful transactions
+// and with its ledger account, prints the differences and exits with status 1
+// when there are any. With -fix an adjustment transaction is written for every
+// transaction drift.
+func RunReconcile(args []string) {
+	flags := flag.NewFlagSet("reconcile", flag.ExitOnError)
+	format := flags.String("format", "json", "report format: json or csv")
+	output := flags.String("output", "", "write the report to this file instead of stdout")
+	fix := flags.Bool("fix", false, "write adjustment transactions for every transaction drift")
+	flags.Parse(args)
+
+	if *format != "json" && *format != "csv" {
+		logrus.Fatalf("Unknown report format %q", *format)
+	}
+
+	miniWalletDatabase := repository.NewMiniWalletRepository()
+
+	report, err := Reconcile(miniWalletDatabase, *fix)
+	if err != nil {
+		logrus.Fatalf("Reconciliation failed: %v", err)
+	}
+
+	out := io.Writer(os.Stdout)
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			logrus.Fatalf("Fail to create report file: %v", err)
+		}
+		defer file.Close()
+		out = file
+	}
+	if *format == "csv" {
+		err = writeCSV(out, report)
+	} else {
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(report)
+	}
+	if err != nil {
+		logrus.Fatalf("Fail to write report: %v", err)
+	}
+
+	logrus.Infof("Scanned %d wallets, found %d drifts", report.WalletsScanned, len(report.Drifts))
+	if len(report.Drifts) > 0 {
+		os.Exit(1)
+	}
+}
+
+// Reconcile builds the drift report and, when fix is set, writes adjustments.
+func Reconcile(miniWalletRepo repository.MiniWalletRepoInterface, fix bool) (*Report, error) {
+	balances, err := miniWalletRepo.FetchBalanceDrifts()
+	if err != nil {
+		return nil, err
+	}
+	mismatches, err := miniWalletRepo.VerifyLedger()
+	if err != nil {
+		return nil, err
+	}
+
+	report := Report{
+		Drifts: []Drift{},
+	}
+	wallets := map[string]bool{}
+	for _, b := range balances {
+		wallets[b.WalletID] = true
+		if b.Drift == 0 {
+			continue
+		}
+		report.Drifts = append(report.Drifts, Drift{
+			Check: CheckTransactions,
+			OwnedBy: b.OwnedBy,
+			WalletID: b.WalletID,
+			Currency: b.Currency,
+			Balance: b.Balance.Number(b.Currency),
+			Expected: b.TransactionsTotal.Number(b.Currency),
+			Drift: b.Drift.Number(b.Currency),
+		})
+
+		if !fix {
+			continue
+		}
+		adjustment := Adjustment{
+			OwnedBy: b.OwnedBy,
+			Currency: b.Currency,
+		}
+		transaction, err := miniWalletRepo.WriteAdjustment(b.OwnedBy, b.Currency)
+		if err != nil {
+			adjustment.Error = err.Error()
+		} else {
+			adjustment.TransactionID = transaction.ID
+		}
+		report.Adjustments = append(report.Adjustments, adjustment)
+	}
+	for _, m := range mismatches {
+		report.Drifts = append(report.Drifts, Drift{
+			Check: CheckLedger,
+			OwnedBy: m.OwnedBy,
+			WalletID: m.WalletID,
+			Currency: m.Currency,
+			Balance: m.Balance.Number(m.Currency),
+			Expected: m.LedgerBalance.Number(m.Currency),
+			Drift: (m.Balance - m.LedgerBalance).Number(m.Currency),
+		})
+	}
+	report.WalletsScanned = len(wallets)
+	return &report, nil
+}
+
+func writeCSV(out io.Writer, report *Report) error {
+	w := csv.NewWriter(out)
+	w.Write([]string{"check", "owned_by", "wallet_id", "currency", "balance", "expected", "drift"})
+	for _, d := range report.Drifts {
+		w.Write([]string{d.Check, d.OwnedBy, d.WalletID, d.Currency,
+			d.Balance.String(), d.Expected.String(), d.Drift.String()})
+	}
+	w.Flush()
+	return w.Error()
+}
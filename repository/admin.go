@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+	"github.com/go-pg/pg/v10"
+	"github.com/Sigaeasu/go-mwe/models"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+)
+
+// AdminRepoInterface serves the admin API. Methods that change a wallet take
+// the audit log entry of the change and write it in the same transaction.
+type AdminRepoInterface interface {
+	SearchWallets(ownedByPrefix string, limit int) ([]entity.Wallet, error)
+	ForceWalletStatus(params models.ParamsTransition, action entity.AdminAction) (*entity.Wallet, error)
+	AdjustBalance(params models.ParamsAdjustment, action entity.AdminAction) (*entity.Transaction, error)
+	RecordAdminAction(action entity.AdminAction) error
+}
+
+// SearchWallets returns up to limit wallets whose owned_by starts with the
+// prefix, with their balances, ordered by owned_by.
+func (pdb *miniWalletDatabase) SearchWallets(ownedByPrefix string, limit int) ([]entity.Wallet, error) {
+	wallets := []entity.Wallet{}
+	err := pdb.dbConn.Model(&wallets).
+		Relation("Balances").
+		Where("owned_by::text LIKE ?", ownedByPrefix+"%").
+		Order("owned_by ASC").
+		Limit(limit).
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return wallets, nil
+}
+
+// ForceWalletStatus moves the wallet to any state an admin may set,
+// including out of frozen.
+func (pdb *miniWalletDatabase) ForceWalletStatus(params models.ParamsTransition, action entity.AdminAction) (*entity.Wallet, error) {
+	return pdb.transition(params, &action)
+}
+
+// AdjustBalance credits or debits the wallet by the signed amount, whether
+// it is enabled or not, and books it against the adjustments account. A
+// debit may not touch held funds or take the balance below zero. Closed
+// wallets cannot be adjusted.
+func (pdb *miniWalletDatabase) AdjustBalance(params models.ParamsAdjustment, action entity.AdminAction) (*entity.Transaction, error) {
+	var transaction *entity.Transaction
+	err := pdb.dbConn.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		wallet, err := lockMiniWallet(tx, params.CreatedBy)
+		if err != nil {
+			return err
+		}
+		if wallet.Status == entity.WalletStatusClosed {
+			return ErrWalletClosed
+		}
+		if params.Amount < 0 {
+			err = debitBalance(tx, wallet.ID, params.Currency, -params.Amount)
+		} else {
+			err = changeBalance(tx, wallet.ID, params.Currency, params.Amount)
+		}
+		if err != nil {
+			return err
+		}
+		transaction, err = insertTransaction(tx, buildAdjustment(params))
+		if err != nil {
+			return err
+		}
+		err = postJournal(tx, entity.TransactionTypeAdjustment, transaction.ID, params.Currency,
+			systemLeg(AccountAdjustments, -params.Amount),
+			walletLeg(wallet.ID, params.Amount),
+		)
+		if err != nil {
+			return err
+		}
+		action, err = withAdjustmentDetails(action, *transaction)
+		if err != nil {
+			return err
+		}
+		if err := insertAdminAction(tx, action); err != nil {
+			return err
+		}
+		return publishEvent(tx, wallet, entity.EventBalanceAdjusted, models.NewTransactionEventData(*transaction))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// RecordAdminAction writes an action that changed nothing: a read, or an
+// attempt that failed.
+func (pdb *miniWalletDatabase) RecordAdminAction(action entity.AdminAction) error {
+	return insertAdminAction(pdb.dbConn, action)
+}
+
+func insertAdminAction(db pg.DBI, action entity.AdminAction) error {
+	action.CreatedAt = time.Now()
+	_, err := db.Model(&action).Insert()
+	return err
+}
+
+func buildAdjustment(params models.ParamsAdjustment) entity.Transaction {
+	return buildTransaction(models.ParamsWallet{
+		Amount: params.Amount,
+		Currency: params.Currency,
+		ReferenceID: params.ReferenceID,
+		CreatedBy: params.CreatedBy,
+	}, entity.TransactionTypeAdjustment, entity.TransactionStatusSuccess)
+}
+
+// withAdjustmentDetails records which transaction the adjustment wrote.
+func withAdjustmentDetails(action entity.AdminAction, transaction entity.Transaction) (entity.AdminAction, error) {
+	details, err := json.Marshal(models.NewTransactionEventData(transaction))
+	if err != nil {
+		return action, err
+	}
+	action.Details = details
+	return action, nil
+}
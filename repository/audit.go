@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"github.com/go-pg/pg/v10"
+	"github.com/Sigaeasu/go-mwe/models"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+)
+
+// auditChainLock is the advisory lock that serialises appends to the chain.
+const auditChainLock = 7305011
+
+const auditVerifyBatch = 1000
+
+// AuditRepoInterface stores the hash-chained audit log of mutating requests.
+type AuditRepoInterface interface {
+	AppendAudit(entry entity.AuditEntry) (*entity.AuditEntry, error)
+	FetchAuditEntries(filter models.AuditFilter) ([]entity.AuditEntry, error)
+	VerifyAudit() (models.AuditVerification, error)
+}
+
+// AppendAudit links the entry to the last one and stores it. Appends are
+// serialised by an advisory lock so two entries never share a predecessor.
+func (pdb *miniWalletDatabase) AppendAudit(entry entity.AuditEntry) (*entity.AuditEntry, error) {
+	err := pdb.dbConn.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		_, err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditChainLock)
+		if err != nil {
+			return err
+		}
+		var last entity.AuditEntry
+		err = tx.Model(&last).
+			Column("hash").
+			Order("id DESC").
+			Limit(1).
+			Select()
+		if err != nil && err != pg.ErrNoRows {
+			return err
+		}
+		entry = chainAuditEntry(entry, last.Hash)
+		_, err = tx.Model(&entry).Returning("id").Insert()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+func (pdb *miniWalletDatabase) FetchAuditEntries(filter models.AuditFilter) ([]entity.AuditEntry, error) {
+	entries := []entity.AuditEntry{}
+	query := pdb.dbConn.Model(&entries).
+		Where("id > ?", filter.AfterID).
+		Order("id ASC").
+		Limit(filter.Limit)
+	if filter.CustomerXId != "" {
+		query = query.Where("customer_xid = ?", filter.CustomerXId)
+	}
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if err := query.Select(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (pdb *miniWalletDatabase) VerifyAudit() (models.AuditVerification, error) {
+	return verifyAuditChain(pdb.FetchAuditEntries)
+}
+
+// chainAuditEntry stamps the entry and links it after prevHash. created_at is
+// kept to the microsecond in UTC, as Postgres returns it, so the hash can be
+// checked again after a round trip.
+func chainAuditEntry(entry entity.AuditEntry, prevHash string) entity.AuditEntry {
+	entry.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	entry.PrevHash = prevHash
+	entry.Hash = entry.ComputeHash()
+	return entry
+}
+
+// verifyAuditChain walks every entry in order and checks its hash and its
+// link to the entry before it.
+func verifyAuditChain(fetch func(models.AuditFilter) ([]entity.AuditEntry, error)) (models.AuditVerification, error) {
+	var result models.AuditVerification
+	filter := models.AuditFilter{Limit: auditVerifyBatch}
+	for {
+		entries, err := fetch(filter)
+		if err != nil {
+			return result, err
+		}
+		for _, e := range entries {
+			result.Entries++
+			switch {
+			case e.PrevHash != result.LastHash:
+				result.BrokenAt = e.ID
+				result.Problem = fmt.Sprintf("Entry %d does not follow the entry before it", e.ID)
+				return result, nil
+			case e.ComputeHash() != e.Hash:
+				result.BrokenAt = e.ID
+				result.Problem = fmt.Sprintf("Entry %d was changed after it was written", e.ID)
+				return result, nil
+			}
+			result.LastHash = e.Hash
+			filter.AfterID = e.ID
+		}
+		if len(entries) < filter.Limit {
+			result.Valid = true
+			return result, nil
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"github.com/go-pg/pg/v10"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/models/money"
+)
+
+// lockBalance selects the wallet's balance in the currency with FOR UPDATE.
+// A currency the wallet has never held is returned as an unsaved zero balance.
+func lockBalance(tx *pg.Tx, walletID string, currency string) (*entity.WalletBalance, error) {
+	balance := entity.WalletBalance{
+		WalletID: walletID,
+		Currency: currency,
+	}
+	err := tx.Model(&balance).
+		WherePK().
+		For("UPDATE").
+		Select()
+	if err != nil && err != pg.ErrNoRows {
+		return nil, err
+	}
+	return &balance, nil
+}
+
+// changeBalance adds delta, which may be negative, to the wallet's balance in
+// the currency and creates the balance on first use.
+func changeBalance(tx *pg.Tx, walletID string, currency string, delta money.Amount) error {
+	balance := entity.WalletBalance{
+		WalletID: walletID,
+		Currency: currency,
+		Balance: delta,
+	}
+	_, err := tx.Model(&balance).
+		OnConflict("(wallet_id, currency) DO UPDATE").
+		Set("balance = ?TableAlias.balance + EXCLUDED.balance").
+		Insert()
+	return err
+}
+
+// debitBalance locks the balance and takes amount from it, refusing to touch
+// funds held by pending withdrawals.
+func debitBalance(tx *pg.Tx, walletID string, currency string, amount money.Amount) error {
+	balance, err := lockBalance(tx, walletID, currency)
+	if err != nil {
+		return err
+	}
+	if balance.Available() < amount {
+		return ErrInsufficientBalance
+	}
+	return changeBalance(tx, walletID, currency, -amount)
+}
+
+// holdBalance locks the balance and reserves amount of it for a pending
+// withdrawal. The balance itself is left alone.
+func holdBalance(tx *pg.Tx, walletID string, currency string, amount money.Amount) error {
+	balance, err := lockBalance(tx, walletID, currency)
+	if err != nil {
+		return err
+	}
+	if balance.Available() < amount {
+		return ErrInsufficientBalance
+	}
+	return changeHeld(tx, walletID, currency, amount)
+}
+
+// changeHeld adds delta, which may be negative, to the held part of the
+// wallet's balance in the currency.
+func changeHeld(tx *pg.Tx, walletID string, currency string, delta money.Amount) error {
+	_, err := tx.Model((*entity.WalletBalance)(nil)).
+		Set("held = held + ?", delta).
+		Where("wallet_id = ?", walletID).
+		Where("currency = ?", currency).
+		Update()
+	return err
+}
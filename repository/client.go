@@ -0,0 +1,205 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"github.com/go-pg/pg/v10"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
+)
+
+var (
+	ErrClientNotFound = apperror.New(apperror.CodeClientNotFound, "API client not found")
+	ErrClientRevoked = apperror.New(apperror.CodeClientRevoked, "API client is revoked")
+	ErrCustomerNotInScope = apperror.New(apperror.CodeCustomerNotInScope, "Customer is not in the scope of this API client")
+)
+
+// ClientRepoInterface keeps the API clients allowed to call /init and the
+// customers in the scope of each. Admin changes take the audit log entry of
+// the change and write it in the same transaction.
+type ClientRepoInterface interface {
+	CreateAPIClient(client entity.APIClient, action entity.AdminAction) (*entity.APIClient, error)
+	FetchAPIClient(clientID string) (*entity.APIClient, error)
+	FetchAPIClients() ([]entity.APIClient, error)
+	RevokeAPIClient(clientID string, now time.Time, action entity.AdminAction) (*entity.APIClient, error)
+	AssignCustomer(clientID string, customerXId string, action entity.AdminAction) error
+	ClaimCustomer(clientID string, customerXId string) error
+}
+
+func (pdb *miniWalletDatabase) CreateAPIClient(client entity.APIClient, action entity.AdminAction) (*entity.APIClient, error) {
+	err := pdb.dbConn.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		if _, err := tx.Model(&client).Insert(); err != nil {
+			return err
+		}
+		return insertAdminAction(tx, action)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// FetchAPIClient answers ErrClientNotFound for an unknown client.
+func (pdb *miniWalletDatabase) FetchAPIClient(clientID string) (*entity.APIClient, error) {
+	client := entity.APIClient{}
+	err := pdb.dbConn.Model(&client).
+		Where("id = ?", clientID).
+		Select()
+	if err == pg.ErrNoRows {
+		return nil, ErrClientNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+func (pdb *miniWalletDatabase) FetchAPIClients() ([]entity.APIClient, error) {
+	clients := []entity.APIClient{}
+	err := pdb.dbConn.Model(&clients).
+		Order("created_at ASC").
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// RevokeAPIClient stops the client from opening new sessions and ends the
+// ones it opened: their refresh and access tokens are revoked.
+func (pdb *miniWalletDatabase) RevokeAPIClient(clientID string, now time.Time, action entity.AdminAction) (*entity.APIClient, error) {
+	var client *entity.APIClient
+	err := pdb.dbConn.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		var err error
+		client, err = lockAPIClient(tx, clientID)
+		if err != nil {
+			return err
+		}
+		client.RevokedAt = now
+		_, err = tx.Model(client).
+			WherePK().
+			Set("revoked_at = ?", now).
+			Update()
+		if err != nil {
+			return err
+		}
+		if err := revokeClientSessions(tx, clientID, now); err != nil {
+			return err
+		}
+		return insertAdminAction(tx, action)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+// AssignCustomer moves the customer into the scope of the client, out of
+// any other's. Customers whose wallet was opened before clients existed
+// must be assigned this way.
+func (pdb *miniWalletDatabase) AssignCustomer(clientID string, customerXId string, action entity.AdminAction) error {
+	return pdb.dbConn.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		if _, err := lockAPIClient(tx, clientID); err != nil {
+			return err
+		}
+		assignment := entity.ClientCustomer{
+			CustomerXId: customerXId,
+			ClientID: clientID,
+			CreatedAt: time.Now(),
+		}
+		_, err := tx.Model(&assignment).
+			OnConflict("(customer_xid) DO UPDATE").
+			Set("client_id = EXCLUDED.client_id, created_at = EXCLUDED.created_at").
+			Insert()
+		if err != nil {
+			return err
+		}
+		return insertAdminAction(tx, action)
+	})
+}
+
+// ClaimCustomer checks that the client may open a session for the customer.
+// A customer without a wallet joins the scope of the first client to claim
+// them; one with a wallet but in no scope must be assigned by an admin.
+func (pdb *miniWalletDatabase) ClaimCustomer(clientID string, customerXId string) error {
+	return pdb.dbConn.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		owner, err := customerOwner(tx, customerXId)
+		if err != nil {
+			return err
+		}
+		if owner != "" {
+			return checkScope(owner, clientID)
+		}
+		exists, err := tx.Model((*entity.Wallet)(nil)).
+			Where("owned_by = ?", customerXId).
+			Exists()
+		if err != nil {
+			return err
+		}
+		if exists {
+			return ErrCustomerNotInScope
+		}
+
+		claim := entity.ClientCustomer{
+			CustomerXId: customerXId,
+			ClientID: clientID,
+			CreatedAt: time.Now(),
+		}
+		res, err := tx.Model(&claim).
+			OnConflict("DO NOTHING").
+			Insert()
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() > 0 {
+			return nil
+		}
+		// Another request claimed the customer in the meantime.
+		owner, err = customerOwner(tx, customerXId)
+		if err != nil {
+			return err
+		}
+		return checkScope(owner, clientID)
+	})
+}
+
+func lockAPIClient(tx *pg.Tx, clientID string) (*entity.APIClient, error) {
+	client := entity.APIClient{}
+	err := tx.Model(&client).
+		Where("id = ?", clientID).
+		For("UPDATE").
+		Select()
+	if err == pg.ErrNoRows {
+		return nil, ErrClientNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !client.RevokedAt.IsZero() {
+		return nil, ErrClientRevoked
+	}
+	return &client, nil
+}
+
+// customerOwner returns the ID of the client whose scope the customer is
+// in, or "" when there is none.
+func customerOwner(db pg.DBI, customerXId string) (string, error) {
+	assignment := entity.ClientCustomer{}
+	err := db.Model(&assignment).
+		Where("customer_xid = ?", customerXId).
+		Select()
+	if err == pg.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return assignment.ClientID, nil
+}
+
+func checkScope(owner string, clientID string) error {
+	if owner != clientID {
+		return ErrCustomerNotInScope
+	}
+	return nil
+}
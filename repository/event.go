@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+	"github.com/go-pg/pg/v10"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+)
+
+var errListenerClosed = errors.New("event listener closed")
+
+// EventChannel is the Postgres NOTIFY channel announcing new events. The
+// payload is the customer_xid; listeners read the events from the log.
+const EventChannel = "wallet_events"
+
+// EventRepoInterface reads the append-only log of wallet changes. Events are
+// appended by the wallet methods themselves, in the same transaction as the
+// change they describe.
+type EventRepoInterface interface {
+	FetchEvents(customerXId string, afterID int64, limit int) ([]entity.WalletEvent, error)
+	LatestEventID(customerXId string) (int64, error)
+	ListenEvents(ctx context.Context, notify func(customerXId string)) error
+}
+
+// FetchEvents returns up to limit of the customer's events with an ID above
+// afterID, oldest first.
+func (pdb *miniWalletDatabase) FetchEvents(customerXId string, afterID int64, limit int) ([]entity.WalletEvent, error) {
+	events := []entity.WalletEvent{}
+	err := pdb.dbConn.Model(&events).
+		Where("customer_xid = ?", customerXId).
+		Where("id > ?", afterID).
+		Order("id ASC").
+		Limit(limit).
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+// LatestEventID returns the ID of the customer's last event, 0 if there is none.
+func (pdb *miniWalletDatabase) LatestEventID(customerXId string) (int64, error) {
+	var id int64
+	err := pdb.dbConn.Model((*entity.WalletEvent)(nil)).
+		ColumnExpr("COALESCE(MAX(id), 0)").
+		Where("customer_xid = ?", customerXId).
+		Select(&id)
+	return id, err
+}
+
+// ListenEvents calls notify with the customer of every event committed by
+// any instance until ctx is done. Notifications sent while the listener
+// reconnects are lost, so callers should also look for events now and then.
+func (pdb *miniWalletDatabase) ListenEvents(ctx context.Context, notify func(customerXId string)) error {
+	ln := pdb.dbConn.Listen(ctx)
+	defer ln.Close()
+	// DB.Listen drops the error of the first LISTEN, so listen again here.
+	if err := ln.Listen(ctx, EventChannel); err != nil {
+		return err
+	}
+
+	notifications := ln.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case n, ok := <-notifications:
+			if !ok {
+				return errListenerClosed
+			}
+			notify(n.Payload)
+		}
+	}
+}
+
+// publishEvent appends the event to the log, enqueues it for the customer's
+// webhooks and notifies the listeners on EventChannel, which Postgres only
+// does once the transaction commits. Call it with the transaction of the
+// wallet change.
+func publishEvent(db pg.DBI, wallet *entity.Wallet, eventType string, data interface{}) error {
+	event, err := buildEvent(wallet, eventType, data)
+	if err != nil {
+		return err
+	}
+	_, err = db.Model(&event).Insert()
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("SELECT pg_notify(?, ?)", EventChannel, wallet.OwnedBy)
+	if err != nil {
+		return err
+	}
+	return enqueueWebhooks(db, wallet.OwnedBy, eventType, data)
+}
+
+func buildEvent(wallet *entity.Wallet, eventType string, data interface{}) (entity.WalletEvent, error) {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return entity.WalletEvent{}, err
+	}
+	return entity.WalletEvent{
+		CustomerXId: wallet.OwnedBy,
+		WalletID: wallet.ID,
+		Type: eventType,
+		Data: payload,
+		CreatedAt: time.Now(),
+	}, nil
+}
@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"github.com/go-pg/pg/v10"
+	"github.com/Sigaeasu/go-mwe/models"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrHoldNotFound = apperror.New(apperror.CodeHoldNotFound, "Withdrawal not found")
+	ErrHoldNotPending = apperror.New(apperror.CodeHoldNotPending, "Withdrawal is not pending")
+	ErrHoldExpired = apperror.New(apperror.CodeHoldExpired, "Withdrawal hold has expired")
+)
+
+// HoldWithdrawal reserves the amount for a pending withdrawal that expires at
+// expiresAt. The available balance drops at once; the balance and the ledger
+// only move when the hold is captured.
+func (pdb *miniWalletDatabase) HoldWithdrawal(params models.ParamsWallet, expiresAt time.Time) (*entity.Transaction, error) {
+	var transaction *entity.Transaction
+	err := pdb.dbConn.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		wallet, err := lockMiniWallet(tx, params.CreatedBy)
+		if err != nil {
+			return err
+		}
+		if err := CheckActive(wallet); err != nil {
+			return err
+		}
+		err = checkLimits(tx, pdb.limits, params, entity.TransactionTypeWithdraw)
+		if err != nil {
+			return err
+		}
+		err = holdBalance(tx, wallet.ID, params.Currency, params.Amount)
+		if err != nil {
+			return err
+		}
+		hold := buildTransaction(params, entity.TransactionTypeWithdraw, entity.TransactionStatusPending)
+		hold.ExpiresAt = expiresAt
+		transaction, err = insertTransaction(tx, hold)
+		if err != nil {
+			return err
+		}
+		err = publishEvent(tx, wallet, entity.EventWithdrawalHeld, models.NewTransactionEventData(*transaction))
+		if err != nil {
+			return err
+		}
+		return saveResponse(tx, params.Respond, *transaction)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// CaptureWithdrawal turns a pending withdrawal into a debit of the balance
+// and books it in the ledger like an immediate withdrawal. Holds of a wallet
+// that is not active can only be voided or expire.
+func (pdb *miniWalletDatabase) CaptureWithdrawal(customerXId string, transactionID string) (*entity.Transaction, error) {
+	var hold *entity.Transaction
+	err := pdb.dbConn.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		wallet, err := lockMiniWallet(tx, customerXId)
+		if err != nil {
+			return err
+		}
+		if err := CheckActive(wallet); err != nil {
+			return err
+		}
+		hold, err = lockHold(tx, customerXId, transactionID)
+		if err != nil {
+			return err
+		}
+		if !hold.ExpiresAt.After(time.Now()) {
+			return ErrHoldExpired
+		}
+		// held goes first so the balance never drops below it.
+		err = changeHeld(tx, wallet.ID, hold.Currency, -hold.Amount)
+		if err != nil {
+			return err
+		}
+		err = changeBalance(tx, wallet.ID, hold.Currency, -hold.Amount)
+		if err != nil {
+			return err
+		}
+		err = setTransactionStatus(tx, hold, entity.TransactionStatusCaptured)
+		if err != nil {
+			return err
+		}
+		err = postJournal(tx, "withdraw", hold.ID, hold.Currency,
+			walletLeg(wallet.ID, -hold.Amount),
+			systemLeg(AccountPayout, hold.Amount),
+		)
+		if err != nil {
+			return err
+		}
+		return publishEvent(tx, wallet, entity.EventWithdrawalSucceeded, models.NewTransactionEventData(*hold))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// VoidWithdrawal releases the funds of a pending withdrawal.
+func (pdb *miniWalletDatabase) VoidWithdrawal(customerXId string, transactionID string) (*entity.Transaction, error) {
+	return pdb.releaseHold(customerXId, transactionID, entity.TransactionStatusVoided)
+}
+
+// ExpireHolds releases every pending withdrawal whose hold ended before now
+// and returns how many were expired. Each hold is released in its own
+// transaction so one failure does not block the rest.
+func (pdb *miniWalletDatabase) ExpireHolds(now time.Time) (int, error) {
+	var stale []entity.Transaction
+	err := pdb.dbConn.Model(&stale).
+		Column("id", "created_by").
+		Where("status = ?", entity.TransactionStatusPending).
+		Where("expires_at <= ?", now).
+		Select()
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, t := range stale {
+		_, err := pdb.releaseHold(t.CreatedBy, t.ID, entity.TransactionStatusExpired)
+		if err == ErrHoldNotPending {
+			// Captured or voided since the select.
+			continue
+		}
+		if err != nil {
+			logrus.Errorf("Fail to expire withdrawal %s: %v", t.ID, err)
+			continue
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+// releaseHold gives the held funds back and moves the hold to status. It
+// works whatever the wallet status, so holds of a frozen wallet still expire.
+func (pdb *miniWalletDatabase) releaseHold(customerXId string, transactionID string, status string) (*entity.Transaction, error) {
+	var hold *entity.Transaction
+	err := pdb.dbConn.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		wallet, err := lockMiniWallet(tx, customerXId)
+		if err != nil {
+			return err
+		}
+		hold, err = lockHold(tx, customerXId, transactionID)
+		if err != nil {
+			return err
+		}
+		err = changeHeld(tx, wallet.ID, hold.Currency, -hold.Amount)
+		if err != nil {
+			return err
+		}
+		err = setTransactionStatus(tx, hold, status)
+		if err != nil {
+			return err
+		}
+		return publishEvent(tx, wallet, releaseEvent(status), models.NewTransactionEventData(*hold))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// releaseEvent is the event announcing a hold released with status.
+func releaseEvent(status string) string {
+	if status == entity.TransactionStatusExpired {
+		return entity.EventWithdrawalExpired
+	}
+	return entity.EventWithdrawalVoided
+}
+
+// lockHold selects one of the customer's pending withdrawals with FOR UPDATE.
+func lockHold(tx *pg.Tx, customerXId string, transactionID string) (*entity.Transaction, error) {
+	var hold entity.Transaction
+	err := tx.Model(&hold).
+		Where("id = ?", transactionID).
+		Where("created_by = ?", customerXId).
+		Where("type = ?", entity.TransactionTypeWithdraw).
+		For("UPDATE").
+		Select()
+	if err != nil {
+		if err == pg.ErrNoRows {
+			return nil, ErrHoldNotFound
+		}
+		return nil, err
+	}
+	if hold.Status != entity.TransactionStatusPending {
+		return nil, ErrHoldNotPending
+	}
+	return &hold, nil
+}
+
+func setTransactionStatus(tx *pg.Tx, transaction *entity.Transaction, status string) error {
+	transaction.Status = status
+	_, err := tx.Model(transaction).
+		Column("status").
+		WherePK().
+		Update()
+	return err
+}
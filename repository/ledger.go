@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"github.com/go-pg/pg/v10"
+	"github.com/Sigaeasu/go-mwe/models"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/models/money"
+)
+
+// System accounts on the other side of money entering or leaving the wallets.
+const (
+	AccountFunding = "system:funding"
+	AccountPayout = "system:payout"
+	AccountAdjustments = "system:adjustments"
+)
+
+var (
+	ErrUnbalancedEntry = errors.New("Journal entry does not balance")
+	ErrLedgerMismatch = errors.New("Wallet balance does not match its ledger account")
+)
+
+// ledgerLeg is one side of a journal entry before its account is resolved:
+// either a wallet or a system account code.
+type ledgerLeg struct {
+	walletID string
+	code string
+	amount money.Amount
+}
+
+func walletLeg(walletID string, amount money.Amount) ledgerLeg {
+	return ledgerLeg{walletID: walletID, amount: amount}
+}
+
+func systemLeg(code string, amount money.Amount) ledgerLeg {
+	return ledgerLeg{code: code, amount: amount}
+}
+
+// postJournal books a journal entry whose legs must sum to zero. Wallet
+// accounts are checked against wallet_balances afterwards, so it has to run
+// after the balances were changed in the same transaction.
+func postJournal(tx *pg.Tx, description string, transactionID string, currency string, legs ...ledgerLeg) error {
+	var sum money.Amount
+	for _, leg := range legs {
+		sum += leg.amount
+	}
+	if sum != 0 || len(legs) < 2 {
+		return ErrUnbalancedEntry
+	}
+
+	entry := entity.JournalEntry{
+		TransactionID: transactionID,
+		Description: description,
+		Currency: currency,
+		CreatedAt: time.Now(),
+	}
+	_, err := tx.Model(&entry).Returning("*").Insert()
+	if err != nil {
+		return err
+	}
+
+	for _, leg := range legs {
+		account, err := ledgerAccount(tx, leg, currency)
+		if err != nil {
+			return err
+		}
+		posting := entity.Posting{
+			JournalEntryID: entry.ID,
+			AccountID: account.ID,
+			Amount: leg.amount,
+			CreatedAt: entry.CreatedAt,
+		}
+		_, err = tx.Model(&posting).Insert()
+		if err != nil {
+			return err
+		}
+		_, err = tx.Model(account).
+			WherePK().
+			Set("balance = balance + ?", leg.amount).
+			Returning("balance").
+			Update()
+		if err != nil {
+			return err
+		}
+		if account.Type == entity.AccountTypeWallet {
+			if err := checkWalletAccount(tx, account); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ledgerAccount returns the account of a leg, opening it on first use.
+func ledgerAccount(tx *pg.Tx, leg ledgerLeg, currency string) (*entity.LedgerAccount, error) {
+	account := entity.LedgerAccount{
+		Code: leg.code,
+		Type: entity.AccountTypeSystem,
+		Currency: currency,
+		CreatedAt: time.Now(),
+	}
+	if leg.walletID != "" {
+		account.Code = "wallet:" + leg.walletID
+		account.Type = entity.AccountTypeWallet
+		account.WalletID = leg.walletID
+	}
+	_, err := tx.Model(&account).
+		OnConflict("(code, currency) DO NOTHING").
+		Insert()
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Model(&account).
+		Where("code = ?", account.Code).
+		Where("currency = ?", currency).
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return &account, nil
+}
+
+func checkWalletAccount(tx *pg.Tx, account *entity.LedgerAccount) error {
+	balance := entity.WalletBalance{
+		WalletID: account.WalletID,
+		Currency: account.Currency,
+	}
+	err := tx.Model(&balance).WherePK().Select()
+	if err != nil && err != pg.ErrNoRows {
+		return err
+	}
+	if balance.Balance != account.Balance {
+		return fmt.Errorf("%w: wallet %s %s", ErrLedgerMismatch, account.WalletID, account.Currency)
+	}
+	return nil
+}
+
+// VerifyLedger compares every wallet balance with the sum of the postings of
+// its ledger account and returns the ones that differ.
+func (pdb *miniWalletDatabase) VerifyLedger() ([]models.LedgerMismatch, error) {
+	mismatches := []models.LedgerMismatch{}
+	_, err := pdb.dbConn.Query(&mismatches, `
+		SELECT w.owned_by, b.wallet_id, b.currency, b.balance,
+			COALESCE(SUM(p.amount), 0) AS ledger_balance
+		FROM wallet_balances b
+		JOIN mini_wallets w ON w.id = b.wallet_id
+		LEFT JOIN ledger_accounts a ON a.wallet_id = b.wallet_id AND a.currency = b.currency
+		LEFT JOIN postings p ON p.account_id = a.id
+		GROUP BY w.owned_by, b.wallet_id, b.currency, b.balance
+		HAVING b.balance <> COALESCE(SUM(p.amount), 0)
+		ORDER BY b.wallet_id, b.currency`)
+	if err != nil {
+		return nil, err
+	}
+	return mismatches, nil
+}
@@ -0,0 +1,265 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"github.com/go-pg/pg/v10"
+	"github.com/Sigaeasu/go-mwe/models"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/models/money"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
+)
+
+var (
+	ErrWalletFrozen = apperror.New(apperror.CodeWalletFrozen, "Wallet frozen")
+	ErrAlreadyFrozen = apperror.New(apperror.CodeWalletAlreadyFrozen, "Already frozen")
+	ErrWalletClosed = apperror.New(apperror.CodeWalletClosed, "Wallet closed")
+	ErrInvalidTransition = apperror.New(apperror.CodeInvalidTransition, "Wallet status cannot be changed that way")
+	ErrPendingWithdrawals = apperror.New(apperror.CodePendingWithdrawals, "Wallet has pending withdrawals")
+	ErrBalanceNotZero = apperror.New(apperror.CodeBalanceNotZero, "Wallet still holds a balance, sweep it to close the wallet")
+)
+
+// walletTransitions lists the states each state may move to. Closed is final.
+var walletTransitions = map[string][]string{
+	entity.WalletStatusActive: {entity.WalletStatusDisabled, entity.WalletStatusFrozen, entity.WalletStatusClosed},
+	entity.WalletStatusDisabled: {entity.WalletStatusActive, entity.WalletStatusFrozen, entity.WalletStatusClosed},
+	entity.WalletStatusFrozen: {entity.WalletStatusActive, entity.WalletStatusDisabled, entity.WalletStatusClosed},
+	entity.WalletStatusClosed: {},
+}
+
+// CheckActive returns the error for using a wallet that is not active. The
+// backends call it under the wallet lock, so a freeze or close that commits
+// first is never ignored.
+func CheckActive(wallet *entity.Wallet) error {
+	switch wallet.Status {
+	case entity.WalletStatusActive:
+		return nil
+	case entity.WalletStatusFrozen:
+		return ErrWalletFrozen
+	case entity.WalletStatusClosed:
+		return ErrWalletClosed
+	}
+	return ErrWalletDisabled
+}
+
+// checkTransition validates a move between lifecycle states. Customers can
+// neither freeze a wallet nor move it out of frozen.
+func checkTransition(from string, to string, actorType string) error {
+	if from == entity.WalletStatusClosed {
+		return ErrWalletClosed
+	}
+	if from == to {
+		switch to {
+		case entity.WalletStatusActive:
+			return ErrAlreadyEnabled
+		case entity.WalletStatusDisabled:
+			return ErrAlreadyDisabled
+		case entity.WalletStatusFrozen:
+			return ErrAlreadyFrozen
+		}
+	}
+	if actorType != entity.ActorAdmin {
+		if from == entity.WalletStatusFrozen {
+			return ErrWalletFrozen
+		}
+		if to == entity.WalletStatusFrozen {
+			return ErrInvalidTransition
+		}
+	}
+	for _, allowed := range walletTransitions[from] {
+		if allowed == to {
+			return nil
+		}
+	}
+	return ErrInvalidTransition
+}
+
+// statusEvent is the event announcing a move to the state.
+func statusEvent(status string) string {
+	switch status {
+	case entity.WalletStatusActive:
+		return entity.EventWalletEnabled
+	case entity.WalletStatusFrozen:
+		return entity.EventWalletFrozen
+	case entity.WalletStatusClosed:
+		return entity.EventWalletClosed
+	}
+	return entity.EventWalletDisabled
+}
+
+func customerTransition(customerXId string, enabled bool) models.ParamsTransition {
+	to := entity.WalletStatusDisabled
+	if enabled {
+		to = entity.WalletStatusActive
+	}
+	return models.ParamsTransition{
+		CustomerXId: customerXId,
+		To: to,
+		ActorType: entity.ActorCustomer,
+		Actor: customerXId,
+	}
+}
+
+func (pdb *miniWalletDatabase) TransitionWallet(params models.ParamsTransition) (*entity.Wallet, error) {
+	return pdb.transition(params, nil)
+}
+
+// transition moves the wallet to params.To under its row lock, records who
+// did it and why and, when action is set, writes it to the admin audit log in
+// the same transaction.
+func (pdb *miniWalletDatabase) transition(params models.ParamsTransition, action *entity.AdminAction) (*entity.Wallet, error) {
+	if params.CustomerXId == "" {
+		return nil, ErrEmptyCustomer
+	}
+
+	err := pdb.dbConn.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		wallet, err := lockMiniWallet(tx, params.CustomerXId)
+		if err != nil {
+			return err
+		}
+		from := wallet.Status
+		if err := checkTransition(from, params.To, params.ActorType); err != nil {
+			return err
+		}
+		if params.To == entity.WalletStatusClosed {
+			if err := emptyWallet(tx, wallet, params.Sweep); err != nil {
+				return err
+			}
+		}
+
+		changedAt := time.Now()
+		wallet.Status = params.To
+		wallet.IsEnabled = params.To == entity.WalletStatusActive
+		query := tx.Model(wallet).
+			WherePK().
+			Set("status = ?", wallet.Status).
+			Set("is_enabled = ?", wallet.IsEnabled)
+		if wallet.IsEnabled {
+			query = query.Set("enabled_at = ?", changedAt)
+		} else if from == entity.WalletStatusActive {
+			query = query.Set("disabled_at = ?", changedAt)
+		}
+		if _, err := query.Update(); err != nil {
+			return err
+		}
+
+		_, err = tx.Model(buildTransition(wallet, from, params, changedAt)).Insert()
+		if err != nil {
+			return err
+		}
+		if action != nil {
+			if err := insertAdminAction(tx, *action); err != nil {
+				return err
+			}
+		}
+		return publishEvent(tx, wallet, statusEvent(wallet.Status), walletEventData(wallet, changedAt))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pdb.FetchMiniWalletByID(params.CustomerXId)
+}
+
+// FetchWalletTransitions returns the lifecycle history of the wallet, oldest
+// first.
+func (pdb *miniWalletDatabase) FetchWalletTransitions(customerXId string) ([]entity.WalletTransition, error) {
+	wallet, err := pdb.FetchMiniWalletByID(customerXId)
+	if err != nil {
+		return nil, err
+	}
+	if wallet.ID == "" {
+		return nil, ErrCustomerNotFound
+	}
+	transitions := []entity.WalletTransition{}
+	err = pdb.dbConn.Model(&transitions).
+		Where("wallet_id = ?", wallet.ID).
+		Order("id ASC").
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return transitions, nil
+}
+
+// emptyWallet makes sure nothing is left in the wallet before it is closed.
+// With sweep, every remaining balance is paid out by a withdrawal; without
+// it, any balance refuses the closure. Pending withdrawals always do.
+func emptyWallet(tx *pg.Tx, wallet *entity.Wallet, sweep bool) error {
+	var balances []entity.WalletBalance
+	err := tx.Model(&balances).
+		Where("wallet_id = ?", wallet.ID).
+		Order("currency ASC").
+		For("UPDATE").
+		Select()
+	if err != nil {
+		return err
+	}
+	if err := checkEmptyable(balances, sweep); err != nil {
+		return err
+	}
+
+	for _, b := range balances {
+		if b.Balance == 0 {
+			continue
+		}
+		err = changeBalance(tx, wallet.ID, b.Currency, -b.Balance)
+		if err != nil {
+			return err
+		}
+		sweep := buildSweep(wallet, b.Currency, b.Balance)
+		_, err = tx.QueryOne(pg.Scan(&sweep.ReferenceID), "SELECT gen_random_uuid()")
+		if err != nil {
+			return err
+		}
+		transaction, err := insertTransaction(tx, sweep)
+		if err != nil {
+			return err
+		}
+		err = postJournal(tx, entity.TransactionTypeWithdraw, transaction.ID, b.Currency,
+			walletLeg(wallet.ID, -b.Balance),
+			systemLeg(AccountPayout, b.Balance),
+		)
+		if err != nil {
+			return err
+		}
+		err = publishEvent(tx, wallet, entity.EventWithdrawalSucceeded, models.NewTransactionEventData(*transaction))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkEmptyable(balances []entity.WalletBalance, sweep bool) error {
+	for _, b := range balances {
+		if b.Held > 0 {
+			return ErrPendingWithdrawals
+		}
+		if b.Balance != 0 && !sweep {
+			return ErrBalanceNotZero
+		}
+	}
+	return nil
+}
+
+// buildSweep is the withdrawal that pays out what is left of a closing
+// wallet. It is not subject to the limits policy.
+func buildSweep(wallet *entity.Wallet, currency string, amount money.Amount) entity.Transaction {
+	return buildTransaction(models.ParamsWallet{
+		Amount: amount,
+		Currency: currency,
+		CreatedBy: wallet.OwnedBy,
+	}, entity.TransactionTypeWithdraw, entity.TransactionStatusSuccess)
+}
+
+func buildTransition(wallet *entity.Wallet, from string, params models.ParamsTransition, at time.Time) *entity.WalletTransition {
+	return &entity.WalletTransition{
+		WalletID: wallet.ID,
+		FromStatus: from,
+		ToStatus: params.To,
+		ActorType: params.ActorType,
+		Actor: params.Actor,
+		Reason: params.Reason,
+		CreatedAt: at,
+	}
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"time"
+	"github.com/go-pg/pg/v10"
+	"github.com/Sigaeasu/go-mwe/limits"
+	"github.com/Sigaeasu/go-mwe/models"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+)
+
+// checkLimits enforces the limits policy on a transaction about to be
+// written. Pending withdrawals count like booked ones, and everything the
+// customer moves out of the wallet counts against the withdraw rule, see
+// usageTypes. It must run after the wallet row is locked so concurrent
+// requests of the same wallet count each other.
+func checkLimits(tx *pg.Tx, policy limits.Policy, params models.ParamsWallet, transactionType string) error {
+	rule, ok := policy.Rule(transactionType, params.Currency)
+	if !ok {
+		return nil
+	}
+
+	windows := limits.WindowsAt(time.Now())
+	var usage limits.Usage
+	_, err := tx.QueryOne(&usage, `
+		SELECT
+			COALESCE(SUM(ABS(amount)) FILTER (WHERE created_at >= ?), 0) AS daily,
+			COALESCE(SUM(ABS(amount)) FILTER (WHERE created_at >= ?), 0) AS monthly,
+			COUNT(*) FILTER (WHERE created_at >= ?) AS hourly_count
+		FROM transactions
+		WHERE created_by = ? AND type IN (?) AND (type <> ? OR amount < 0) AND currency = ? AND status IN (?, ?, ?) AND created_at >= ?`,
+		windows.Day, windows.Month, windows.Hour,
+		params.CreatedBy, pg.In(usageTypes(transactionType)), entity.TransactionTypeReversal, params.Currency,
+		entity.TransactionStatusSuccess, entity.TransactionStatusPending, entity.TransactionStatusCaptured,
+		windows.Earliest(),
+	)
+	if err != nil {
+		return err
+	}
+	return rule.Check(params.Amount, usage, params.Currency)
+}
+
+// usageTypes lists the transaction types whose totals use up the rule of
+// transactionType. Transfers out and reversals of deposits take money out
+// like a withdrawal, so they share its rule and cannot be used to get
+// around it. Only reversals that debit the wallet count.
+func usageTypes(transactionType string) []string {
+	if transactionType == entity.TransactionTypeWithdraw {
+		return []string{entity.TransactionTypeWithdraw, entity.TransactionTypeTransferOut, entity.TransactionTypeReversal}
+	}
+	return []string{transactionType}
+}
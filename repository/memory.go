@@ -0,0 +1,1318 @@
+package repository
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"github.com/Sigaeasu/go-mwe/limits"
+	"github.com/Sigaeasu/go-mwe/models"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/models/money"
+	"github.com/sirupsen/logrus"
+)
+
+// miniWalletMemory keeps everything in process memory. A single mutex plays
+// the role of the row locks and database transactions of miniWalletDatabase,
+// so every method is atomic and sees the same rules as the Postgres backend.
+type miniWalletMemory struct {
+	mutex sync.Mutex
+	wallets map[string]*entity.Wallet
+	balances map[string]map[string]money.Amount
+	held map[string]map[string]money.Amount
+	transactions []entity.Transaction
+	responses map[string]entity.IdempotentResponse
+	accounts map[string]*entity.LedgerAccount
+	postings []entity.Posting
+	webhooks []entity.WebhookSubscription
+	deliveries []entity.WebhookDelivery
+	events []entity.WalletEvent
+	adminActions []entity.AdminAction
+	transitions []entity.WalletTransition
+	audit []entity.AuditEntry
+	refreshTokens map[string]*entity.RefreshToken
+	revokedTokens map[string]entity.RevokedToken
+	clients map[string]*entity.APIClient
+	clientCustomers map[string]entity.ClientCustomer
+	listeners map[int]func(customerXId string)
+	nextListener int
+	limits limits.Policy
+}
+
+func MiniWalletMemoryRepository(policy limits.Policy) MiniWalletRepoInterface {
+	return &miniWalletMemory{
+		limits: policy,
+		wallets: map[string]*entity.Wallet{},
+		balances: map[string]map[string]money.Amount{},
+		held: map[string]map[string]money.Amount{},
+		responses: map[string]entity.IdempotentResponse{},
+		accounts: map[string]*entity.LedgerAccount{},
+		refreshTokens: map[string]*entity.RefreshToken{},
+		revokedTokens: map[string]entity.RevokedToken{},
+		clients: map[string]*entity.APIClient{},
+		clientCustomers: map[string]entity.ClientCustomer{},
+		listeners: map[int]func(customerXId string){},
+	}
+}
+
+func (mdb *miniWalletMemory) CreateMiniWallet(customerXId string) (*entity.Wallet, error) {
+	if customerXId == "" {
+		return nil, ErrEmptyCustomer
+	}
+
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+	if _, ok := mdb.wallets[customerXId]; !ok {
+		wallet := &entity.Wallet{
+			ID: newUUID(),
+			OwnedBy: customerXId,
+			Status: entity.WalletStatusDisabled,
+		}
+		mdb.wallets[customerXId] = wallet
+		mdb.publishEvent(wallet, entity.EventWalletCreated, walletEventData(wallet, now()))
+	}
+	return mdb.wallet(customerXId), nil
+}
+
+func (mdb *miniWalletMemory) FetchMiniWalletByID(customerXId string) (*entity.Wallet, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+	return mdb.wallet(customerXId), nil
+}
+
+func (mdb *miniWalletMemory) FetchTransactions(filter models.TransactionFilter) ([]entity.Transaction, string, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+
+	transactions := []entity.Transaction{}
+	for _, t := range mdb.transactions {
+		if t.CreatedBy != filter.CreatedBy ||
+			(filter.After != nil && !transactionAfter(t, *filter.After)) ||
+			(filter.Type != "" && t.Type != filter.Type) ||
+			(filter.Status != "" && t.Status != filter.Status) ||
+			(filter.Currency != "" && t.Currency != filter.Currency) ||
+			(!filter.From.IsZero() && t.CreatedAt.Before(filter.From)) ||
+			(!filter.To.IsZero() && !t.CreatedAt.Before(filter.To)) ||
+			(filter.MinAmount != nil && t.Amount < *filter.MinAmount) ||
+			(filter.MaxAmount != nil && t.Amount > *filter.MaxAmount) {
+			continue
+		}
+		transactions = append(transactions, t)
+	}
+	sort.Slice(transactions, func(i, j int) bool {
+		return transactionAfter(transactions[j], models.TransactionCursor{
+			CreatedAt: transactions[i].CreatedAt,
+			ID: transactions[i].ID,
+		})
+	})
+	if len(transactions) > filter.Limit+1 {
+		transactions = transactions[:filter.Limit+1]
+	}
+	page, next := pageTransactions(transactions, filter.Limit)
+	return page, next, nil
+}
+
+func (mdb *miniWalletMemory) ChangeStatusOnMiniWallet(customerXId string, status bool) (*entity.Wallet, error) {
+	return mdb.TransitionWallet(customerTransition(customerXId, status))
+}
+
+func (mdb *miniWalletMemory) TransitionWallet(params models.ParamsTransition) (*entity.Wallet, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+	return mdb.transition(params, nil)
+}
+
+func (mdb *miniWalletMemory) transition(params models.ParamsTransition, action *entity.AdminAction) (*entity.Wallet, error) {
+	if params.CustomerXId == "" {
+		return nil, ErrEmptyCustomer
+	}
+
+	wallet, ok := mdb.wallets[params.CustomerXId]
+	if !ok {
+		return nil, ErrCustomerNotFound
+	}
+	from := wallet.Status
+	if err := checkTransition(from, params.To, params.ActorType); err != nil {
+		return nil, err
+	}
+	if params.To == entity.WalletStatusClosed {
+		if err := mdb.emptyWallet(wallet, params.Sweep); err != nil {
+			return nil, err
+		}
+	}
+
+	changedAt := now()
+	wallet.Status = params.To
+	wallet.IsEnabled = params.To == entity.WalletStatusActive
+	if wallet.IsEnabled {
+		wallet.EnabledAt = changedAt
+	} else if from == entity.WalletStatusActive {
+		wallet.DisabledAt = changedAt
+	}
+	transition := buildTransition(wallet, from, params, changedAt)
+	transition.ID = int64(len(mdb.transitions)) + 1
+	mdb.transitions = append(mdb.transitions, *transition)
+	if action != nil {
+		mdb.insertAdminAction(*action)
+	}
+	mdb.publishEvent(wallet, statusEvent(wallet.Status), walletEventData(wallet, changedAt))
+	return mdb.wallet(params.CustomerXId), nil
+}
+
+func (mdb *miniWalletMemory) emptyWallet(wallet *entity.Wallet, sweep bool) error {
+	current := mdb.wallet(wallet.OwnedBy)
+	balances := make([]entity.WalletBalance, 0, len(current.Balances))
+	for _, b := range current.Balances {
+		balances = append(balances, *b)
+	}
+	if err := checkEmptyable(balances, sweep); err != nil {
+		return err
+	}
+
+	for _, b := range balances {
+		if b.Balance == 0 {
+			continue
+		}
+		mdb.changeBalance(wallet.ID, b.Currency, -b.Balance)
+		sweep := buildSweep(wallet, b.Currency, b.Balance)
+		sweep.ReferenceID = newUUID()
+		transaction := mdb.insertTransaction(sweep)
+		mdb.postJournal(b.Currency,
+			walletLeg(wallet.ID, -b.Balance),
+			systemLeg(AccountPayout, b.Balance),
+		)
+		mdb.publishEvent(wallet, entity.EventWithdrawalSucceeded, models.NewTransactionEventData(transaction))
+	}
+	return nil
+}
+
+func (mdb *miniWalletMemory) FetchWalletTransitions(customerXId string) ([]entity.WalletTransition, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+
+	wallet, ok := mdb.wallets[customerXId]
+	if !ok {
+		return nil, ErrCustomerNotFound
+	}
+	transitions := []entity.WalletTransition{}
+	for _, t := range mdb.transitions {
+		if t.WalletID == wallet.ID {
+			transitions = append(transitions, t)
+		}
+	}
+	return transitions, nil
+}
+
+func (mdb *miniWalletMemory) Deposit(params models.ParamsWallet) (*entity.Transaction, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+
+	wallet, ok := mdb.wallets[params.CreatedBy]
+	if !ok {
+		return nil, ErrCustomerNotFound
+	}
+	if err := CheckActive(wallet); err != nil {
+		return nil, err
+	}
+	if err := mdb.checkLimits(params, entity.TransactionTypeDeposit); err != nil {
+		return nil, err
+	}
+	if mdb.referenceTaken(params.ReferenceID) {
+		return nil, ErrDuplicateReference
+	}
+
+	mdb.changeBalance(wallet.ID, params.Currency, params.Amount)
+	transaction := mdb.insertTransaction(buildTransaction(params, entity.TransactionTypeDeposit, "success"))
+	mdb.postJournal(params.Currency,
+		systemLeg(AccountFunding, -params.Amount),
+		walletLeg(wallet.ID, params.Amount),
+	)
+	mdb.publishEvent(wallet, entity.EventDepositSucceeded, models.NewTransactionEventData(transaction))
+	if err := mdb.saveResponse(params.Respond, transaction); err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+func (mdb *miniWalletMemory) Withdraw(params models.ParamsWallet) (*entity.Transaction, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+
+	wallet, ok := mdb.wallets[params.CreatedBy]
+	if !ok {
+		return nil, ErrCustomerNotFound
+	}
+	if err := CheckActive(wallet); err != nil {
+		return nil, err
+	}
+	if err := mdb.checkLimits(params, entity.TransactionTypeWithdraw); err != nil {
+		return nil, err
+	}
+	if mdb.available(wallet.ID, params.Currency) < params.Amount {
+		return nil, ErrInsufficientBalance
+	}
+	if mdb.referenceTaken(params.ReferenceID) {
+		return nil, ErrDuplicateReference
+	}
+
+	mdb.changeBalance(wallet.ID, params.Currency, -params.Amount)
+	transaction := mdb.insertTransaction(buildTransaction(params, entity.TransactionTypeWithdraw, "success"))
+	mdb.postJournal(params.Currency,
+		walletLeg(wallet.ID, -params.Amount),
+		systemLeg(AccountPayout, params.Amount),
+	)
+	mdb.publishEvent(wallet, entity.EventWithdrawalSucceeded, models.NewTransactionEventData(transaction))
+	if err := mdb.saveResponse(params.Respond, transaction); err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+func (mdb *miniWalletMemory) Transfer(params models.ParamsTransfer) (*models.TransferResult, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+
+	var target *entity.Wallet
+	for _, w := range mdb.wallets {
+		if (params.ToCustomerXId != "" && w.OwnedBy == params.ToCustomerXId) ||
+			(params.ToCustomerXId == "" && w.ID == params.ToWalletID) {
+			target = w
+		}
+	}
+	if target == nil {
+		return nil, ErrTargetNotFound
+	}
+	if target.OwnedBy == params.CreatedBy {
+		return nil, ErrSelfTransfer
+	}
+	source, ok := mdb.wallets[params.CreatedBy]
+	if !ok {
+		return nil, ErrCustomerNotFound
+	}
+	if err := CheckActive(source); err != nil {
+		return nil, err
+	}
+	if target.Status != entity.WalletStatusActive {
+		return nil, ErrTargetDisabled
+	}
+	if err := mdb.checkLimits(transferLimitParams(params), entity.TransactionTypeWithdraw); err != nil {
+		return nil, err
+	}
+	if mdb.available(source.ID, params.Currency) < params.Amount {
+		return nil, ErrInsufficientBalance
+	}
+	if mdb.referenceTaken(params.ReferenceID) {
+		return nil, ErrDuplicateReference
+	}
+
+	mdb.changeBalance(source.ID, params.Currency, -params.Amount)
+	mdb.changeBalance(target.ID, params.Currency, params.Amount)
+
+	result := models.TransferResult{
+		TransferID: newUUID(),
+	}
+	debit := buildTransaction(models.ParamsWallet{
+		Amount: params.Amount,
+		Currency: params.Currency,
+		ReferenceID: params.ReferenceID,
+		CreatedBy: source.OwnedBy,
+	}, entity.TransactionTypeTransferOut, "success")
+	debit.TransferID = result.TransferID
+	debit = mdb.insertTransaction(debit)
+	result.Debit = &debit
+
+	credit := buildTransaction(models.ParamsWallet{
+		Amount: params.Amount,
+		Currency: params.Currency,
+		ReferenceID: newUUID(),
+		CreatedBy: target.OwnedBy,
+	}, entity.TransactionTypeTransferIn, "success")
+	credit.TransferID = result.TransferID
+	credit = mdb.insertTransaction(credit)
+	result.Credit = &credit
+
+	mdb.postJournal(params.Currency,
+		walletLeg(source.ID, -params.Amount),
+		walletLeg(target.ID, params.Amount),
+	)
+	mdb.publishEvent(source, entity.EventTransferSent, models.NewTransactionEventData(debit))
+	mdb.publishEvent(target, entity.EventTransferReceived, models.NewTransactionEventData(credit))
+	if params.Respond != nil {
+		response, err := params.Respond(result)
+		if err != nil {
+			return nil, err
+		}
+		mdb.storeResponse(*response)
+	}
+	return &result, nil
+}
+
+func (mdb *miniWalletMemory) HoldWithdrawal(params models.ParamsWallet, expiresAt time.Time) (*entity.Transaction, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+
+	wallet, ok := mdb.wallets[params.CreatedBy]
+	if !ok {
+		return nil, ErrCustomerNotFound
+	}
+	if err := CheckActive(wallet); err != nil {
+		return nil, err
+	}
+	if err := mdb.checkLimits(params, entity.TransactionTypeWithdraw); err != nil {
+		return nil, err
+	}
+	if mdb.available(wallet.ID, params.Currency) < params.Amount {
+		return nil, ErrInsufficientBalance
+	}
+	if mdb.referenceTaken(params.ReferenceID) {
+		return nil, ErrDuplicateReference
+	}
+
+	mdb.changeHeld(wallet.ID, params.Currency, params.Amount)
+	hold := buildTransaction(params, entity.TransactionTypeWithdraw, entity.TransactionStatusPending)
+	hold.ExpiresAt = expiresAt
+	transaction := mdb.insertTransaction(hold)
+	mdb.publishEvent(wallet, entity.EventWithdrawalHeld, models.NewTransactionEventData(transaction))
+	if err := mdb.saveResponse(params.Respond, transaction); err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+func (mdb *miniWalletMemory) CaptureWithdrawal(customerXId string, transactionID string) (*entity.Transaction, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+
+	wallet, ok := mdb.wallets[customerXId]
+	if !ok {
+		return nil, ErrCustomerNotFound
+	}
+	if err := CheckActive(wallet); err != nil {
+		return nil, err
+	}
+	hold, err := mdb.pendingHold(customerXId, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	if !hold.ExpiresAt.After(now()) {
+		return nil, ErrHoldExpired
+	}
+
+	mdb.changeHeld(wallet.ID, hold.Currency, -hold.Amount)
+	mdb.changeBalance(wallet.ID, hold.Currency, -hold.Amount)
+	hold.Status = entity.TransactionStatusCaptured
+	mdb.postJournal(hold.Currency,
+		walletLeg(wallet.ID, -hold.Amount),
+		systemLeg(AccountPayout, hold.Amount),
+	)
+	transaction := *hold
+	mdb.publishEvent(wallet, entity.EventWithdrawalSucceeded, models.NewTransactionEventData(transaction))
+	return &transaction, nil
+}
+
+func (mdb *miniWalletMemory) VoidWithdrawal(customerXId string, transactionID string) (*entity.Transaction, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+	return mdb.releaseHold(customerXId, transactionID, entity.TransactionStatusVoided)
+}
+
+func (mdb *miniWalletMemory) ExpireHolds(at time.Time) (int, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+
+	expired := 0
+	for _, t := range mdb.transactions {
+		if t.Status != entity.TransactionStatusPending || t.ExpiresAt.After(at) {
+			continue
+		}
+		if _, err := mdb.releaseHold(t.CreatedBy, t.ID, entity.TransactionStatusExpired); err != nil {
+			logrus.Errorf("Fail to expire withdrawal %s: %v", t.ID, err)
+			continue
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+func (mdb *miniWalletMemory) Reverse(params models.ParamsReversal) (*entity.Transaction, error) {
+	return mdb.reverse(params, nil)
+}
+
+func (mdb *miniWalletMemory) ForceReversal(params models.ParamsReversal, action entity.AdminAction) (*entity.Transaction, error) {
+	return mdb.reverse(params, &action)
+}
+
+func (mdb *miniWalletMemory) reverse(params models.ParamsReversal, action *entity.AdminAction) (*entity.Transaction, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+
+	wallet, ok := mdb.wallets[params.CreatedBy]
+	if !ok {
+		return nil, ErrCustomerNotFound
+	}
+	if err := checkReversible(wallet, action); err != nil {
+		return nil, err
+	}
+	var original *entity.Transaction
+	var reversed money.Amount
+	for _, t := range mdb.transactions {
+		if t.ID == params.TransactionID && t.CreatedBy == params.CreatedBy {
+			found := t
+			original = &found
+		}
+		if t.ReversalOf == params.TransactionID && t.Status == entity.TransactionStatusSuccess {
+			reversed += t.Amount
+		}
+	}
+	if original == nil {
+		return nil, ErrTransactionNotFound
+	}
+	reversal, err := buildReversal(*original, reversed, params, action != nil)
+	if err != nil {
+		return nil, err
+	}
+	if action == nil {
+		if err := mdb.checkLimits(reversalLimitParams(reversal), entity.TransactionTypeWithdraw); err != nil {
+			return nil, err
+		}
+	}
+	if mdb.available(wallet.ID, reversal.Currency) < -reversal.Amount {
+		return nil, ErrInsufficientBalance
+	}
+	if mdb.referenceTaken(params.ReferenceID) {
+		return nil, ErrDuplicateReference
+	}
+
+	mdb.changeBalance(wallet.ID, reversal.Currency, reversal.Amount)
+	transaction := mdb.insertTransaction(reversal)
+	mdb.postJournal(reversal.Currency,
+		walletLeg(wallet.ID, reversal.Amount),
+		systemLeg(reversalAccount(*original), -reversal.Amount),
+	)
+	if action != nil {
+		mdb.insertAdminAction(*action)
+	}
+	mdb.publishEvent(wallet, entity.EventTransactionReversed, models.NewTransactionEventData(transaction))
+	if err := mdb.saveResponse(params.Respond, transaction); err != nil {
+		return nil, err
+	}
+	return &transaction, nil
+}
+
+func (mdb *miniWalletMemory) FailedTransaction(params models.ParamsWallet, transactionType string) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+	transaction := mdb.insertTransaction(buildTransaction(params, transactionType, "failed"))
+	if event := failedEvent(transactionType); event != "" {
+		mdb.enqueueWebhooks(params.CreatedBy, event, models.NewTransactionEventData(transaction))
+	}
+}
+
+func (mdb *miniWalletMemory) FetchIdempotentResponse(referenceID string) (*entity.IdempotentResponse, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+	response, ok := mdb.responses[referenceID]
+	if !ok {
+		return nil, nil
+	}
+	return &response, nil
+}
+
+func (mdb *miniWalletMemory) SaveIdempotentResponse(response entity.IdempotentResponse) error {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+	mdb.storeResponse(response)
+	return nil
+}
+
+// saveResponse stores the response of a booked request while the mutex is
+// still held, like the database backend does in the booking transaction.
+func (mdb *miniWalletMemory) saveResponse(respond models.Respond, transaction entity.Transaction) error {
+	if respond == nil {
+		return nil
+	}
+	response, err := respond(transaction)
+	if err != nil {
+		return err
+	}
+	mdb.storeResponse(*response)
+	return nil
+}
+
+func (mdb *miniWalletMemory) storeResponse(response entity.IdempotentResponse) {
+	if _, ok := mdb.responses[response.ReferenceID]; !ok {
+		response.CreatedAt = now()
+		mdb.responses[response.ReferenceID] = response
+	}
+}
+
+func (mdb *miniWalletMemory) VerifyLedger() ([]models.LedgerMismatch, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+
+	sums := map[string]money.Amount{}
+	for _, p := range mdb.postings {
+		sums[p.AccountID] += p.Amount
+	}
+	mismatches := []models.LedgerMismatch{}
+	for _, w := range mdb.sortedWallets() {
+		for _, currency := range sortedCurrencies(mdb.balances[w.ID]) {
+			balance := mdb.balances[w.ID][currency]
+			var ledgerBalance money.Amount
+			if account, ok := mdb.accounts[accountKey("wallet:"+w.ID, currency)]; ok {
+				ledgerBalance = sums[account.ID]
+			}
+			if balance != ledgerBalance {
+				mismatches = append(mismatches, models.LedgerMismatch{
+					OwnedBy: w.OwnedBy,
+					WalletID: w.ID,
+					Currency: currency,
+					Balance: balance,
+					LedgerBalance: ledgerBalance,
+				})
+			}
+		}
+	}
+	return mismatches, nil
+}
+
+func (mdb *miniWalletMemory) FetchBalanceDrifts() ([]models.BalanceDrift, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+
+	drifts := []models.BalanceDrift{}
+	for _, w := range mdb.sortedWallets() {
+		for _, currency := range sortedCurrencies(mdb.transactionTotals(w.OwnedBy)) {
+			drifts = append(drifts, mdb.balanceDrift(w, currency))
+		}
+	}
+	return drifts, nil
+}
+
+func (mdb *miniWalletMemory) WriteAdjustment(customerXId string, currency string) (*entity.Transaction, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+
+	wallet, ok := mdb.wallets[customerXId]
+	if !ok {
+		return nil, ErrCustomerNotFound
+	}
+	drift := mdb.balanceDrift(wallet, currency)
+	if drift.Drift == 0 {
+		return nil, ErrNoDrift
+	}
+	transaction := mdb.insertTransaction(buildTransaction(models.ParamsWallet{
+		Amount: drift.Drift,
+		Currency: currency,
+		ReferenceID: newUUID(),
+		CreatedBy: customerXId,
+	}, entity.TransactionTypeAdjustment, "success"))
+	return &transaction, nil
+}
+
+func (mdb *miniWalletMemory) CreateWebhook(subscription entity.WebhookSubscription) (*entity.WebhookSubscription, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+	subscription.ID = newUUID()
+	subscription.CreatedAt = now()
+	mdb.webhooks = append(mdb.webhooks, subscription)
+	return &subscription, nil
+}
+
+func (mdb *miniWalletMemory) FetchWebhooks(customerXId string) ([]entity.WebhookSubscription, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+	subscriptions := []entity.WebhookSubscription{}
+	for _, s := range mdb.webhooks {
+		if s.CustomerXId == customerXId && s.DeletedAt.IsZero() {
+			subscriptions = append(subscriptions, s)
+		}
+	}
+	return subscriptions, nil
+}
+
+func (mdb *miniWalletMemory) DeleteWebhook(customerXId string, subscriptionID string) error {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+	subscription := mdb.webhook(customerXId, subscriptionID)
+	if subscription == nil || !subscription.DeletedAt.IsZero() {
+		return ErrWebhookNotFound
+	}
+	subscription.DeletedAt = now()
+	for i := range mdb.deliveries {
+		d := &mdb.deliveries[i]
+		if d.SubscriptionID == subscriptionID && d.Status == entity.WebhookStatusPending {
+			d.Status = entity.WebhookStatusFailed
+			d.LastError = "Subscription deleted"
+		}
+	}
+	return nil
+}
+
+func (mdb *miniWalletMemory) FetchWebhookDeliveries(customerXId string, subscriptionID string, limit int) ([]entity.WebhookDelivery, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+	if mdb.webhook(customerXId, subscriptionID) == nil {
+		return nil, ErrWebhookNotFound
+	}
+	deliveries := []entity.WebhookDelivery{}
+	for i := len(mdb.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if mdb.deliveries[i].SubscriptionID == subscriptionID {
+			deliveries = append(deliveries, mdb.deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
+
+func (mdb *miniWalletMemory) ClaimWebhookDeliveries(at time.Time, leaseUntil time.Time, limit int) ([]models.DueDelivery, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+	var claimed []entity.WebhookDelivery
+	for i := range mdb.deliveries {
+		d := &mdb.deliveries[i]
+		if len(claimed) == limit {
+			break
+		}
+		if d.Status != entity.WebhookStatusPending || d.NextAttemptAt.After(at) {
+			continue
+		}
+		d.NextAttemptAt = leaseUntil
+		claimed = append(claimed, *d)
+	}
+	return dueDeliveries(claimed, mdb.webhooks), nil
+}
+
+func (mdb *miniWalletMemory) SaveWebhookDelivery(delivery entity.WebhookDelivery) error {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+	for i := range mdb.deliveries {
+		if mdb.deliveries[i].ID == delivery.ID {
+			mdb.deliveries[i] = delivery
+		}
+	}
+	return nil
+}
+
+// webhook returns the stored subscription so callers can change it in place.
+func (mdb *miniWalletMemory) webhook(customerXId string, subscriptionID string) *entity.WebhookSubscription {
+	for i := range mdb.webhooks {
+		if mdb.webhooks[i].ID == subscriptionID && mdb.webhooks[i].CustomerXId == customerXId {
+			return &mdb.webhooks[i]
+		}
+	}
+	return nil
+}
+
+func (mdb *miniWalletMemory) FetchEvents(customerXId string, afterID int64, limit int) ([]entity.WalletEvent, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+
+	events := []entity.WalletEvent{}
+	for _, e := range mdb.events {
+		if len(events) == limit {
+			break
+		}
+		if e.CustomerXId == customerXId && e.ID > afterID {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (mdb *miniWalletMemory) LatestEventID(customerXId string) (int64, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+
+	for i := len(mdb.events) - 1; i >= 0; i-- {
+		if mdb.events[i].CustomerXId == customerXId {
+			return mdb.events[i].ID, nil
+		}
+	}
+	return 0, nil
+}
+
+func (mdb *miniWalletMemory) CreateRefreshToken(token entity.RefreshToken) error {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+	mdb.refreshTokens[token.TokenHash] = &token
+	return nil
+}
+
+func (mdb *miniWalletMemory) RotateRefreshToken(tokenHash string, next entity.RefreshToken, now time.Time) (*entity.RefreshToken, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+
+	current, ok := mdb.refreshTokens[tokenHash]
+	if !ok {
+		return nil, ErrInvalidRefreshToken
+	}
+	if !current.RotatedAt.IsZero() {
+		mdb.revokeFamily(current.FamilyID, now)
+		return nil, ErrRefreshTokenReused
+	}
+	if err := checkRefreshable(*current, now); err != nil {
+		return nil, err
+	}
+	if client, ok := mdb.clients[current.ClientID]; ok && !client.RevokedAt.IsZero() {
+		return nil, ErrInvalidRefreshToken
+	}
+	current.RotatedAt = now
+	next = inFamily(next, *current)
+	mdb.refreshTokens[next.TokenHash] = &next
+	rotated := next
+	return &rotated, nil
+}
+
+func (mdb *miniWalletMemory) RevokeSession(accessJTI string, customerXId string, expiresAt time.Time, now time.Time) error {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+
+	mdb.revokeAccessTokens([]entity.RevokedToken{revokedToken(accessJTI, customerXId, expiresAt, now)})
+	for _, t := range mdb.refreshTokens {
+		if t.AccessJTI == accessJTI && t.CustomerXId == customerXId {
+			mdb.revokeFamily(t.FamilyID, now)
+			break
+		}
+	}
+	return nil
+}
+
+func (mdb *miniWalletMemory) IsTokenRevoked(jti string) (bool, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+	_, ok := mdb.revokedTokens[jti]
+	return ok, nil
+}
+
+func (mdb *miniWalletMemory) PurgeExpiredTokens(now time.Time) (int, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+
+	purged := 0
+	for jti, t := range mdb.revokedTokens {
+		if !now.Before(t.ExpiresAt) {
+			delete(mdb.revokedTokens, jti)
+			purged++
+		}
+	}
+	for hash, t := range mdb.refreshTokens {
+		if !now.Before(t.ExpiresAt) {
+			delete(mdb.refreshTokens, hash)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (mdb *miniWalletMemory) revokeFamily(familyID string, now time.Time) {
+	var family []entity.RefreshToken
+	for _, t := range mdb.refreshTokens {
+		if t.FamilyID == familyID {
+			family = append(family, *t)
+			if t.RevokedAt.IsZero() {
+				t.RevokedAt = now
+			}
+		}
+	}
+	mdb.revokeAccessTokens(familyRevocations(family, now))
+}
+
+func (mdb *miniWalletMemory) revokeAccessTokens(revoked []entity.RevokedToken) {
+	for _, t := range revoked {
+		if _, ok := mdb.revokedTokens[t.JTI]; !ok {
+			mdb.revokedTokens[t.JTI] = t
+		}
+	}
+}
+
+func (mdb *miniWalletMemory) CreateAPIClient(client entity.APIClient, action entity.AdminAction) (*entity.APIClient, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+	stored := client
+	mdb.clients[client.ID] = &stored
+	mdb.insertAdminAction(action)
+	return &client, nil
+}
+
+func (mdb *miniWalletMemory) FetchAPIClient(clientID string) (*entity.APIClient, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+	stored, ok := mdb.clients[clientID]
+	if !ok {
+		return nil, ErrClientNotFound
+	}
+	client := *stored
+	return &client, nil
+}
+
+func (mdb *miniWalletMemory) FetchAPIClients() ([]entity.APIClient, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+	clients := []entity.APIClient{}
+	for _, c := range mdb.clients {
+		clients = append(clients, *c)
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		return clients[i].CreatedAt.Before(clients[j].CreatedAt)
+	})
+	return clients, nil
+}
+
+func (mdb *miniWalletMemory) RevokeAPIClient(clientID string, now time.Time, action entity.AdminAction) (*entity.APIClient, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+	stored, err := mdb.activeClient(clientID)
+	if err != nil {
+		return nil, err
+	}
+	stored.RevokedAt = now
+	families := map[string]bool{}
+	for _, t := range mdb.refreshTokens {
+		if t.ClientID == clientID && t.RevokedAt.IsZero() {
+			families[t.FamilyID] = true
+		}
+	}
+	for familyID := range families {
+		mdb.revokeFamily(familyID, now)
+	}
+	mdb.insertAdminAction(action)
+	client := *stored
+	return &client, nil
+}
+
+func (mdb *miniWalletMemory) AssignCustomer(clientID string, customerXId string, action entity.AdminAction) error {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+	if _, err := mdb.activeClient(clientID); err != nil {
+		return err
+	}
+	mdb.clientCustomers[customerXId] = entity.ClientCustomer{
+		CustomerXId: customerXId,
+		ClientID: clientID,
+		CreatedAt: now(),
+	}
+	mdb.insertAdminAction(action)
+	return nil
+}
+
+func (mdb *miniWalletMemory) ClaimCustomer(clientID string, customerXId string) error {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+	if assignment, ok := mdb.clientCustomers[customerXId]; ok {
+		return checkScope(assignment.ClientID, clientID)
+	}
+	if _, ok := mdb.wallets[customerXId]; ok {
+		return ErrCustomerNotInScope
+	}
+	mdb.clientCustomers[customerXId] = entity.ClientCustomer{
+		CustomerXId: customerXId,
+		ClientID: clientID,
+		CreatedAt: now(),
+	}
+	return nil
+}
+
+func (mdb *miniWalletMemory) activeClient(clientID string) (*entity.APIClient, error) {
+	client, ok := mdb.clients[clientID]
+	if !ok {
+		return nil, ErrClientNotFound
+	}
+	if !client.RevokedAt.IsZero() {
+		return nil, ErrClientRevoked
+	}
+	return client, nil
+}
+
+// ListenEvents mirrors LISTEN on EventChannel for this process only.
+func (mdb *miniWalletMemory) ListenEvents(ctx context.Context, notify func(customerXId string)) error {
+	mdb.mutex.Lock()
+	id := mdb.nextListener
+	mdb.nextListener++
+	mdb.listeners[id] = notify
+	mdb.mutex.Unlock()
+
+	<-ctx.Done()
+	mdb.mutex.Lock()
+	delete(mdb.listeners, id)
+	mdb.mutex.Unlock()
+	return ctx.Err()
+}
+
+func (mdb *miniWalletMemory) SearchWallets(ownedByPrefix string, limit int) ([]entity.Wallet, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+
+	wallets := []entity.Wallet{}
+	for _, w := range mdb.sortedWallets() {
+		if len(wallets) == limit {
+			break
+		}
+		if strings.HasPrefix(w.OwnedBy, ownedByPrefix) {
+			wallets = append(wallets, *mdb.wallet(w.OwnedBy))
+		}
+	}
+	return wallets, nil
+}
+
+func (mdb *miniWalletMemory) ForceWalletStatus(params models.ParamsTransition, action entity.AdminAction) (*entity.Wallet, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+	return mdb.transition(params, &action)
+}
+
+func (mdb *miniWalletMemory) AdjustBalance(params models.ParamsAdjustment, action entity.AdminAction) (*entity.Transaction, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+
+	wallet, ok := mdb.wallets[params.CreatedBy]
+	if !ok {
+		return nil, ErrCustomerNotFound
+	}
+	if wallet.Status == entity.WalletStatusClosed {
+		return nil, ErrWalletClosed
+	}
+	if params.Amount < 0 && mdb.available(wallet.ID, params.Currency) < -params.Amount {
+		return nil, ErrInsufficientBalance
+	}
+	if mdb.referenceTaken(params.ReferenceID) {
+		return nil, ErrDuplicateReference
+	}
+
+	mdb.changeBalance(wallet.ID, params.Currency, params.Amount)
+	transaction := mdb.insertTransaction(buildAdjustment(params))
+	mdb.postJournal(params.Currency,
+		systemLeg(AccountAdjustments, -params.Amount),
+		walletLeg(wallet.ID, params.Amount),
+	)
+	action, err := withAdjustmentDetails(action, transaction)
+	if err != nil {
+		logrus.Errorf("Fail to describe adjustment %s: %v", transaction.ID, err)
+	}
+	mdb.insertAdminAction(action)
+	mdb.publishEvent(wallet, entity.EventBalanceAdjusted, models.NewTransactionEventData(transaction))
+	return &transaction, nil
+}
+
+func (mdb *miniWalletMemory) RecordAdminAction(action entity.AdminAction) error {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+	mdb.insertAdminAction(action)
+	return nil
+}
+
+func (mdb *miniWalletMemory) insertAdminAction(action entity.AdminAction) {
+	action.ID = int64(len(mdb.adminActions)) + 1
+	action.CreatedAt = now()
+	mdb.adminActions = append(mdb.adminActions, action)
+}
+
+func (mdb *miniWalletMemory) AppendAudit(entry entity.AuditEntry) (*entity.AuditEntry, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+
+	prevHash := ""
+	if len(mdb.audit) > 0 {
+		prevHash = mdb.audit[len(mdb.audit)-1].Hash
+	}
+	entry = chainAuditEntry(entry, prevHash)
+	entry.ID = int64(len(mdb.audit)) + 1
+	mdb.audit = append(mdb.audit, entry)
+	return &entry, nil
+}
+
+func (mdb *miniWalletMemory) FetchAuditEntries(filter models.AuditFilter) ([]entity.AuditEntry, error) {
+	mdb.mutex.Lock()
+	defer mdb.mutex.Unlock()
+
+	entries := []entity.AuditEntry{}
+	for _, e := range mdb.audit {
+		if len(entries) == filter.Limit {
+			break
+		}
+		if e.ID <= filter.AfterID ||
+			(filter.CustomerXId != "" && e.CustomerXId != filter.CustomerXId) ||
+			(filter.Actor != "" && e.Actor != filter.Actor) ||
+			(filter.Action != "" && e.Action != filter.Action) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (mdb *miniWalletMemory) VerifyAudit() (models.AuditVerification, error) {
+	return verifyAuditChain(mdb.FetchAuditEntries)
+}
+
+// publishEvent mirrors publishEvent of the Postgres backend.
+func (mdb *miniWalletMemory) publishEvent(wallet *entity.Wallet, eventType string, data interface{}) {
+	event, err := buildEvent(wallet, eventType, data)
+	if err != nil {
+		logrus.Errorf("Fail to build %s event: %v", eventType, err)
+		return
+	}
+	event.ID = int64(len(mdb.events)) + 1
+	event.CreatedAt = now()
+	mdb.events = append(mdb.events, event)
+	mdb.enqueueWebhooks(wallet.OwnedBy, eventType, data)
+	// Listeners must not block, the mutex is held.
+	for _, notify := range mdb.listeners {
+		notify(wallet.OwnedBy)
+	}
+}
+
+// enqueueWebhooks mirrors enqueueWebhooks of the Postgres backend.
+func (mdb *miniWalletMemory) enqueueWebhooks(customerXId string, eventType string, data interface{}) {
+	var subscriptions []entity.WebhookSubscription
+	for _, s := range mdb.webhooks {
+		if s.CustomerXId == customerXId && s.DeletedAt.IsZero() && s.Subscribes(eventType) {
+			subscriptions = append(subscriptions, s)
+		}
+	}
+	if len(subscriptions) == 0 {
+		return
+	}
+	deliveries, err := buildDeliveries(subscriptions, eventType, data)
+	if err != nil {
+		logrus.Errorf("Fail to build %s webhook: %v", eventType, err)
+		return
+	}
+	for _, d := range deliveries {
+		d.ID = newUUID()
+		mdb.deliveries = append(mdb.deliveries, d)
+	}
+}
+
+// wallet returns a copy of the customer's wallet with its balances, or an
+// empty wallet like the Postgres backend does for unknown customers.
+func (mdb *miniWalletMemory) wallet(customerXId string) *entity.Wallet {
+	stored, ok := mdb.wallets[customerXId]
+	if !ok {
+		return &entity.Wallet{}
+	}
+	wallet := *stored
+	wallet.Balances = nil
+	for _, currency := range sortedCurrencies(mdb.balances[wallet.ID]) {
+		wallet.Balances = append(wallet.Balances, &entity.WalletBalance{
+			WalletID: wallet.ID,
+			Currency: currency,
+			Balance: mdb.balances[wallet.ID][currency],
+			Held: mdb.held[wallet.ID][currency],
+		})
+	}
+	return &wallet
+}
+
+func (mdb *miniWalletMemory) sortedWallets() []*entity.Wallet {
+	wallets := make([]*entity.Wallet, 0, len(mdb.wallets))
+	for _, w := range mdb.wallets {
+		wallets = append(wallets, w)
+	}
+	sort.Slice(wallets, func(i, j int) bool {
+		return wallets[i].OwnedBy < wallets[j].OwnedBy
+	})
+	return wallets
+}
+
+func (mdb *miniWalletMemory) changeBalance(walletID string, currency string, delta money.Amount) {
+	if mdb.balances[walletID] == nil {
+		mdb.balances[walletID] = map[string]money.Amount{}
+	}
+	mdb.balances[walletID][currency] += delta
+}
+
+func (mdb *miniWalletMemory) changeHeld(walletID string, currency string, delta money.Amount) {
+	if mdb.held[walletID] == nil {
+		mdb.held[walletID] = map[string]money.Amount{}
+	}
+	mdb.held[walletID][currency] += delta
+}
+
+func (mdb *miniWalletMemory) available(walletID string, currency string) money.Amount {
+	return mdb.balances[walletID][currency] - mdb.held[walletID][currency]
+}
+
+// pendingHold returns the stored pending withdrawal so callers can change its
+// status in place.
+func (mdb *miniWalletMemory) pendingHold(customerXId string, transactionID string) (*entity.Transaction, error) {
+	for i := range mdb.transactions {
+		t := &mdb.transactions[i]
+		if t.ID != transactionID || t.CreatedBy != customerXId || t.Type != entity.TransactionTypeWithdraw {
+			continue
+		}
+		if t.Status != entity.TransactionStatusPending {
+			return nil, ErrHoldNotPending
+		}
+		return t, nil
+	}
+	return nil, ErrHoldNotFound
+}
+
+func (mdb *miniWalletMemory) releaseHold(customerXId string, transactionID string, status string) (*entity.Transaction, error) {
+	wallet, ok := mdb.wallets[customerXId]
+	if !ok {
+		return nil, ErrCustomerNotFound
+	}
+	hold, err := mdb.pendingHold(customerXId, transactionID)
+	if err != nil {
+		return nil, err
+	}
+	mdb.changeHeld(wallet.ID, hold.Currency, -hold.Amount)
+	hold.Status = status
+	transaction := *hold
+	mdb.publishEvent(wallet, releaseEvent(status), models.NewTransactionEventData(transaction))
+	return &transaction, nil
+}
+
+// referenceTaken mirrors the unique index on non-failed reference IDs.
+func (mdb *miniWalletMemory) referenceTaken(referenceID string) bool {
+	for _, t := range mdb.transactions {
+		if t.ReferenceID == referenceID && t.Status != "failed" {
+			return true
+		}
+	}
+	return false
+}
+
+func (mdb *miniWalletMemory) insertTransaction(transaction entity.Transaction) entity.Transaction {
+	transaction.ID = newUUID()
+	transaction.CreatedAt = now()
+	mdb.transactions = append(mdb.transactions, transaction)
+	return transaction
+}
+
+func (mdb *miniWalletMemory) postJournal(currency string, legs ...ledgerLeg) {
+	entryID := newUUID()
+	for _, leg := range legs {
+		code := leg.code
+		accountType := entity.AccountTypeSystem
+		if leg.walletID != "" {
+			code = "wallet:" + leg.walletID
+			accountType = entity.AccountTypeWallet
+		}
+		account, ok := mdb.accounts[accountKey(code, currency)]
+		if !ok {
+			account = &entity.LedgerAccount{
+				ID: newUUID(),
+				Code: code,
+				Type: accountType,
+				WalletID: leg.walletID,
+				Currency: currency,
+				CreatedAt: now(),
+			}
+			mdb.accounts[accountKey(code, currency)] = account
+		}
+		account.Balance += leg.amount
+		mdb.postings = append(mdb.postings, entity.Posting{
+			ID: int64(len(mdb.postings) + 1),
+			JournalEntryID: entryID,
+			AccountID: account.ID,
+			Amount: leg.amount,
+			CreatedAt: now(),
+		})
+	}
+}
+
+// transactionTotals sums the booked transactions of a customer per
+// currency, including currencies the wallet holds no balance in.
+func (mdb *miniWalletMemory) transactionTotals(customerXId string) map[string]money.Amount {
+	totals := map[string]money.Amount{}
+	if wallet, ok := mdb.wallets[customerXId]; ok {
+		for currency := range mdb.balances[wallet.ID] {
+			totals[currency] = 0
+		}
+	}
+	for _, t := range mdb.transactions {
+		if t.CreatedBy == customerXId && t.Booked() {
+			totals[t.Currency] += t.SignedAmount()
+		}
+	}
+	return totals
+}
+
+func (mdb *miniWalletMemory) balanceDrift(wallet *entity.Wallet, currency string) models.BalanceDrift {
+	balance := mdb.balances[wallet.ID][currency]
+	total := mdb.transactionTotals(wallet.OwnedBy)[currency]
+	return models.BalanceDrift{
+		OwnedBy: wallet.OwnedBy,
+		WalletID: wallet.ID,
+		Currency: currency,
+		Balance: balance,
+		TransactionsTotal: total,
+		Drift: balance - total,
+	}
+}
+
+// checkLimits mirrors checkLimits of the Postgres backend.
+func (mdb *miniWalletMemory) checkLimits(params models.ParamsWallet, transactionType string) error {
+	rule, ok := mdb.limits.Rule(transactionType, params.Currency)
+	if !ok {
+		return nil
+	}
+
+	windows := limits.WindowsAt(now())
+	var usage limits.Usage
+	counted := map[string]bool{}
+	for _, t := range usageTypes(transactionType) {
+		counted[t] = true
+	}
+	for _, t := range mdb.transactions {
+		if t.CreatedBy != params.CreatedBy || !counted[t.Type] || t.Currency != params.Currency {
+			continue
+		}
+		if t.Type == entity.TransactionTypeReversal && t.Amount >= 0 {
+			continue
+		}
+		if !t.Booked() && t.Status != entity.TransactionStatusPending {
+			continue
+		}
+		amount := t.Amount
+		if amount < 0 {
+			amount = -amount
+		}
+		if !t.CreatedAt.Before(windows.Day) {
+			usage.Daily += amount
+		}
+		if !t.CreatedAt.Before(windows.Month) {
+			usage.Monthly += amount
+		}
+		if !t.CreatedAt.Before(windows.Hour) {
+			usage.HourlyCount++
+		}
+	}
+	return rule.Check(params.Amount, usage, params.Currency)
+}
+
+func transactionAfter(t entity.Transaction, cursor models.TransactionCursor) bool {
+	return t.CreatedAt.After(cursor.CreatedAt) ||
+		(t.CreatedAt.Equal(cursor.CreatedAt) && t.ID > cursor.ID)
+}
+
+func sortedCurrencies(amounts map[string]money.Amount) []string {
+	currencies := make([]string, 0, len(amounts))
+	for currency := range amounts {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	return currencies
+}
+
+func accountKey(code string, currency string) string {
+	return code + "|" + currency
+}
+
+// now matches the microsecond precision of Postgres timestamps.
+func now() time.Time {
+	return time.Now().Truncate(time.Microsecond)
+}
+
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"testing"
+	"time"
+	"github.com/Sigaeasu/go-mwe/limits"
+	"github.com/Sigaeasu/go-mwe/models"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/models/money"
+)
+
+// TestMemoryExpireHoldsSkipsFailures checks that a hold that cannot be
+// released does not keep the later ones from expiring, like in Postgres.
+func TestMemoryExpireHoldsSkipsFailures(t *testing.T) {
+	mdb := MiniWalletMemoryRepository(limits.Policy{}).(*miniWalletMemory)
+	customer := newUUID()
+	if _, err := mdb.CreateMiniWallet(customer); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mdb.ChangeStatusOnMiniWallet(customer, true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mdb.Deposit(models.ParamsWallet{Amount: 1000, Currency: money.DefaultCurrency, ReferenceID: newUUID(), CreatedBy: customer}); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-time.Second)
+	broken, err := mdb.HoldWithdrawal(models.ParamsWallet{Amount: 100, Currency: money.DefaultCurrency, ReferenceID: newUUID(), CreatedBy: customer}, past)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hold, err := mdb.HoldWithdrawal(models.ParamsWallet{Amount: 200, Currency: money.DefaultCurrency, ReferenceID: newUUID(), CreatedBy: customer}, past)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A hold whose wallet cannot be found fails to release.
+	for i := range mdb.transactions {
+		if mdb.transactions[i].ID == broken.ID {
+			mdb.transactions[i].CreatedBy = newUUID()
+		}
+	}
+
+	expired, err := mdb.ExpireHolds(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired != 1 {
+		t.Errorf("expired %d holds, want 1", expired)
+	}
+	if _, err := mdb.VoidWithdrawal(customer, hold.ID); err != ErrHoldNotPending {
+		t.Errorf("voiding the hold after the broken one: got %v, want %v", err, ErrHoldNotPending)
+	}
+	for _, transaction := range mdb.transactions {
+		if transaction.ID == broken.ID && transaction.Status != entity.TransactionStatusPending {
+			t.Errorf("broken hold is %s, want it left pending", transaction.Status)
+		}
+	}
+}
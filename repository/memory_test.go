@@ -0,0 +1,77 @@
+package repository_test
+
+import (
+	"errors"
+	"testing"
+	"github.com/Sigaeasu/go-mwe/config"
+	"github.com/Sigaeasu/go-mwe/limits"
+	"github.com/Sigaeasu/go-mwe/models"
+	"github.com/Sigaeasu/go-mwe/models/money"
+	"github.com/Sigaeasu/go-mwe/repository"
+	"github.com/Sigaeasu/go-mwe/repository/repotest"
+)
+
+func TestMemoryRepository(t *testing.T) {
+	if err := repotest.TestRepository(repository.MiniWalletMemoryRepository(limits.Policy{})); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestMemoryWithdrawLimits checks that transfers and deposit reversals use up
+// the daily withdraw limit along with withdrawals.
+func TestMemoryWithdrawLimits(t *testing.T) {
+	saved := config.Config.LimitsCfg
+	defer func() { config.Config.LimitsCfg = saved }()
+	config.Config.LimitsCfg = map[string]map[string]config.LimitRule{
+		money.DefaultCurrency: {"withdraw": {Daily: "100"}},
+	}
+	policy, err := limits.FromConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := repository.MiniWalletMemoryRepository(policy)
+	for _, customer := range []string{"source", "target"} {
+		if _, err := repo.CreateMiniWallet(customer); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repo.ChangeStatusOnMiniWallet(customer, true); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deposit, err := repo.Deposit(models.ParamsWallet{Amount: 50000, Currency: money.DefaultCurrency, ReferenceID: "deposit", CreatedBy: "source"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name string
+		run func() error
+		want error
+	}{
+		{"transfer", func() error {
+			_, err := repo.Transfer(models.ParamsTransfer{Amount: 4000, Currency: money.DefaultCurrency, ReferenceID: "transfer-1", CreatedBy: "source", ToCustomerXId: "target"})
+			return err
+		}, nil},
+		{"reversal", func() error {
+			_, err := repo.Reverse(models.ParamsReversal{TransactionID: deposit.ID, Amount: 4000, Currency: money.DefaultCurrency, ReferenceID: "reversal", CreatedBy: "source"})
+			return err
+		}, nil},
+		{"withdrawal over the rest", func() error {
+			_, err := repo.Withdraw(models.ParamsWallet{Amount: 2001, Currency: money.DefaultCurrency, ReferenceID: "withdraw", CreatedBy: "source"})
+			return err
+		}, limits.ErrDailyLimit},
+		{"transfer over the rest", func() error {
+			_, err := repo.Transfer(models.ParamsTransfer{Amount: 2001, Currency: money.DefaultCurrency, ReferenceID: "transfer-2", CreatedBy: "source", ToCustomerXId: "target"})
+			return err
+		}, limits.ErrDailyLimit},
+		{"transfer of the rest", func() error {
+			_, err := repo.Transfer(models.ParamsTransfer{Amount: 2000, Currency: money.DefaultCurrency, ReferenceID: "transfer-3", CreatedBy: "source", ToCustomerXId: "target"})
+			return err
+		}, nil},
+	}
+	for _, step := range steps {
+		if err := step.run(); !errors.Is(err, step.want) {
+			t.Fatalf("%s: got %v, want %v", step.name, err, step.want)
+		}
+	}
+}
@@ -0,0 +1,11 @@
+BEGIN;
+ALTER TABLE mini_wallets
+    ALTER COLUMN balance DROP DEFAULT,
+    ALTER COLUMN balance TYPE FLOAT USING balance / 100.0,
+    ALTER COLUMN balance SET DEFAULT 0;
+
+ALTER TABLE transactions
+    ALTER COLUMN amount DROP DEFAULT,
+    ALTER COLUMN amount TYPE FLOAT USING amount / 100.0,
+    ALTER COLUMN amount SET DEFAULT 0;
+COMMIT;
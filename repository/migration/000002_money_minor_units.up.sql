@@ -0,0 +1,12 @@
+-- Balances and amounts are stored as integer minor units (IDR has 2 decimals).
+BEGIN;
+ALTER TABLE mini_wallets
+    ALTER COLUMN balance DROP DEFAULT,
+    ALTER COLUMN balance TYPE BIGINT USING ROUND(balance::NUMERIC * 100)::BIGINT,
+    ALTER COLUMN balance SET DEFAULT 0;
+
+ALTER TABLE transactions
+    ALTER COLUMN amount DROP DEFAULT,
+    ALTER COLUMN amount TYPE BIGINT USING ROUND(amount::NUMERIC * 100)::BIGINT,
+    ALTER COLUMN amount SET DEFAULT 0;
+COMMIT;
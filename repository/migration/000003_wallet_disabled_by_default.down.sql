@@ -0,0 +1,3 @@
+ALTER TABLE mini_wallets
+    ALTER COLUMN is_enabled SET DEFAULT true,
+    ALTER COLUMN enabled_at SET DEFAULT now();
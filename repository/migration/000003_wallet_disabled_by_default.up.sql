@@ -0,0 +1,4 @@
+-- Wallets are created by /init and stay disabled until the customer enables them.
+ALTER TABLE mini_wallets
+    ALTER COLUMN is_enabled SET DEFAULT false,
+    ALTER COLUMN enabled_at DROP DEFAULT;
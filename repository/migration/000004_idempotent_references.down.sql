@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS idempotent_responses;
+DROP INDEX IF EXISTS transactions_reference_id_key;
@@ -0,0 +1,14 @@
+-- A reference ID can only be used by one non-failed transaction. Failed
+-- attempts keep their row so the client can retry with the same reference.
+CREATE UNIQUE INDEX IF NOT EXISTS transactions_reference_id_key
+    ON transactions (reference_id)
+    WHERE status <> 'failed';
+
+CREATE TABLE IF NOT EXISTS idempotent_responses (
+    reference_id uuid PRIMARY KEY,
+    customer_xid uuid NOT NULL,
+    request_type VARCHAR NOT NULL,
+    status_code INT NOT NULL,
+    body JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,6 @@
+-- Both legs of a transfer share the same transfer_id.
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS transfer_id uuid NULL;
+
+CREATE INDEX IF NOT EXISTS transactions_transfer_id_idx
+    ON transactions (transfer_id)
+    WHERE transfer_id IS NOT NULL;
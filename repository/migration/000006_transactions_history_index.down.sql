@@ -0,0 +1 @@
+DROP INDEX IF EXISTS transactions_created_by_created_at_id_idx;
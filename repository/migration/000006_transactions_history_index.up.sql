@@ -0,0 +1,3 @@
+-- Serves the keyset pagination of a customer's history: (created_at, id) > cursor.
+CREATE INDEX IF NOT EXISTS transactions_created_by_created_at_id_idx
+    ON transactions (created_by, created_at, id);
@@ -0,0 +1,12 @@
+-- Only IDR balances survive a downgrade.
+BEGIN;
+ALTER TABLE transactions DROP COLUMN IF EXISTS currency;
+
+ALTER TABLE mini_wallets ADD COLUMN balance BIGINT NOT NULL DEFAULT 0;
+UPDATE mini_wallets w
+SET balance = b.balance
+FROM wallet_balances b
+WHERE b.wallet_id = w.id AND b.currency = 'IDR';
+
+DROP TABLE IF EXISTS wallet_balances;
+COMMIT;
@@ -0,0 +1,17 @@
+BEGIN;
+CREATE TABLE IF NOT EXISTS wallet_balances (
+    wallet_id uuid NOT NULL REFERENCES mini_wallets (id),
+    currency CHAR(3) NOT NULL,
+    balance BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (wallet_id, currency)
+);
+
+-- Every existing balance was held in IDR.
+INSERT INTO wallet_balances (wallet_id, currency, balance)
+SELECT id, 'IDR', balance FROM mini_wallets;
+
+ALTER TABLE mini_wallets DROP COLUMN balance;
+
+ALTER TABLE transactions ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'IDR';
+ALTER TABLE transactions ALTER COLUMN currency DROP DEFAULT;
+COMMIT;
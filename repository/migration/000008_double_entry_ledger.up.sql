@@ -0,0 +1,68 @@
+BEGIN;
+-- Wallet accounts mirror wallet_balances; system accounts stand for money
+-- outside the wallets, e.g. the bank that funds deposits.
+CREATE TABLE IF NOT EXISTS ledger_accounts (
+    id uuid DEFAULT gen_random_uuid () PRIMARY KEY,
+    code VARCHAR NOT NULL,
+    type VARCHAR NOT NULL,
+    wallet_id uuid NULL REFERENCES mini_wallets (id),
+    currency CHAR(3) NOT NULL,
+    balance BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (code, currency)
+);
+
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id uuid DEFAULT gen_random_uuid () PRIMARY KEY,
+    transaction_id uuid NULL,
+    description VARCHAR NOT NULL,
+    currency CHAR(3) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS postings (
+    id BIGSERIAL PRIMARY KEY,
+    journal_entry_id uuid NOT NULL REFERENCES journal_entries (id),
+    account_id uuid NOT NULL REFERENCES ledger_accounts (id),
+    amount BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS postings_journal_entry_id_idx ON postings (journal_entry_id);
+CREATE INDEX IF NOT EXISTS postings_account_id_idx ON postings (account_id);
+
+-- The postings of a journal entry must sum to zero once its transaction commits.
+CREATE OR REPLACE FUNCTION check_journal_entry_balanced() RETURNS trigger AS $$
+BEGIN
+    IF (SELECT SUM(amount) FROM postings WHERE journal_entry_id = NEW.journal_entry_id) <> 0 THEN
+        RAISE EXCEPTION 'journal entry % does not balance', NEW.journal_entry_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER postings_balanced
+    AFTER INSERT ON postings
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION check_journal_entry_balanced();
+
+-- Existing balances are booked once against an opening balance account.
+INSERT INTO ledger_accounts (code, type, wallet_id, currency, balance)
+SELECT 'wallet:' || wallet_id, 'wallet', wallet_id, currency, balance
+FROM wallet_balances;
+
+INSERT INTO ledger_accounts (code, type, currency, balance)
+SELECT 'system:opening_balance', 'system', currency, -SUM(balance)
+FROM wallet_balances
+GROUP BY currency;
+
+INSERT INTO journal_entries (description, currency)
+SELECT 'opening_balance', currency
+FROM wallet_balances
+GROUP BY currency;
+
+INSERT INTO postings (journal_entry_id, account_id, amount)
+SELECT e.id, a.id, a.balance
+FROM ledger_accounts a
+JOIN journal_entries e ON e.currency = a.currency AND e.description = 'opening_balance';
+COMMIT;
@@ -0,0 +1,6 @@
+BEGIN;
+DROP INDEX IF EXISTS transactions_pending_expires_at_idx;
+ALTER TABLE transactions DROP COLUMN IF EXISTS expires_at;
+ALTER TABLE wallet_balances DROP CONSTRAINT IF EXISTS wallet_balances_held_check;
+ALTER TABLE wallet_balances DROP COLUMN IF EXISTS held;
+COMMIT;
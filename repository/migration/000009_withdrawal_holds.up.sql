@@ -0,0 +1,12 @@
+BEGIN;
+-- Funds reserved by pending withdrawals. The available balance is
+-- balance - held; the ledger only moves when a hold is captured.
+ALTER TABLE wallet_balances ADD COLUMN held BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE wallet_balances ADD CONSTRAINT wallet_balances_held_check CHECK (held >= 0);
+
+ALTER TABLE transactions ADD COLUMN expires_at TIMESTAMP NULL;
+
+CREATE INDEX IF NOT EXISTS transactions_pending_expires_at_idx
+    ON transactions (expires_at)
+    WHERE status = 'pending';
+COMMIT;
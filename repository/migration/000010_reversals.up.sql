@@ -0,0 +1,9 @@
+BEGIN;
+-- A reversal row points at the deposit or withdrawal it compensates and
+-- carries its effect on the balance as a signed amount.
+ALTER TABLE transactions ADD COLUMN reversal_of uuid NULL REFERENCES transactions (id);
+
+CREATE INDEX IF NOT EXISTS transactions_reversal_of_idx
+    ON transactions (reversal_of)
+    WHERE reversal_of IS NOT NULL;
+COMMIT;
@@ -0,0 +1,38 @@
+BEGIN;
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id uuid DEFAULT gen_random_uuid () PRIMARY KEY,
+    customer_xid uuid NOT NULL,
+    url VARCHAR NOT NULL,
+    events VARCHAR[] NOT NULL,
+    secret VARCHAR NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    deleted_at TIMESTAMP NULL
+);
+
+CREATE INDEX IF NOT EXISTS webhook_subscriptions_customer_xid_idx
+    ON webhook_subscriptions (customer_xid)
+    WHERE deleted_at IS NULL;
+
+-- The outbox: rows are written in the same transaction as the wallet change
+-- they announce and sent by the dispatcher afterwards.
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id uuid DEFAULT gen_random_uuid () PRIMARY KEY,
+    subscription_id uuid NOT NULL REFERENCES webhook_subscriptions (id),
+    event_id uuid NOT NULL,
+    event_type VARCHAR NOT NULL,
+    payload JSONB NOT NULL,
+    status VARCHAR NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_status_code INT NULL,
+    last_error VARCHAR NULL,
+    delivered_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx
+    ON webhook_deliveries (next_attempt_at)
+    WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_subscription_idx
+    ON webhook_deliveries (subscription_id, created_at);
+COMMIT;
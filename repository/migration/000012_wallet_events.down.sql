@@ -0,0 +1,4 @@
+BEGIN;
+DROP TABLE IF EXISTS wallet_events;
+DROP FUNCTION IF EXISTS wallet_events_append_only();
+COMMIT;
@@ -0,0 +1,25 @@
+BEGIN;
+-- Append-only: rows are written in the same transaction as the wallet change
+-- they describe and never updated or deleted.
+CREATE TABLE IF NOT EXISTS wallet_events (
+    id BIGSERIAL PRIMARY KEY,
+    customer_xid uuid NOT NULL,
+    wallet_id uuid NOT NULL REFERENCES mini_wallets (id),
+    type VARCHAR NOT NULL,
+    data JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS wallet_events_customer_xid_idx
+    ON wallet_events (customer_xid, id);
+
+CREATE OR REPLACE FUNCTION wallet_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'wallet_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER wallet_events_append_only
+    BEFORE UPDATE OR DELETE ON wallet_events
+    FOR EACH ROW EXECUTE FUNCTION wallet_events_append_only();
+COMMIT;
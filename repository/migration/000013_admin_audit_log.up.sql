@@ -0,0 +1,17 @@
+BEGIN;
+CREATE TABLE IF NOT EXISTS admin_audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor VARCHAR NOT NULL,
+    action VARCHAR NOT NULL,
+    customer_xid uuid NULL,
+    reason VARCHAR NULL,
+    details JSONB NULL,
+    outcome VARCHAR NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS admin_audit_log_customer_xid_idx
+    ON admin_audit_log (customer_xid, id);
+CREATE INDEX IF NOT EXISTS admin_audit_log_actor_idx
+    ON admin_audit_log (actor, id);
+COMMIT;
@@ -0,0 +1,32 @@
+BEGIN;
+-- before and after are json rather than jsonb so they are read back byte for
+-- byte as they were hashed. prev_hash is unique so the chain cannot fork.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor_type VARCHAR NOT NULL,
+    actor VARCHAR NULL,
+    action VARCHAR NOT NULL,
+    customer_xid uuid NULL,
+    before JSON NULL,
+    after JSON NULL,
+    status_code INT NOT NULL,
+    request_id VARCHAR NOT NULL,
+    client_ip VARCHAR NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    prev_hash VARCHAR(64) NOT NULL UNIQUE,
+    hash VARCHAR(64) NOT NULL UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_customer_xid_idx ON audit_log (customer_xid, id);
+CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON audit_log (actor, id);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+COMMIT;
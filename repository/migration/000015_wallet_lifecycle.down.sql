@@ -0,0 +1,7 @@
+BEGIN;
+DROP TABLE IF EXISTS wallet_status_transitions;
+ALTER TABLE mini_wallets
+    DROP CONSTRAINT IF EXISTS mini_wallets_is_enabled_check,
+    DROP CONSTRAINT IF EXISTS mini_wallets_status_check,
+    DROP COLUMN IF EXISTS status;
+COMMIT;
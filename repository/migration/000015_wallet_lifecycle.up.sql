@@ -0,0 +1,25 @@
+BEGIN;
+ALTER TABLE mini_wallets ADD COLUMN IF NOT EXISTS status VARCHAR NOT NULL DEFAULT 'disabled';
+UPDATE mini_wallets SET status = CASE WHEN is_enabled THEN 'active' ELSE 'disabled' END;
+
+ALTER TABLE mini_wallets
+    ADD CONSTRAINT mini_wallets_status_check
+        CHECK (status IN ('active', 'disabled', 'frozen', 'closed')),
+    -- is_enabled is kept for readers that only know enabled and disabled.
+    ADD CONSTRAINT mini_wallets_is_enabled_check
+        CHECK (is_enabled = (status = 'active'));
+
+CREATE TABLE IF NOT EXISTS wallet_status_transitions (
+    id BIGSERIAL PRIMARY KEY,
+    wallet_id uuid NOT NULL REFERENCES mini_wallets (id),
+    from_status VARCHAR NOT NULL,
+    to_status VARCHAR NOT NULL,
+    actor_type VARCHAR NOT NULL,
+    actor VARCHAR NULL,
+    reason VARCHAR NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS wallet_status_transitions_wallet_id_idx
+    ON wallet_status_transitions (wallet_id, id);
+COMMIT;
@@ -0,0 +1,4 @@
+BEGIN;
+DROP TABLE IF EXISTS revoked_tokens;
+DROP TABLE IF EXISTS refresh_tokens;
+COMMIT;
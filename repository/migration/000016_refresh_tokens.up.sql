@@ -0,0 +1,29 @@
+BEGIN;
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id uuid PRIMARY KEY,
+    family_id uuid NOT NULL,
+    customer_xid uuid NOT NULL,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    access_jti uuid NOT NULL UNIQUE,
+    access_expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP NOT NULL,
+    rotated_at TIMESTAMP NULL,
+    revoked_at TIMESTAMP NULL
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_id_idx
+    ON refresh_tokens (family_id);
+CREATE INDEX IF NOT EXISTS refresh_tokens_expires_at_idx
+    ON refresh_tokens (expires_at);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti uuid PRIMARY KEY,
+    customer_xid uuid NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS revoked_tokens_expires_at_idx
+    ON revoked_tokens (expires_at);
+COMMIT;
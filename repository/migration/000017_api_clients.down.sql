@@ -0,0 +1,4 @@
+BEGIN;
+DROP TABLE IF EXISTS api_client_customers;
+DROP TABLE IF EXISTS api_clients;
+COMMIT;
@@ -0,0 +1,18 @@
+BEGIN;
+CREATE TABLE IF NOT EXISTS api_clients (
+    id uuid PRIMARY KEY,
+    name VARCHAR NOT NULL,
+    secret_hash VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    revoked_at TIMESTAMP NULL
+);
+
+CREATE TABLE IF NOT EXISTS api_client_customers (
+    customer_xid uuid PRIMARY KEY,
+    client_id uuid NOT NULL REFERENCES api_clients (id),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS api_client_customers_client_id_idx
+    ON api_client_customers (client_id);
+COMMIT;
@@ -0,0 +1,4 @@
+BEGIN;
+DROP INDEX IF EXISTS refresh_tokens_client_id_idx;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS client_id;
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+ALTER TABLE refresh_tokens
+    ADD COLUMN IF NOT EXISTS client_id uuid NULL REFERENCES api_clients (id);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_client_id_idx
+    ON refresh_tokens (client_id);
+COMMIT;
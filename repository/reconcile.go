@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10"
+	"github.com/Sigaeasu/go-mwe/models"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
+)
+
+var ErrNoDrift = apperror.New(apperror.CodeNoDrift, "Balance already matches its transactions")
+
+// balanceDriftQuery lists every (wallet, currency) that has a balance or a
+// transaction, with the signed sum of its booked transactions.
+const balanceDriftQuery = `
+	WITH totals AS (
+		SELECT created_by, currency, SUM(CASE
+			WHEN type IN ('deposit', 'transfer_in', 'adjustment', 'reversal') THEN amount
+			WHEN type IN ('withdraw', 'transfer_out') THEN -amount
+			ELSE 0 END) AS total
+		FROM transactions
+		WHERE status IN ('success', 'captured')
+		GROUP BY created_by, currency
+	), pairs AS (
+		SELECT wallet_id, currency FROM wallet_balances
+		UNION
+		SELECT w.id, t.currency FROM totals t JOIN mini_wallets w ON w.owned_by = t.created_by
+	)
+	SELECT w.owned_by, w.id AS wallet_id, p.currency,
+		COALESCE(b.balance, 0) AS balance,
+		COALESCE(t.total, 0) AS transactions_total,
+		COALESCE(b.balance, 0) - COALESCE(t.total, 0) AS drift
+	FROM pairs p
+	JOIN mini_wallets w ON w.id = p.wallet_id
+	LEFT JOIN wallet_balances b ON b.wallet_id = p.wallet_id AND b.currency = p.currency
+	LEFT JOIN totals t ON t.created_by = w.owned_by AND t.currency = p.currency
+	WHERE ?
+	ORDER BY w.owned_by, p.currency`
+
+// FetchBalanceDrifts compares the balance of every wallet and currency with
+// the sum of its booked transactions.
+func (pdb *miniWalletDatabase) FetchBalanceDrifts() ([]models.BalanceDrift, error) {
+	drifts := []models.BalanceDrift{}
+	_, err := pdb.dbConn.Query(&drifts, balanceDriftQuery, pg.Safe("TRUE"))
+	if err != nil {
+		return nil, err
+	}
+	return drifts, nil
+}
+
+// WriteAdjustment records an adjustment transaction that brings the sum of
+// the wallet's transactions in line with its balance. The drift is computed
+// again under the wallet lock, so a stale report cannot over-correct.
+func (pdb *miniWalletDatabase) WriteAdjustment(customerXId string, currency string) (*entity.Transaction, error) {
+	var transaction *entity.Transaction
+	err := pdb.dbConn.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		wallet, err := lockMiniWallet(tx, customerXId)
+		if err != nil {
+			return err
+		}
+
+		var drift models.BalanceDrift
+		_, err = tx.QueryOne(&drift, balanceDriftQuery,
+			pg.SafeQuery("w.id = ? AND p.currency = ?", wallet.ID, currency))
+		if err != nil {
+			if err == pg.ErrNoRows {
+				return ErrNoDrift
+			}
+			return err
+		}
+		if drift.Drift == 0 {
+			return ErrNoDrift
+		}
+
+		adjustment := buildTransaction(models.ParamsWallet{
+			Amount: drift.Drift,
+			Currency: currency,
+			CreatedBy: wallet.OwnedBy,
+		}, entity.TransactionTypeAdjustment, "success")
+		_, err = tx.QueryOne(pg.Scan(&adjustment.ReferenceID), "SELECT gen_random_uuid()")
+		if err != nil {
+			return err
+		}
+		transaction, err = insertTransaction(tx, adjustment)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
@@ -0,0 +1,1456 @@
+// Package repotest checks that an implementation of
+// repository.MiniWalletRepoInterface follows the rules every backend shares,
+// in the spirit of testing/fstest.TestFS:
+//
+//	if err := repotest.TestRepository(repository.MiniWalletMemoryRepository(limits.Policy{})); err != nil {
+//		t.Fatal(err)
+//	}
+//
+// Every check works on freshly generated customers, so the suite can run
+// against a database that already holds other wallets.
+package repotest
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/Sigaeasu/go-mwe/models"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/models/money"
+	"github.com/Sigaeasu/go-mwe/repository"
+)
+
+const currency = money.DefaultCurrency
+
+type check struct {
+	name string
+	run func(repo repository.MiniWalletRepoInterface) error
+}
+
+var checks = []check{
+	{"wallet creation", checkCreateWallet},
+	{"enable and disable", checkChangeStatus},
+	{"deposit and withdraw", checkDepositWithdraw},
+	{"reference uniqueness", checkReferenceUniqueness},
+	{"transfer", checkTransfer},
+	{"transaction pages", checkTransactionPages},
+	{"withdrawal holds", checkHolds},
+	{"hold expiry", checkHoldExpiry},
+	{"reversals", checkReversals},
+	{"idempotent responses", checkIdempotentResponses},
+	{"booked responses", checkBookedResponses},
+	{"webhook outbox", checkWebhookOutbox},
+	{"event log", checkEventLog},
+	{"admin actions", checkAdminActions},
+	{"wallet lifecycle", checkLifecycle},
+	{"inactive wallets", checkInactiveWallets},
+	{"holds of frozen wallets", checkFrozenHolds},
+	{"audit chain", checkAuditChain},
+	{"refresh tokens", checkRefreshTokens},
+	{"API clients", checkAPIClients},
+	{"ledger and reconciliation", checkLedger},
+}
+
+// TestRepository runs every check against repo and returns all failures
+// joined into one error, or nil when the backend conforms.
+func TestRepository(repo repository.MiniWalletRepoInterface) error {
+	var failures []error
+	for _, c := range checks {
+		if err := c.run(repo); err != nil {
+			failures = append(failures, fmt.Errorf("%s: %w", c.name, err))
+		}
+	}
+	return errors.Join(failures...)
+}
+
+func checkCreateWallet(repo repository.MiniWalletRepoInterface) error {
+	customer := newUUID()
+
+	unknown, err := repo.FetchMiniWalletByID(customer)
+	if err != nil {
+		return err
+	}
+	if unknown.ID != "" {
+		return fmt.Errorf("unknown customer has wallet %s", unknown.ID)
+	}
+
+	created, err := repo.CreateMiniWallet(customer)
+	if err != nil {
+		return err
+	}
+	if created.ID == "" || created.OwnedBy != customer {
+		return fmt.Errorf("created wallet %+v does not belong to %s", created, customer)
+	}
+	if created.IsEnabled || created.Status != entity.WalletStatusDisabled {
+		return fmt.Errorf("new wallet is %s", created.Status)
+	}
+
+	again, err := repo.CreateMiniWallet(customer)
+	if err != nil {
+		return err
+	}
+	if again.ID != created.ID {
+		return fmt.Errorf("second creation returned wallet %s, want %s", again.ID, created.ID)
+	}
+
+	if _, err := repo.CreateMiniWallet(""); !errors.Is(err, repository.ErrEmptyCustomer) {
+		return fmt.Errorf("creating without customer: got %v, want %v", err, repository.ErrEmptyCustomer)
+	}
+	return nil
+}
+
+func checkChangeStatus(repo repository.MiniWalletRepoInterface) error {
+	customer := newUUID()
+	if _, err := repo.CreateMiniWallet(customer); err != nil {
+		return err
+	}
+
+	if _, err := repo.ChangeStatusOnMiniWallet(customer, false); !errors.Is(err, repository.ErrAlreadyDisabled) {
+		return fmt.Errorf("disabling a new wallet: got %v, want %v", err, repository.ErrAlreadyDisabled)
+	}
+	enabled, err := repo.ChangeStatusOnMiniWallet(customer, true)
+	if err != nil {
+		return err
+	}
+	if !enabled.IsEnabled || enabled.EnabledAt.IsZero() {
+		return fmt.Errorf("enabled wallet is %+v", enabled)
+	}
+	if _, err := repo.ChangeStatusOnMiniWallet(customer, true); !errors.Is(err, repository.ErrAlreadyEnabled) {
+		return fmt.Errorf("enabling twice: got %v, want %v", err, repository.ErrAlreadyEnabled)
+	}
+	disabled, err := repo.ChangeStatusOnMiniWallet(customer, false)
+	if err != nil {
+		return err
+	}
+	if disabled.IsEnabled || disabled.DisabledAt.IsZero() {
+		return fmt.Errorf("disabled wallet is %+v", disabled)
+	}
+
+	if _, err := repo.ChangeStatusOnMiniWallet(newUUID(), true); !errors.Is(err, repository.ErrCustomerNotFound) {
+		return fmt.Errorf("enabling an unknown customer: got %v, want %v", err, repository.ErrCustomerNotFound)
+	}
+	return nil
+}
+
+func checkDepositWithdraw(repo repository.MiniWalletRepoInterface) error {
+	customer, err := newEnabledWallet(repo)
+	if err != nil {
+		return err
+	}
+
+	deposit, err := repo.Deposit(params(customer, 10000))
+	if err != nil {
+		return err
+	}
+	if deposit.ID == "" || deposit.Amount != 10000 || deposit.Type != entity.TransactionTypeDeposit || deposit.Status != "success" {
+		return fmt.Errorf("deposit returned %+v", deposit)
+	}
+	if _, err := repo.Withdraw(params(customer, 2500)); err != nil {
+		return err
+	}
+	if err := expectBalance(repo, customer, 7500); err != nil {
+		return err
+	}
+
+	failed := params(customer, 7501)
+	if _, err := repo.Withdraw(failed); !errors.Is(err, repository.ErrInsufficientBalance) {
+		return fmt.Errorf("overdrawing: got %v, want %v", err, repository.ErrInsufficientBalance)
+	}
+	if err := expectBalance(repo, customer, 7500); err != nil {
+		return err
+	}
+
+	if _, err := repo.Deposit(params(newUUID(), 100)); !errors.Is(err, repository.ErrCustomerNotFound) {
+		return fmt.Errorf("depositing to an unknown customer: got %v, want %v", err, repository.ErrCustomerNotFound)
+	}
+	return nil
+}
+
+func checkHolds(repo repository.MiniWalletRepoInterface) error {
+	customer, err := newEnabledWallet(repo)
+	if err != nil {
+		return err
+	}
+	if _, err := repo.Deposit(params(customer, 10000)); err != nil {
+		return err
+	}
+
+	later := time.Now().Add(time.Hour)
+	captured, err := repo.HoldWithdrawal(params(customer, 3000), later)
+	if err != nil {
+		return err
+	}
+	if captured.Status != entity.TransactionStatusPending {
+		return fmt.Errorf("hold returned %+v", captured)
+	}
+	if err := expectAvailable(repo, customer, 10000, 7000); err != nil {
+		return err
+	}
+	if _, err := repo.Withdraw(params(customer, 7001)); !errors.Is(err, repository.ErrInsufficientBalance) {
+		return fmt.Errorf("withdrawing held funds: got %v, want %v", err, repository.ErrInsufficientBalance)
+	}
+	if captured, err = repo.CaptureWithdrawal(customer, captured.ID); err != nil {
+		return err
+	}
+	if captured.Status != entity.TransactionStatusCaptured {
+		return fmt.Errorf("capture returned %+v", captured)
+	}
+	if err := expectAvailable(repo, customer, 7000, 7000); err != nil {
+		return err
+	}
+	if _, err := repo.VoidWithdrawal(customer, captured.ID); !errors.Is(err, repository.ErrHoldNotPending) {
+		return fmt.Errorf("voiding a captured withdrawal: got %v, want %v", err, repository.ErrHoldNotPending)
+	}
+
+	voided, err := repo.HoldWithdrawal(params(customer, 2000), later)
+	if err != nil {
+		return err
+	}
+	if _, err := repo.VoidWithdrawal(customer, voided.ID); err != nil {
+		return err
+	}
+	if _, err := repo.CaptureWithdrawal(newUUID(), voided.ID); !errors.Is(err, repository.ErrCustomerNotFound) {
+		return fmt.Errorf("capturing another customer's withdrawal: got %v, want %v", err, repository.ErrCustomerNotFound)
+	}
+
+	stale, err := repo.HoldWithdrawal(params(customer, 1000), time.Now().Add(-time.Second))
+	if err != nil {
+		return err
+	}
+	if _, err := repo.CaptureWithdrawal(customer, stale.ID); !errors.Is(err, repository.ErrHoldExpired) {
+		return fmt.Errorf("capturing an expired hold: got %v, want %v", err, repository.ErrHoldExpired)
+	}
+	if expired, err := repo.ExpireHolds(time.Now()); err != nil || expired < 1 {
+		return fmt.Errorf("expiring holds: expired %d, %v", expired, err)
+	}
+	if _, err := repo.VoidWithdrawal(customer, stale.ID); !errors.Is(err, repository.ErrHoldNotPending) {
+		return fmt.Errorf("voiding an expired hold: got %v, want %v", err, repository.ErrHoldNotPending)
+	}
+	return expectAvailable(repo, customer, 7000, 7000)
+}
+
+// checkHoldExpiry checks that one ExpireHolds call releases the stale holds
+// of every wallet, whatever its status, and leaves the others alone.
+func checkHoldExpiry(repo repository.MiniWalletRepoInterface) error {
+	var stale, current []entity.Transaction
+	for _, frozen := range []bool{false, true} {
+		customer, err := newEnabledWallet(repo)
+		if err != nil {
+			return err
+		}
+		if _, err := repo.Deposit(params(customer, 1000)); err != nil {
+			return err
+		}
+		for _, expiresAt := range []time.Time{time.Now().Add(-time.Minute), time.Now().Add(-time.Second)} {
+			hold, err := repo.HoldWithdrawal(params(customer, 100), expiresAt)
+			if err != nil {
+				return err
+			}
+			stale = append(stale, *hold)
+		}
+		hold, err := repo.HoldWithdrawal(params(customer, 100), time.Now().Add(time.Hour))
+		if err != nil {
+			return err
+		}
+		current = append(current, *hold)
+		if frozen {
+			action := entity.AdminAction{Actor: "ops", Reason: "check"}
+			if _, err := repo.ForceWalletStatus(transition(customer, entity.WalletStatusFrozen, entity.ActorAdmin), action); err != nil {
+				return err
+			}
+		}
+	}
+
+	expired, err := repo.ExpireHolds(time.Now())
+	if err != nil {
+		return err
+	}
+	if expired < len(stale) {
+		return fmt.Errorf("expired %d holds, want at least %d", expired, len(stale))
+	}
+	for _, hold := range stale {
+		if _, err := repo.VoidWithdrawal(hold.CreatedBy, hold.ID); !errors.Is(err, repository.ErrHoldNotPending) {
+			return fmt.Errorf("voiding a hold that ended at %v: got %v, want %v", hold.ExpiresAt, err, repository.ErrHoldNotPending)
+		}
+	}
+	for _, hold := range current {
+		if err := expectAvailable(repo, hold.CreatedBy, 1000, 900); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkReversals(repo repository.MiniWalletRepoInterface) error {
+	customer, err := newEnabledWallet(repo)
+	if err != nil {
+		return err
+	}
+	deposit, err := repo.Deposit(params(customer, 10000))
+	if err != nil {
+		return err
+	}
+	withdraw, err := repo.Withdraw(params(customer, 4000))
+	if err != nil {
+		return err
+	}
+
+	partial, err := repo.Reverse(reversalParams(customer, deposit.ID, 2500))
+	if err != nil {
+		return err
+	}
+	if partial.Amount != -2500 || partial.ReversalOf != deposit.ID || partial.Type != entity.TransactionTypeReversal {
+		return fmt.Errorf("partial reversal returned %+v", partial)
+	}
+	if _, err := repo.Reverse(reversalParams(customer, deposit.ID, 7501)); !errors.Is(err, repository.ErrReversalExceedsOriginal) {
+		return fmt.Errorf("reversing more than is left: got %v, want %v", err, repository.ErrReversalExceedsOriginal)
+	}
+	// The rest of the deposit is 7500 but only 3500 is left in the wallet.
+	if _, err := repo.Reverse(reversalParams(customer, deposit.ID, 0)); !errors.Is(err, repository.ErrInsufficientBalance) {
+		return fmt.Errorf("reversing more than the balance: got %v, want %v", err, repository.ErrInsufficientBalance)
+	}
+	// The withdrawal was paid out, a customer putting it back creates money.
+	if _, err := repo.Reverse(reversalParams(customer, withdraw.ID, 0)); !errors.Is(err, repository.ErrReversalNotAllowed) {
+		return fmt.Errorf("customer reversing a withdrawal: got %v, want %v", err, repository.ErrReversalNotAllowed)
+	}
+	action := entity.AdminAction{Actor: "ops", Reason: "check"}
+	full, err := repo.ForceReversal(reversalParams(customer, withdraw.ID, 0), action)
+	if err != nil {
+		return err
+	}
+	if full.Amount != 4000 {
+		return fmt.Errorf("full reversal returned %+v", full)
+	}
+	if _, err := repo.ForceReversal(reversalParams(customer, withdraw.ID, 0), action); !errors.Is(err, repository.ErrReversalExceedsOriginal) {
+		return fmt.Errorf("reversing twice: got %v, want %v", err, repository.ErrReversalExceedsOriginal)
+	}
+	lastID, err := repo.LatestEventID(customer)
+	if err != nil {
+		return err
+	}
+	events, err := repo.FetchEvents(customer, lastID-1, 10)
+	if err != nil {
+		return err
+	}
+	if len(events) != 1 || events[0].Type != entity.EventTransactionReversed {
+		return fmt.Errorf("last event after a reversal is %+v, want %s", events, entity.EventTransactionReversed)
+	}
+	if _, err := repo.Reverse(reversalParams(customer, full.ID, 0)); !errors.Is(err, repository.ErrNotReversible) {
+		return fmt.Errorf("reversing a reversal: got %v, want %v", err, repository.ErrNotReversible)
+	}
+	other, err := newEnabledWallet(repo)
+	if err != nil {
+		return err
+	}
+	if _, err := repo.Reverse(reversalParams(other, deposit.ID, 0)); !errors.Is(err, repository.ErrTransactionNotFound) {
+		return fmt.Errorf("reversing another customer's deposit: got %v, want %v", err, repository.ErrTransactionNotFound)
+	}
+	if err := expectBalance(repo, customer, 7500); err != nil {
+		return err
+	}
+
+	if _, err := repo.ForceWalletStatus(transition(customer, entity.WalletStatusFrozen, entity.ActorAdmin), action); err != nil {
+		return err
+	}
+	if _, err := repo.Reverse(reversalParams(customer, deposit.ID, 100)); !errors.Is(err, repository.ErrWalletFrozen) {
+		return fmt.Errorf("reversing on a frozen wallet: got %v, want %v", err, repository.ErrWalletFrozen)
+	}
+	if _, err := repo.ForceReversal(reversalParams(customer, deposit.ID, 100), action); err != nil {
+		return fmt.Errorf("admin reversing on a frozen wallet: %w", err)
+	}
+	return expectBalance(repo, customer, 7400)
+}
+
+func checkReferenceUniqueness(repo repository.MiniWalletRepoInterface) error {
+	customer, err := newEnabledWallet(repo)
+	if err != nil {
+		return err
+	}
+
+	first := params(customer, 500)
+	repo.FailedTransaction(first, entity.TransactionTypeDeposit)
+	if _, err := repo.Deposit(first); err != nil {
+		return fmt.Errorf("a failed attempt blocks its reference: %w", err)
+	}
+	if _, err := repo.Deposit(first); !errors.Is(err, repository.ErrDuplicateReference) {
+		return fmt.Errorf("reusing a reference: got %v, want %v", err, repository.ErrDuplicateReference)
+	}
+	withdraw := params(customer, 100)
+	withdraw.ReferenceID = first.ReferenceID
+	if _, err := repo.Withdraw(withdraw); !errors.Is(err, repository.ErrDuplicateReference) {
+		return fmt.Errorf("reusing a deposit reference to withdraw: got %v, want %v", err, repository.ErrDuplicateReference)
+	}
+	return expectBalance(repo, customer, 500)
+}
+
+func checkTransfer(repo repository.MiniWalletRepoInterface) error {
+	source, err := newEnabledWallet(repo)
+	if err != nil {
+		return err
+	}
+	target, err := newEnabledWallet(repo)
+	if err != nil {
+		return err
+	}
+	if _, err := repo.Deposit(params(source, 1000)); err != nil {
+		return err
+	}
+
+	transfer, err := repo.Transfer(transferParams(source, target, 400))
+	if err != nil {
+		return err
+	}
+	if transfer.TransferID == "" || transfer.Debit.TransferID != transfer.TransferID || transfer.Credit.TransferID != transfer.TransferID {
+		return fmt.Errorf("transfer legs are not linked: %+v", transfer)
+	}
+	if err := expectBalance(repo, source, 600); err != nil {
+		return err
+	}
+	if err := expectBalance(repo, target, 400); err != nil {
+		return err
+	}
+
+	targetWallet, err := repo.FetchMiniWalletByID(target)
+	if err != nil {
+		return err
+	}
+	byWallet := transferParams(source, "", 100)
+	byWallet.ToWalletID = targetWallet.ID
+	if _, err := repo.Transfer(byWallet); err != nil {
+		return fmt.Errorf("transfer by wallet ID: %w", err)
+	}
+
+	failures := []struct {
+		params models.ParamsTransfer
+		want error
+	}{
+		{transferParams(source, target, 501), repository.ErrInsufficientBalance},
+		{transferParams(source, source, 1), repository.ErrSelfTransfer},
+		{transferParams(source, newUUID(), 1), repository.ErrTargetNotFound},
+	}
+	for _, f := range failures {
+		if _, err := repo.Transfer(f.params); !errors.Is(err, f.want) {
+			return fmt.Errorf("transfer %+v: got %v, want %v", f.params, err, f.want)
+		}
+	}
+
+	if _, err := repo.ChangeStatusOnMiniWallet(target, false); err != nil {
+		return err
+	}
+	if _, err := repo.Transfer(transferParams(source, target, 1)); !errors.Is(err, repository.ErrTargetDisabled) {
+		return fmt.Errorf("transfer to a disabled wallet: got %v, want %v", err, repository.ErrTargetDisabled)
+	}
+	return expectBalance(repo, source, 500)
+}
+
+func checkTransactionPages(repo repository.MiniWalletRepoInterface) error {
+	customer, err := newEnabledWallet(repo)
+	if err != nil {
+		return err
+	}
+	for i := 1; i <= 3; i++ {
+		if _, err := repo.Deposit(params(customer, money.Amount(i*100))); err != nil {
+			return err
+		}
+	}
+	repo.FailedTransaction(params(customer, 999), entity.TransactionTypeWithdraw)
+
+	filter := models.TransactionFilter{
+		CreatedBy: customer,
+		Limit: 2,
+		Status: "success",
+	}
+	first, next, err := repo.FetchTransactions(filter)
+	if err != nil {
+		return err
+	}
+	if len(first) != 2 || next == "" {
+		return fmt.Errorf("first page has %d transactions and cursor %q", len(first), next)
+	}
+	filter.After, err = models.DecodeTransactionCursor(next)
+	if err != nil {
+		return err
+	}
+	second, next, err := repo.FetchTransactions(filter)
+	if err != nil {
+		return err
+	}
+	if len(second) != 1 || next != "" {
+		return fmt.Errorf("last page has %d transactions and cursor %q", len(second), next)
+	}
+	seen := map[string]bool{}
+	for _, t := range append(first, second...) {
+		if seen[t.ID] {
+			return fmt.Errorf("transaction %s is on two pages", t.ID)
+		}
+		seen[t.ID] = true
+	}
+
+	minimum := money.Amount(200)
+	filtered, _, err := repo.FetchTransactions(models.TransactionFilter{
+		CreatedBy: customer,
+		Limit: 10,
+		MinAmount: &minimum,
+		Type: entity.TransactionTypeDeposit,
+	})
+	if err != nil {
+		return err
+	}
+	if len(filtered) != 2 {
+		return fmt.Errorf("amount filter returned %d transactions, want 2", len(filtered))
+	}
+	return nil
+}
+
+func checkIdempotentResponses(repo repository.MiniWalletRepoInterface) error {
+	reference := newUUID()
+	missing, err := repo.FetchIdempotentResponse(reference)
+	if err != nil {
+		return err
+	}
+	if missing != nil {
+		return errors.New("unknown reference has a stored response")
+	}
+
+	response := entity.IdempotentResponse{
+		ReferenceID: reference,
+		CustomerXId: newUUID(),
+		RequestType: entity.TransactionTypeDeposit,
+		StatusCode: 200,
+		Body: []byte(`{"status":"success"}`),
+	}
+	if err := repo.SaveIdempotentResponse(response); err != nil {
+		return err
+	}
+	second := response
+	second.StatusCode = 500
+	if err := repo.SaveIdempotentResponse(second); err != nil {
+		return err
+	}
+
+	stored, err := repo.FetchIdempotentResponse(reference)
+	if err != nil {
+		return err
+	}
+	if stored == nil || stored.StatusCode != 200 || stored.CustomerXId != response.CustomerXId {
+		return fmt.Errorf("stored response is %+v, want the first one saved", stored)
+	}
+	return nil
+}
+
+// checkBookedResponses makes sure the response of a request is stored with
+// its booking, and not at all when the request is refused.
+func checkBookedResponses(repo repository.MiniWalletRepoInterface) error {
+	source, err := newEnabledWallet(repo)
+	if err != nil {
+		return err
+	}
+	target, err := newEnabledWallet(repo)
+	if err != nil {
+		return err
+	}
+
+	deposit := params(source, 500)
+	deposit.Respond = respond(deposit.ReferenceID, source)
+	booked, err := repo.Deposit(deposit)
+	if err != nil {
+		return err
+	}
+	if err := expectResponse(repo, deposit.ReferenceID, booked.ID); err != nil {
+		return fmt.Errorf("deposit: %w", err)
+	}
+
+	refused := params(source, 900)
+	refused.Respond = respond(refused.ReferenceID, source)
+	if _, err := repo.Withdraw(refused); !errors.Is(err, repository.ErrInsufficientBalance) {
+		return fmt.Errorf("overdraft: got %v, want %v", err, repository.ErrInsufficientBalance)
+	}
+	if err := expectResponse(repo, refused.ReferenceID, ""); err != nil {
+		return fmt.Errorf("refused withdrawal: %w", err)
+	}
+
+	hold := params(source, 100)
+	hold.Respond = respond(hold.ReferenceID, source)
+	held, err := repo.HoldWithdrawal(hold, time.Now().Add(time.Hour))
+	if err != nil {
+		return err
+	}
+	if err := expectResponse(repo, hold.ReferenceID, held.ID); err != nil {
+		return fmt.Errorf("hold: %w", err)
+	}
+
+	transfer := transferParams(source, target, 100)
+	transfer.Respond = func(result models.TransferResult) (*entity.IdempotentResponse, error) {
+		return respond(transfer.ReferenceID, source)(*result.Debit)
+	}
+	result, err := repo.Transfer(transfer)
+	if err != nil {
+		return err
+	}
+	if err := expectResponse(repo, transfer.ReferenceID, result.Debit.ID); err != nil {
+		return fmt.Errorf("transfer: %w", err)
+	}
+
+	reversal := reversalParams(source, booked.ID, 50)
+	reversal.Respond = respond(reversal.ReferenceID, source)
+	reversed, err := repo.Reverse(reversal)
+	if err != nil {
+		return err
+	}
+	if err := expectResponse(repo, reversal.ReferenceID, reversed.ID); err != nil {
+		return fmt.Errorf("reversal: %w", err)
+	}
+	return nil
+}
+
+// respond stores the ID of the booked transaction as the response body.
+func respond(reference string, customer string) models.Respond {
+	return func(transaction entity.Transaction) (*entity.IdempotentResponse, error) {
+		return &entity.IdempotentResponse{
+			ReferenceID: reference,
+			CustomerXId: customer,
+			RequestType: transaction.Type,
+			StatusCode: 200,
+			Body: []byte(strconv.Quote(transaction.ID)),
+		}, nil
+	}
+}
+
+// expectResponse checks the response stored for the reference names the
+// transaction, or that there is none when transactionID is empty.
+func expectResponse(repo repository.MiniWalletRepoInterface, reference string, transactionID string) error {
+	stored, err := repo.FetchIdempotentResponse(reference)
+	if err != nil {
+		return err
+	}
+	if transactionID == "" {
+		if stored != nil {
+			return fmt.Errorf("response %s stored for a refused request", stored.Body)
+		}
+		return nil
+	}
+	if stored == nil {
+		return errors.New("no response stored")
+	}
+	if string(stored.Body) != strconv.Quote(transactionID) {
+		return fmt.Errorf("stored response is %s, want the one of %s", stored.Body, transactionID)
+	}
+	return nil
+}
+
+func checkLedger(repo repository.MiniWalletRepoInterface) error {
+	source, err := newEnabledWallet(repo)
+	if err != nil {
+		return err
+	}
+	target, err := newEnabledWallet(repo)
+	if err != nil {
+		return err
+	}
+	if _, err := repo.Deposit(params(source, 900)); err != nil {
+		return err
+	}
+	if _, err := repo.Withdraw(params(source, 100)); err != nil {
+		return err
+	}
+	if _, err := repo.Transfer(transferParams(source, target, 300)); err != nil {
+		return err
+	}
+
+	mismatches, err := repo.VerifyLedger()
+	if err != nil {
+		return err
+	}
+	for _, m := range mismatches {
+		if m.OwnedBy == source || m.OwnedBy == target {
+			return fmt.Errorf("ledger mismatch %+v", m)
+		}
+	}
+
+	drifts, err := repo.FetchBalanceDrifts()
+	if err != nil {
+		return err
+	}
+	seen := 0
+	for _, d := range drifts {
+		if d.OwnedBy != source && d.OwnedBy != target {
+			continue
+		}
+		seen++
+		if d.Drift != 0 {
+			return fmt.Errorf("balance drift %+v", d)
+		}
+	}
+	if seen != 2 {
+		return fmt.Errorf("reconciliation covered %d of 2 wallets", seen)
+	}
+	if _, err := repo.WriteAdjustment(source, currency); !errors.Is(err, repository.ErrNoDrift) {
+		return fmt.Errorf("adjusting a wallet without drift: got %v, want %v", err, repository.ErrNoDrift)
+	}
+	return nil
+}
+
+func checkWebhookOutbox(repo repository.MiniWalletRepoInterface) error {
+	customer, err := newEnabledWallet(repo)
+	if err != nil {
+		return err
+	}
+	subscription, err := repo.CreateWebhook(entity.WebhookSubscription{
+		CustomerXId: customer,
+		URL: "http://localhost/hook",
+		Events: []string{entity.EventDepositSucceeded, entity.EventWithdrawalFailed},
+		Secret: "secret",
+	})
+	if err != nil {
+		return err
+	}
+
+	deposit, err := repo.Deposit(params(customer, 500))
+	if err != nil {
+		return err
+	}
+	repo.FailedTransaction(params(customer, 900), entity.TransactionTypeWithdraw)
+	repo.FailedTransaction(params(customer, 900), entity.TransactionTypeDeposit)
+	if _, err := repo.ChangeStatusOnMiniWallet(customer, false); err != nil {
+		return err
+	}
+
+	deliveries, err := repo.FetchWebhookDeliveries(customer, subscription.ID, 10)
+	if err != nil {
+		return err
+	}
+	if len(deliveries) != 2 || deliveries[0].EventType != entity.EventWithdrawalFailed || deliveries[1].EventType != entity.EventDepositSucceeded {
+		return fmt.Errorf("outbox holds %+v, want a withdrawal.failed and a deposit.succeeded", deliveries)
+	}
+	if !strings.Contains(string(deliveries[1].Payload), deposit.ID) || deliveries[1].Status != entity.WebhookStatusPending {
+		return fmt.Errorf("deposit delivery is %+v", deliveries[1])
+	}
+
+	if err := repo.DeleteWebhook(customer, subscription.ID); err != nil {
+		return err
+	}
+	if err := repo.DeleteWebhook(customer, subscription.ID); !errors.Is(err, repository.ErrWebhookNotFound) {
+		return fmt.Errorf("deleting twice: got %v, want %v", err, repository.ErrWebhookNotFound)
+	}
+	deliveries, err = repo.FetchWebhookDeliveries(customer, subscription.ID, 10)
+	if err != nil {
+		return err
+	}
+	for _, d := range deliveries {
+		if d.Status != entity.WebhookStatusFailed {
+			return fmt.Errorf("delivery of a deleted subscription is %+v", d)
+		}
+	}
+	return nil
+}
+
+func checkEventLog(repo repository.MiniWalletRepoInterface) error {
+	customer, err := newEnabledWallet(repo)
+	if err != nil {
+		return err
+	}
+	if _, err := repo.CreateMiniWallet(customer); err != nil {
+		return err
+	}
+	if _, err := repo.Deposit(params(customer, 500)); err != nil {
+		return err
+	}
+	repo.FailedTransaction(params(customer, 900), entity.TransactionTypeWithdraw)
+	if _, err := repo.Withdraw(params(customer, 200)); err != nil {
+		return err
+	}
+	target, err := newEnabledWallet(repo)
+	if err != nil {
+		return err
+	}
+	if _, err := repo.Transfer(transferParams(customer, target, 100)); err != nil {
+		return err
+	}
+	voided, err := repo.HoldWithdrawal(params(customer, 50), time.Now().Add(time.Hour))
+	if err != nil {
+		return err
+	}
+	if _, err := repo.VoidWithdrawal(customer, voided.ID); err != nil {
+		return err
+	}
+	if _, err := repo.HoldWithdrawal(params(customer, 50), time.Now().Add(-time.Second)); err != nil {
+		return err
+	}
+	if _, err := repo.ExpireHolds(time.Now()); err != nil {
+		return err
+	}
+	if _, err := repo.ChangeStatusOnMiniWallet(customer, false); err != nil {
+		return err
+	}
+
+	events, err := repo.FetchEvents(customer, 0, 20)
+	if err != nil {
+		return err
+	}
+	want := []string{
+		entity.EventWalletCreated,
+		entity.EventWalletEnabled,
+		entity.EventDepositSucceeded,
+		entity.EventWithdrawalSucceeded,
+		entity.EventTransferSent,
+		entity.EventWithdrawalHeld,
+		entity.EventWithdrawalVoided,
+		entity.EventWithdrawalHeld,
+		entity.EventWithdrawalExpired,
+		entity.EventWalletDisabled,
+	}
+	if err := expectEvents(events, customer, want); err != nil {
+		return err
+	}
+	received, err := repo.FetchEvents(target, 0, 20)
+	if err != nil {
+		return err
+	}
+	err = expectEvents(received, target, []string{entity.EventWalletCreated, entity.EventWalletEnabled, entity.EventTransferReceived})
+	if err != nil {
+		return fmt.Errorf("transfer target: %w", err)
+	}
+
+	resumed, err := repo.FetchEvents(customer, events[2].ID, 20)
+	if err != nil {
+		return err
+	}
+	if len(resumed) != len(events)-3 || resumed[0].ID != events[3].ID {
+		return fmt.Errorf("resuming after %d returned %+v", events[2].ID, resumed)
+	}
+	latest, err := repo.LatestEventID(customer)
+	if err != nil {
+		return err
+	}
+	if last := events[len(events)-1].ID; latest != last {
+		return fmt.Errorf("latest event is %d, want %d", latest, last)
+	}
+	return nil
+}
+
+// expectEvents checks that events are the customer's, of the wanted types in
+// order, with increasing IDs.
+func expectEvents(events []entity.WalletEvent, customer string, want []string) error {
+	if len(events) != len(want) {
+		return fmt.Errorf("got %d events, want %d", len(events), len(want))
+	}
+	for i, event := range events {
+		if event.Type != want[i] || event.CustomerXId != customer {
+			return fmt.Errorf("event %d is %+v, want a %s", i, event, want[i])
+		}
+		if i > 0 && event.ID <= events[i-1].ID {
+			return fmt.Errorf("event IDs %d and %d are not increasing", events[i-1].ID, event.ID)
+		}
+	}
+	return nil
+}
+
+func checkAdminActions(repo repository.MiniWalletRepoInterface) error {
+	customer, err := newEnabledWallet(repo)
+	if err != nil {
+		return err
+	}
+	action := entity.AdminAction{Actor: "ops", Reason: "check"}
+
+	wallets, err := repo.SearchWallets(customer[:8], 100)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, w := range wallets {
+		found = found || w.OwnedBy == customer
+	}
+	if !found {
+		return fmt.Errorf("searching %q did not find %s", customer[:8], customer)
+	}
+
+	disable := transition(customer, entity.WalletStatusDisabled, entity.ActorAdmin)
+	wallet, err := repo.ForceWalletStatus(disable, action)
+	if err != nil {
+		return err
+	}
+	if wallet.IsEnabled {
+		return fmt.Errorf("forced disable left the wallet enabled")
+	}
+	if _, err := repo.ForceWalletStatus(disable, action); !errors.Is(err, repository.ErrAlreadyDisabled) {
+		return fmt.Errorf("disabling twice: got %v, want %v", err, repository.ErrAlreadyDisabled)
+	}
+
+	// Adjustments apply to disabled wallets too.
+	credit, err := repo.AdjustBalance(adjustmentParams(customer, 700), action)
+	if err != nil {
+		return err
+	}
+	if credit.Type != entity.TransactionTypeAdjustment || credit.SignedAmount() != 700 {
+		return fmt.Errorf("credit is %+v", credit)
+	}
+	if _, err := repo.AdjustBalance(adjustmentParams(customer, -200), action); err != nil {
+		return err
+	}
+	if _, err := repo.AdjustBalance(adjustmentParams(customer, -600), action); !errors.Is(err, repository.ErrInsufficientBalance) {
+		return fmt.Errorf("overdrawing adjustment: got %v, want %v", err, repository.ErrInsufficientBalance)
+	}
+	duplicate := adjustmentParams(customer, 1)
+	duplicate.ReferenceID = credit.ReferenceID
+	if _, err := repo.AdjustBalance(duplicate, action); !errors.Is(err, repository.ErrDuplicateReference) {
+		return fmt.Errorf("reused reference: got %v, want %v", err, repository.ErrDuplicateReference)
+	}
+	if err := expectBalance(repo, customer, 500); err != nil {
+		return err
+	}
+	return repo.RecordAdminAction(action)
+}
+
+func checkLifecycle(repo repository.MiniWalletRepoInterface) error {
+	customer, err := newEnabledWallet(repo)
+	if err != nil {
+		return err
+	}
+	action := entity.AdminAction{Actor: "ops", Reason: "check"}
+
+	if _, err := repo.TransitionWallet(transition(customer, entity.WalletStatusFrozen, entity.ActorCustomer)); !errors.Is(err, repository.ErrInvalidTransition) {
+		return fmt.Errorf("customer freezing: got %v, want %v", err, repository.ErrInvalidTransition)
+	}
+	freeze := transition(customer, entity.WalletStatusFrozen, entity.ActorAdmin)
+	frozen, err := repo.ForceWalletStatus(freeze, action)
+	if err != nil {
+		return err
+	}
+	if frozen.Status != entity.WalletStatusFrozen || frozen.IsEnabled {
+		return fmt.Errorf("frozen wallet is %s, enabled %v", frozen.Status, frozen.IsEnabled)
+	}
+	if _, err := repo.ForceWalletStatus(freeze, action); !errors.Is(err, repository.ErrAlreadyFrozen) {
+		return fmt.Errorf("freezing twice: got %v, want %v", err, repository.ErrAlreadyFrozen)
+	}
+	if _, err := repo.ChangeStatusOnMiniWallet(customer, true); !errors.Is(err, repository.ErrWalletFrozen) {
+		return fmt.Errorf("customer lifting a freeze: got %v, want %v", err, repository.ErrWalletFrozen)
+	}
+	if _, err := repo.ForceWalletStatus(transition(customer, entity.WalletStatusActive, entity.ActorAdmin), action); err != nil {
+		return err
+	}
+
+	if _, err := repo.Deposit(params(customer, 900)); err != nil {
+		return err
+	}
+	hold, err := repo.HoldWithdrawal(params(customer, 400), time.Now().Add(time.Hour))
+	if err != nil {
+		return err
+	}
+	closing := transition(customer, entity.WalletStatusClosed, entity.ActorCustomer)
+	closing.Sweep = true
+	if _, err := repo.TransitionWallet(closing); !errors.Is(err, repository.ErrPendingWithdrawals) {
+		return fmt.Errorf("closing with a pending withdrawal: got %v, want %v", err, repository.ErrPendingWithdrawals)
+	}
+	if _, err := repo.VoidWithdrawal(customer, hold.ID); err != nil {
+		return err
+	}
+	closing.Sweep = false
+	if _, err := repo.TransitionWallet(closing); !errors.Is(err, repository.ErrBalanceNotZero) {
+		return fmt.Errorf("closing with a balance: got %v, want %v", err, repository.ErrBalanceNotZero)
+	}
+	closing.Sweep = true
+	closed, err := repo.TransitionWallet(closing)
+	if err != nil {
+		return err
+	}
+	if closed.Status != entity.WalletStatusClosed || closed.Balance(currency) != 0 {
+		return fmt.Errorf("closed wallet is %s with %s", closed.Status, closed.Balance(currency).String(currency))
+	}
+	if _, err := repo.ForceWalletStatus(transition(customer, entity.WalletStatusActive, entity.ActorAdmin), action); !errors.Is(err, repository.ErrWalletClosed) {
+		return fmt.Errorf("reopening: got %v, want %v", err, repository.ErrWalletClosed)
+	}
+	if _, err := repo.AdjustBalance(adjustmentParams(customer, 100), action); !errors.Is(err, repository.ErrWalletClosed) {
+		return fmt.Errorf("adjusting a closed wallet: got %v, want %v", err, repository.ErrWalletClosed)
+	}
+
+	transitions, err := repo.FetchWalletTransitions(customer)
+	if err != nil {
+		return err
+	}
+	want := []string{
+		entity.WalletStatusDisabled, entity.WalletStatusActive,
+		entity.WalletStatusActive, entity.WalletStatusFrozen,
+		entity.WalletStatusFrozen, entity.WalletStatusActive,
+		entity.WalletStatusActive, entity.WalletStatusClosed,
+	}
+	if len(transitions) != len(want)/2 {
+		return fmt.Errorf("got %d transitions, want %d", len(transitions), len(want)/2)
+	}
+	for i, t := range transitions {
+		if t.FromStatus != want[2*i] || t.ToStatus != want[2*i+1] {
+			return fmt.Errorf("transition %d is %s -> %s, want %s -> %s", i, t.FromStatus, t.ToStatus, want[2*i], want[2*i+1])
+		}
+	}
+	if transitions[1].ActorType != entity.ActorAdmin || transitions[1].Actor != "ops" || transitions[1].Reason != "check" {
+		return fmt.Errorf("freeze was recorded as %+v", transitions[1])
+	}
+	return nil
+}
+
+// checkInactiveWallets uses wallets the handlers saw as active but that were
+// disabled, frozen or closed since, so only the backend can refuse.
+func checkInactiveWallets(repo repository.MiniWalletRepoInterface) error {
+	action := entity.AdminAction{Actor: "ops", Reason: "check"}
+	for _, c := range []struct {
+		status string
+		want error
+	}{
+		{entity.WalletStatusDisabled, repository.ErrWalletDisabled},
+		{entity.WalletStatusFrozen, repository.ErrWalletFrozen},
+		{entity.WalletStatusClosed, repository.ErrWalletClosed},
+	} {
+		customer, err := newEnabledWallet(repo)
+		if err != nil {
+			return err
+		}
+		if _, err := repo.Deposit(params(customer, 900)); err != nil {
+			return err
+		}
+		hold, err := repo.HoldWithdrawal(params(customer, 100), time.Now().Add(time.Hour))
+		if err != nil {
+			return err
+		}
+		if c.status == entity.WalletStatusClosed {
+			if _, err := repo.VoidWithdrawal(customer, hold.ID); err != nil {
+				return err
+			}
+			if _, err := repo.Withdraw(params(customer, 900)); err != nil {
+				return err
+			}
+		}
+		if _, err := repo.ForceWalletStatus(transition(customer, c.status, entity.ActorAdmin), action); err != nil {
+			return err
+		}
+		target, err := newEnabledWallet(repo)
+		if err != nil {
+			return err
+		}
+
+		if _, err := repo.Deposit(params(customer, 100)); !errors.Is(err, c.want) {
+			return fmt.Errorf("deposit to a %s wallet: got %v, want %v", c.status, err, c.want)
+		}
+		if _, err := repo.Withdraw(params(customer, 100)); !errors.Is(err, c.want) {
+			return fmt.Errorf("withdrawal from a %s wallet: got %v, want %v", c.status, err, c.want)
+		}
+		if _, err := repo.HoldWithdrawal(params(customer, 100), time.Now().Add(time.Hour)); !errors.Is(err, c.want) {
+			return fmt.Errorf("hold on a %s wallet: got %v, want %v", c.status, err, c.want)
+		}
+		if _, err := repo.Transfer(transferParams(customer, target, 100)); !errors.Is(err, c.want) {
+			return fmt.Errorf("transfer from a %s wallet: got %v, want %v", c.status, err, c.want)
+		}
+		if c.status == entity.WalletStatusClosed {
+			continue
+		}
+		if _, err := repo.CaptureWithdrawal(customer, hold.ID); !errors.Is(err, c.want) {
+			return fmt.Errorf("capture on a %s wallet: got %v, want %v", c.status, err, c.want)
+		}
+		if _, err := repo.VoidWithdrawal(customer, hold.ID); err != nil {
+			return fmt.Errorf("void on a %s wallet: %w", c.status, err)
+		}
+	}
+	return nil
+}
+
+// checkFrozenHolds checks that a frozen wallet's holds can still be voided
+// and expire, giving the funds back without lifting the freeze.
+func checkFrozenHolds(repo repository.MiniWalletRepoInterface) error {
+	customer, err := newEnabledWallet(repo)
+	if err != nil {
+		return err
+	}
+	if _, err := repo.Deposit(params(customer, 1000)); err != nil {
+		return err
+	}
+	voided, err := repo.HoldWithdrawal(params(customer, 300), time.Now().Add(time.Hour))
+	if err != nil {
+		return err
+	}
+	stale, err := repo.HoldWithdrawal(params(customer, 200), time.Now().Add(-time.Second))
+	if err != nil {
+		return err
+	}
+	action := entity.AdminAction{Actor: "ops", Reason: "check"}
+	if _, err := repo.ForceWalletStatus(transition(customer, entity.WalletStatusFrozen, entity.ActorAdmin), action); err != nil {
+		return err
+	}
+
+	released, err := repo.VoidWithdrawal(customer, voided.ID)
+	if err != nil {
+		return fmt.Errorf("voiding a hold of a frozen wallet: %w", err)
+	}
+	if released.Status != entity.TransactionStatusVoided {
+		return fmt.Errorf("void returned %+v", released)
+	}
+	if err := expectAvailable(repo, customer, 1000, 800); err != nil {
+		return err
+	}
+	if _, err := repo.ExpireHolds(time.Now()); err != nil {
+		return err
+	}
+	if _, err := repo.VoidWithdrawal(customer, stale.ID); !errors.Is(err, repository.ErrHoldNotPending) {
+		return fmt.Errorf("voiding an expired hold of a frozen wallet: got %v, want %v", err, repository.ErrHoldNotPending)
+	}
+	if err := expectAvailable(repo, customer, 1000, 1000); err != nil {
+		return err
+	}
+	wallet, err := repo.FetchMiniWalletByID(customer)
+	if err != nil {
+		return err
+	}
+	if wallet.Status != entity.WalletStatusFrozen {
+		return fmt.Errorf("wallet is %s after releasing its holds, want %s", wallet.Status, entity.WalletStatusFrozen)
+	}
+	return nil
+}
+
+func checkAuditChain(repo repository.MiniWalletRepoInterface) error {
+	customer := newUUID()
+	var appended []*entity.AuditEntry
+	for _, action := range []string{"POST /init", "POST /wallet", "PATCH /wallet"} {
+		entry, err := repo.AppendAudit(entity.AuditEntry{
+			ActorType: entity.ActorCustomer,
+			Actor: customer,
+			Action: action,
+			CustomerXId: customer,
+			After: []byte(`{"status":"enabled"}`),
+			StatusCode: 200,
+			RequestID: newUUID(),
+			ClientIP: "127.0.0.1",
+		})
+		if err != nil {
+			return err
+		}
+		if entry.Hash != entry.ComputeHash() {
+			return fmt.Errorf("entry %d has hash %s, want %s", entry.ID, entry.Hash, entry.ComputeHash())
+		}
+		appended = append(appended, entry)
+	}
+	if appended[1].PrevHash != appended[0].Hash || appended[2].PrevHash != appended[1].Hash {
+		return fmt.Errorf("entries are not chained: %+v", appended)
+	}
+
+	entries, err := repo.FetchAuditEntries(models.AuditFilter{CustomerXId: customer, AfterID: appended[0].ID, Limit: 10})
+	if err != nil {
+		return err
+	}
+	if len(entries) != 2 || entries[0].Hash != appended[1].Hash || entries[0].ComputeHash() != entries[0].Hash {
+		return fmt.Errorf("fetching after %d returned %+v", appended[0].ID, entries)
+	}
+
+	verification, err := repo.VerifyAudit()
+	if err != nil {
+		return err
+	}
+	if !verification.Valid || verification.LastHash != appended[2].Hash {
+		return fmt.Errorf("verification is %+v, want a valid chain ending in %s", verification, appended[2].Hash)
+	}
+	return nil
+}
+
+func checkRefreshTokens(repo repository.MiniWalletRepoInterface) error {
+	customer := newUUID()
+	now := time.Now()
+
+	first := refreshToken(customer, now, time.Hour)
+	if err := repo.CreateRefreshToken(first); err != nil {
+		return err
+	}
+	// Issued later, so its own expiry is after the family's.
+	second := refreshToken("", now.Add(30*time.Minute), time.Hour)
+	rotated, err := repo.RotateRefreshToken(first.TokenHash, second, now)
+	if err != nil {
+		return err
+	}
+	if rotated.CustomerXId != customer || rotated.FamilyID != first.FamilyID {
+		return fmt.Errorf("rotated token is %+v, want customer %s in family %s", rotated, customer, first.FamilyID)
+	}
+	if !rotated.ExpiresAt.Equal(first.ExpiresAt) {
+		return fmt.Errorf("rotated token expires at %v, want the family's %v", rotated.ExpiresAt, first.ExpiresAt)
+	}
+	if _, err := repo.RotateRefreshToken(first.TokenHash, refreshToken("", now, time.Hour), now); !errors.Is(err, repository.ErrRefreshTokenReused) {
+		return fmt.Errorf("reusing a rotated token: got %v, want %v", err, repository.ErrRefreshTokenReused)
+	}
+	for _, jti := range []string{first.AccessJTI, second.AccessJTI} {
+		revoked, err := repo.IsTokenRevoked(jti)
+		if err != nil {
+			return err
+		}
+		if !revoked {
+			return fmt.Errorf("access token %s survived the reuse of its family", jti)
+		}
+	}
+	if _, err := repo.RotateRefreshToken(second.TokenHash, refreshToken("", now, time.Hour), now); !errors.Is(err, repository.ErrInvalidRefreshToken) {
+		return fmt.Errorf("rotating a revoked token: got %v, want %v", err, repository.ErrInvalidRefreshToken)
+	}
+	if _, err := repo.RotateRefreshToken(newUUID(), refreshToken("", now, time.Hour), now); !errors.Is(err, repository.ErrInvalidRefreshToken) {
+		return fmt.Errorf("rotating an unknown token: got %v, want %v", err, repository.ErrInvalidRefreshToken)
+	}
+
+	session := refreshToken(customer, now, time.Hour)
+	if err := repo.CreateRefreshToken(session); err != nil {
+		return err
+	}
+	if err := repo.RevokeSession(session.AccessJTI, customer, session.AccessExpiresAt, now); err != nil {
+		return err
+	}
+	if revoked, err := repo.IsTokenRevoked(session.AccessJTI); err != nil || !revoked {
+		return fmt.Errorf("logged out access token: revoked %v, error %v", revoked, err)
+	}
+	if _, err := repo.RotateRefreshToken(session.TokenHash, refreshToken("", now, time.Hour), now); !errors.Is(err, repository.ErrInvalidRefreshToken) {
+		return fmt.Errorf("rotating after logout: got %v, want %v", err, repository.ErrInvalidRefreshToken)
+	}
+
+	expired := refreshToken(customer, now, -time.Minute)
+	if err := repo.CreateRefreshToken(expired); err != nil {
+		return err
+	}
+	if _, err := repo.RotateRefreshToken(expired.TokenHash, refreshToken("", now, time.Hour), now); !errors.Is(err, repository.ErrInvalidRefreshToken) {
+		return fmt.Errorf("rotating an expired token: got %v, want %v", err, repository.ErrInvalidRefreshToken)
+	}
+	if err := repo.RevokeSession(expired.AccessJTI, customer, expired.AccessExpiresAt, now); err != nil {
+		return err
+	}
+	purged, err := repo.PurgeExpiredTokens(now)
+	if err != nil {
+		return err
+	}
+	if purged < 2 {
+		return fmt.Errorf("purged %d tokens, want at least 2", purged)
+	}
+	if revoked, err := repo.IsTokenRevoked(expired.AccessJTI); err != nil || revoked {
+		return fmt.Errorf("expired revocation: revoked %v, error %v", revoked, err)
+	}
+	return nil
+}
+
+func newEnabledWallet(repo repository.MiniWalletRepoInterface) (string, error) {
+	customer := newUUID()
+	if _, err := repo.CreateMiniWallet(customer); err != nil {
+		return "", err
+	}
+	if _, err := repo.ChangeStatusOnMiniWallet(customer, true); err != nil {
+		return "", err
+	}
+	return customer, nil
+}
+
+func expectBalance(repo repository.MiniWalletRepoInterface, customer string, want money.Amount) error {
+	wallet, err := repo.FetchMiniWalletByID(customer)
+	if err != nil {
+		return err
+	}
+	if got := wallet.Balance(currency); got != want {
+		return fmt.Errorf("balance of %s is %s, want %s", customer, got.String(currency), want.String(currency))
+	}
+	return nil
+}
+
+func expectAvailable(repo repository.MiniWalletRepoInterface, customer string, balance money.Amount, available money.Amount) error {
+	if err := expectBalance(repo, customer, balance); err != nil {
+		return err
+	}
+	wallet, err := repo.FetchMiniWalletByID(customer)
+	if err != nil {
+		return err
+	}
+	if got := wallet.Available(currency); got != available {
+		return fmt.Errorf("available balance of %s is %s, want %s", customer, got.String(currency), available.String(currency))
+	}
+	return nil
+}
+
+func params(customer string, amount money.Amount) models.ParamsWallet {
+	return models.ParamsWallet{
+		Amount: amount,
+		Currency: currency,
+		ReferenceID: newUUID(),
+		CreatedBy: customer,
+	}
+}
+
+func checkAPIClients(repo repository.MiniWalletRepoInterface) error {
+	action := entity.AdminAction{Actor: "ops", Reason: "check"}
+	partner, err := repo.CreateAPIClient(apiClient("partner"), action)
+	if err != nil {
+		return err
+	}
+	other, err := repo.CreateAPIClient(apiClient("other"), action)
+	if err != nil {
+		return err
+	}
+	fetched, err := repo.FetchAPIClient(partner.ID)
+	if err != nil {
+		return err
+	}
+	if fetched.Name != "partner" || fetched.SecretHash != partner.SecretHash {
+		return fmt.Errorf("fetched client is %+v, want %+v", fetched, partner)
+	}
+	if _, err := repo.FetchAPIClient(newUUID()); !errors.Is(err, repository.ErrClientNotFound) {
+		return fmt.Errorf("fetching an unknown client: got %v, want %v", err, repository.ErrClientNotFound)
+	}
+
+	customer := newUUID()
+	if err := repo.ClaimCustomer(partner.ID, customer); err != nil {
+		return err
+	}
+	if err := repo.ClaimCustomer(partner.ID, customer); err != nil {
+		return fmt.Errorf("claiming an own customer again: %w", err)
+	}
+	if err := repo.ClaimCustomer(other.ID, customer); !errors.Is(err, repository.ErrCustomerNotInScope) {
+		return fmt.Errorf("claiming another client's customer: got %v, want %v", err, repository.ErrCustomerNotInScope)
+	}
+
+	// Wallets opened before any client claimed them need an admin.
+	legacy := newUUID()
+	if _, err := repo.CreateMiniWallet(legacy); err != nil {
+		return err
+	}
+	if err := repo.ClaimCustomer(partner.ID, legacy); !errors.Is(err, repository.ErrCustomerNotInScope) {
+		return fmt.Errorf("claiming an unassigned wallet: got %v, want %v", err, repository.ErrCustomerNotInScope)
+	}
+	if err := repo.AssignCustomer(partner.ID, legacy, action); err != nil {
+		return err
+	}
+	if err := repo.ClaimCustomer(partner.ID, legacy); err != nil {
+		return fmt.Errorf("claiming an assigned wallet: %w", err)
+	}
+	if err := repo.AssignCustomer(other.ID, customer, action); err != nil {
+		return err
+	}
+	if err := repo.ClaimCustomer(partner.ID, customer); !errors.Is(err, repository.ErrCustomerNotInScope) {
+		return fmt.Errorf("claiming a reassigned customer: got %v, want %v", err, repository.ErrCustomerNotInScope)
+	}
+
+	now := time.Now()
+	session := refreshToken(customer, now, time.Hour)
+	session.ClientID = other.ID
+	partnerSession := refreshToken(legacy, now, time.Hour)
+	partnerSession.ClientID = partner.ID
+	for _, t := range []entity.RefreshToken{session, partnerSession} {
+		if err := repo.CreateRefreshToken(t); err != nil {
+			return err
+		}
+	}
+
+	revoked, err := repo.RevokeAPIClient(other.ID, now, action)
+	if err != nil {
+		return err
+	}
+	if revoked.RevokedAt.IsZero() {
+		return fmt.Errorf("revoked client is %+v", revoked)
+	}
+	// Revoking the client ends the sessions it opened, and only those.
+	if ok, err := repo.IsTokenRevoked(session.AccessJTI); err != nil || !ok {
+		return fmt.Errorf("access token of a revoked client: revoked %v, %v", ok, err)
+	}
+	if _, err := repo.RotateRefreshToken(session.TokenHash, refreshToken(customer, now, time.Hour), now); !errors.Is(err, repository.ErrInvalidRefreshToken) {
+		return fmt.Errorf("refreshing a session of a revoked client: got %v, want %v", err, repository.ErrInvalidRefreshToken)
+	}
+	late := refreshToken(customer, now, time.Hour)
+	late.ClientID = other.ID
+	if err := repo.CreateRefreshToken(late); err != nil {
+		return err
+	}
+	if _, err := repo.RotateRefreshToken(late.TokenHash, refreshToken(customer, now, time.Hour), now); !errors.Is(err, repository.ErrInvalidRefreshToken) {
+		return fmt.Errorf("refreshing a session opened after the revocation: got %v, want %v", err, repository.ErrInvalidRefreshToken)
+	}
+	if ok, err := repo.IsTokenRevoked(partnerSession.AccessJTI); err != nil || ok {
+		return fmt.Errorf("access token of another client: revoked %v, %v", ok, err)
+	}
+	rotated, err := repo.RotateRefreshToken(partnerSession.TokenHash, refreshToken(legacy, now, time.Hour), now)
+	if err != nil {
+		return fmt.Errorf("refreshing a session of another client: %w", err)
+	}
+	if rotated.ClientID != partner.ID {
+		return fmt.Errorf("rotated token belongs to client %q, want %q", rotated.ClientID, partner.ID)
+	}
+	if _, err := repo.RevokeAPIClient(other.ID, time.Now(), action); !errors.Is(err, repository.ErrClientRevoked) {
+		return fmt.Errorf("revoking twice: got %v, want %v", err, repository.ErrClientRevoked)
+	}
+	if err := repo.AssignCustomer(other.ID, newUUID(), action); !errors.Is(err, repository.ErrClientRevoked) {
+		return fmt.Errorf("assigning to a revoked client: got %v, want %v", err, repository.ErrClientRevoked)
+	}
+	if err := repo.AssignCustomer(newUUID(), newUUID(), action); !errors.Is(err, repository.ErrClientNotFound) {
+		return fmt.Errorf("assigning to an unknown client: got %v, want %v", err, repository.ErrClientNotFound)
+	}
+	return nil
+}
+
+func apiClient(name string) entity.APIClient {
+	return entity.APIClient{
+		ID: newUUID(),
+		Name: name,
+		SecretHash: strings.ReplaceAll(newUUID()+newUUID(), "-", ""),
+		CreatedAt: time.Now(),
+	}
+}
+
+// refreshToken is a token of a new family whose access and refresh tokens
+// expire after ttl.
+func refreshToken(customer string, now time.Time, ttl time.Duration) entity.RefreshToken {
+	id := newUUID()
+	return entity.RefreshToken{
+		ID: id,
+		FamilyID: id,
+		CustomerXId: customer,
+		TokenHash: strings.ReplaceAll(newUUID()+newUUID(), "-", ""),
+		AccessJTI: newUUID(),
+		AccessExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+}
+
+func transition(customer string, to string, actorType string) models.ParamsTransition {
+	actor := customer
+	if actorType == entity.ActorAdmin {
+		actor = "ops"
+	}
+	return models.ParamsTransition{
+		CustomerXId: customer,
+		To: to,
+		ActorType: actorType,
+		Actor: actor,
+		Reason: "check",
+	}
+}
+
+func adjustmentParams(customer string, amount money.Amount) models.ParamsAdjustment {
+	return models.ParamsAdjustment{
+		Amount: amount,
+		Currency: currency,
+		ReferenceID: newUUID(),
+		CreatedBy: customer,
+	}
+}
+
+func reversalParams(customer string, transactionID string, amount money.Amount) models.ParamsReversal {
+	return models.ParamsReversal{
+		TransactionID: transactionID,
+		Amount: amount,
+		Currency: currency,
+		ReferenceID: newUUID(),
+		CreatedBy: customer,
+	}
+}
+
+func transferParams(source string, target string, amount money.Amount) models.ParamsTransfer {
+	return models.ParamsTransfer{
+		Amount: amount,
+		Currency: currency,
+		ReferenceID: newUUID(),
+		CreatedBy: source,
+		ToCustomerXId: target,
+	}
+}
+
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"github.com/go-pg/pg/v10"
+	"github.com/Sigaeasu/go-mwe/models"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/models/money"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
+)
+
+var (
+	ErrTransactionNotFound = apperror.New(apperror.CodeTransactionNotFound, "Transaction not found")
+	ErrNotReversible = apperror.New(apperror.CodeNotReversible, "Only booked deposits and withdrawals can be reversed")
+	ErrReversalExceedsOriginal = apperror.New(apperror.CodeReversalExceedsOriginal, "Reversal is larger than what is left of the transaction")
+	ErrCurrencyMismatch = apperror.New(apperror.CodeCurrencyMismatch, "Currency does not match the transaction")
+	ErrReversalNotAllowed = apperror.New(apperror.CodeReversalNotAllowed, "Only operations staff can reverse a withdrawal")
+)
+
+// Reverse is the customer undoing one of their own deposits, which takes the
+// money out like a withdrawal: the wallet must be active and the withdraw
+// limits apply. Withdrawals were paid out already, so only ForceReversal
+// can put them back.
+func (pdb *miniWalletDatabase) Reverse(params models.ParamsReversal) (*entity.Transaction, error) {
+	return pdb.reverse(params, nil)
+}
+
+// ForceReversal undoes a deposit or withdrawal of any wallet that is not
+// closed, whatever the limits, and writes the admin action in the same
+// transaction.
+func (pdb *miniWalletDatabase) ForceReversal(params models.ParamsReversal, action entity.AdminAction) (*entity.Transaction, error) {
+	return pdb.reverse(params, &action)
+}
+
+// reverse writes a reversal row linked to one of the customer's deposits or
+// withdrawals and moves the balance and the ledger back by its amount. The
+// original row is locked so concurrent reversals cannot together exceed it.
+// action is nil when the customer asked.
+func (pdb *miniWalletDatabase) reverse(params models.ParamsReversal, action *entity.AdminAction) (*entity.Transaction, error) {
+	var transaction *entity.Transaction
+	err := pdb.dbConn.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		wallet, err := lockMiniWallet(tx, params.CreatedBy)
+		if err != nil {
+			return err
+		}
+		if err := checkReversible(wallet, action); err != nil {
+			return err
+		}
+		var original entity.Transaction
+		err = tx.Model(&original).
+			Where("id = ?", params.TransactionID).
+			Where("created_by = ?", params.CreatedBy).
+			For("UPDATE").
+			Select()
+		if err != nil {
+			if err == pg.ErrNoRows {
+				return ErrTransactionNotFound
+			}
+			return err
+		}
+		var reversed money.Amount
+		err = tx.Model((*entity.Transaction)(nil)).
+			ColumnExpr("COALESCE(SUM(amount), 0)").
+			Where("reversal_of = ?", original.ID).
+			Where("status = ?", entity.TransactionStatusSuccess).
+			Select(&reversed)
+		if err != nil {
+			return err
+		}
+
+		reversal, err := buildReversal(original, reversed, params, action != nil)
+		if err != nil {
+			return err
+		}
+		if action == nil {
+			err = checkLimits(tx, pdb.limits, reversalLimitParams(reversal), entity.TransactionTypeWithdraw)
+			if err != nil {
+				return err
+			}
+		}
+		if reversal.Amount < 0 {
+			err = debitBalance(tx, wallet.ID, reversal.Currency, -reversal.Amount)
+		} else {
+			err = changeBalance(tx, wallet.ID, reversal.Currency, reversal.Amount)
+		}
+		if err != nil {
+			return err
+		}
+		transaction, err = insertTransaction(tx, reversal)
+		if err != nil {
+			return err
+		}
+		err = postJournal(tx, "reversal", transaction.ID, reversal.Currency,
+			walletLeg(wallet.ID, reversal.Amount),
+			systemLeg(reversalAccount(original), -reversal.Amount),
+		)
+		if err != nil {
+			return err
+		}
+		if action != nil {
+			if err := insertAdminAction(tx, *action); err != nil {
+				return err
+			}
+		}
+		err = publishEvent(tx, wallet, entity.EventTransactionReversed, models.NewTransactionEventData(*transaction))
+		if err != nil {
+			return err
+		}
+		return saveResponse(tx, params.Respond, *transaction)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// checkReversible refuses customers whose wallet is not active, and anyone
+// once the wallet is closed.
+func checkReversible(wallet *entity.Wallet, action *entity.AdminAction) error {
+	if action == nil {
+		return CheckActive(wallet)
+	}
+	if wallet.Status == entity.WalletStatusClosed {
+		return ErrWalletClosed
+	}
+	return nil
+}
+
+// buildReversal checks a reversal against the original transaction and the
+// signed sum of its earlier reversals, and returns the row to insert.
+func buildReversal(original entity.Transaction, reversed money.Amount, params models.ParamsReversal, admin bool) (entity.Transaction, error) {
+	if !original.Booked() || (original.Type != entity.TransactionTypeDeposit && original.Type != entity.TransactionTypeWithdraw) {
+		return entity.Transaction{}, ErrNotReversible
+	}
+	if original.Type == entity.TransactionTypeWithdraw && !admin {
+		return entity.Transaction{}, ErrReversalNotAllowed
+	}
+	if params.Amount != 0 && params.Currency != original.Currency {
+		return entity.Transaction{}, ErrCurrencyMismatch
+	}
+
+	// Reversals have the opposite sign of the original's effect.
+	sign := money.Amount(-1)
+	if original.SignedAmount() < 0 {
+		sign = 1
+	}
+	remaining := original.Amount - reversed*sign
+	amount := params.Amount
+	if amount == 0 {
+		amount = remaining
+	}
+	if amount <= 0 || amount > remaining {
+		return entity.Transaction{}, ErrReversalExceedsOriginal
+	}
+
+	reversal := buildTransaction(models.ParamsWallet{
+		Amount: amount * sign,
+		Currency: original.Currency,
+		ReferenceID: params.ReferenceID,
+		CreatedBy: params.CreatedBy,
+	}, entity.TransactionTypeReversal, entity.TransactionStatusSuccess)
+	reversal.ReversalOf = original.ID
+	return reversal, nil
+}
+
+// reversalLimitParams is the debit of a customer reversal as the withdraw
+// limits see it.
+func reversalLimitParams(reversal entity.Transaction) models.ParamsWallet {
+	return models.ParamsWallet{
+		Amount: -reversal.Amount,
+		Currency: reversal.Currency,
+		ReferenceID: reversal.ReferenceID,
+		CreatedBy: reversal.CreatedBy,
+	}
+}
+
+// reversalAccount is the system account the original transaction was booked
+// against.
+func reversalAccount(original entity.Transaction) string {
+	if original.Type == entity.TransactionTypeWithdraw {
+		return AccountPayout
+	}
+	return AccountFunding
+}
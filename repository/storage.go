@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"github.com/Sigaeasu/go-mwe/config"
+	"github.com/Sigaeasu/go-mwe/config/database"
+	"github.com/Sigaeasu/go-mwe/limits"
+	"github.com/sirupsen/logrus"
+)
+
+// Storage drivers accepted in storage.driver.
+const (
+	DriverPostgres = "postgres"
+	DriverMemory = "memory"
+)
+
+// NewMiniWalletRepository returns the repository selected by storage.driver in
+// the application config, enforcing the configured limits. Postgres is used
+// when no driver is set.
+func NewMiniWalletRepository() MiniWalletRepoInterface {
+	policy, err := limits.FromConfig()
+	if err != nil {
+		logrus.Fatalf("Invalid limits config: %v", err)
+	}
+	switch config.Config.StorageCfg.Driver {
+	case DriverPostgres, "":
+		return MiniWalletRepository(database.ConnectFromConfig(), policy)
+	case DriverMemory:
+		logrus.Warn("Using in-memory storage, every wallet is lost when the process exits")
+		return MiniWalletMemoryRepository(policy)
+	}
+	logrus.Fatalf("Unknown storage driver %q", config.Config.StorageCfg.Driver)
+	return nil
+}
@@ -0,0 +1,232 @@
+package repository
+
+import (
+	"context"
+	"time"
+	"github.com/go-pg/pg/v10"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
+)
+
+var (
+	ErrInvalidRefreshToken = apperror.New(apperror.CodeInvalidToken, "Invalid refresh token")
+	ErrRefreshTokenReused = apperror.New(apperror.CodeTokenReused, "Refresh token was used before, every token issued from it is revoked")
+)
+
+// TokenRepoInterface keeps refresh tokens and the list of revoked access
+// tokens.
+type TokenRepoInterface interface {
+	CreateRefreshToken(token entity.RefreshToken) error
+	RotateRefreshToken(tokenHash string, next entity.RefreshToken, now time.Time) (*entity.RefreshToken, error)
+	RevokeSession(accessJTI string, customerXId string, expiresAt time.Time, now time.Time) error
+	IsTokenRevoked(jti string) (bool, error)
+	PurgeExpiredTokens(now time.Time) (int, error)
+}
+
+func (pdb *miniWalletDatabase) CreateRefreshToken(token entity.RefreshToken) error {
+	_, err := pdb.dbConn.Model(&token).Insert()
+	return err
+}
+
+// RotateRefreshToken retires the refresh token with the hash and stores next
+// in its family, for the same customer and API client. Tokens of a revoked
+// client are refused. Showing a token that was already
+// rotated revokes its whole family, including the access tokens issued with
+// it, and answers ErrRefreshTokenReused.
+func (pdb *miniWalletDatabase) RotateRefreshToken(tokenHash string, next entity.RefreshToken, now time.Time) (*entity.RefreshToken, error) {
+	reused := false
+	err := pdb.dbConn.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		var current entity.RefreshToken
+		err := tx.Model(&current).
+			Where("token_hash = ?", tokenHash).
+			For("UPDATE").
+			Select()
+		if err == pg.ErrNoRows {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+		if !current.RotatedAt.IsZero() {
+			// The revocation must commit, so the error is returned after.
+			reused = true
+			return revokeFamily(tx, current.FamilyID, now)
+		}
+		if err := checkRefreshable(current, now); err != nil {
+			return err
+		}
+		revoked, err := clientRevoked(tx, current.ClientID)
+		if err != nil {
+			return err
+		}
+		if revoked {
+			return ErrInvalidRefreshToken
+		}
+
+		_, err = tx.Model(&current).
+			WherePK().
+			Set("rotated_at = ?", now).
+			Update()
+		if err != nil {
+			return err
+		}
+		next = inFamily(next, current)
+		_, err = tx.Model(&next).Insert()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		return nil, ErrRefreshTokenReused
+	}
+	return &next, nil
+}
+
+// RevokeSession is a logout: the access token is revoked until it expires,
+// together with the refresh token family it was issued with.
+func (pdb *miniWalletDatabase) RevokeSession(accessJTI string, customerXId string, expiresAt time.Time, now time.Time) error {
+	return pdb.dbConn.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		err := revokeAccessTokens(tx, []entity.RevokedToken{revokedToken(accessJTI, customerXId, expiresAt, now)})
+		if err != nil {
+			return err
+		}
+		var token entity.RefreshToken
+		err = tx.Model(&token).
+			Where("access_jti = ?", accessJTI).
+			Where("customer_xid = ?", customerXId).
+			Select()
+		if err == pg.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return revokeFamily(tx, token.FamilyID, now)
+	})
+}
+
+func (pdb *miniWalletDatabase) IsTokenRevoked(jti string) (bool, error) {
+	return pdb.dbConn.Model((*entity.RevokedToken)(nil)).
+		Where("jti = ?", jti).
+		Exists()
+}
+
+// PurgeExpiredTokens deletes refresh tokens and revocations that have
+// expired, as expired tokens are refused anyway.
+func (pdb *miniWalletDatabase) PurgeExpiredTokens(now time.Time) (int, error) {
+	revoked, err := pdb.dbConn.Model((*entity.RevokedToken)(nil)).
+		Where("expires_at <= ?", now).
+		Delete()
+	if err != nil {
+		return 0, err
+	}
+	refresh, err := pdb.dbConn.Model((*entity.RefreshToken)(nil)).
+		Where("expires_at <= ?", now).
+		Delete()
+	if err != nil {
+		return 0, err
+	}
+	return revoked.RowsAffected() + refresh.RowsAffected(), nil
+}
+
+// clientRevoked reports whether the API client that opened a session has
+// been revoked since.
+func clientRevoked(db pg.DBI, clientID string) (bool, error) {
+	if clientID == "" {
+		return false, nil
+	}
+	return db.Model((*entity.APIClient)(nil)).
+		Where("id = ?", clientID).
+		Where("revoked_at IS NOT NULL").
+		Exists()
+}
+
+// revokeClientSessions revokes every token family the client opened.
+func revokeClientSessions(tx *pg.Tx, clientID string, now time.Time) error {
+	var families []string
+	err := tx.Model((*entity.RefreshToken)(nil)).
+		ColumnExpr("DISTINCT family_id").
+		Where("client_id = ?", clientID).
+		Where("revoked_at IS NULL").
+		Select(&families)
+	if err != nil {
+		return err
+	}
+	for _, familyID := range families {
+		if err := revokeFamily(tx, familyID, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func revokeFamily(tx *pg.Tx, familyID string, now time.Time) error {
+	var tokens []entity.RefreshToken
+	err := tx.Model(&tokens).
+		Where("family_id = ?", familyID).
+		For("UPDATE").
+		Select()
+	if err != nil {
+		return err
+	}
+	if err := revokeAccessTokens(tx, familyRevocations(tokens, now)); err != nil {
+		return err
+	}
+	_, err = tx.Model((*entity.RefreshToken)(nil)).
+		Set("revoked_at = ?", now).
+		Where("family_id = ?", familyID).
+		Where("revoked_at IS NULL").
+		Update()
+	return err
+}
+
+func revokeAccessTokens(tx *pg.Tx, revoked []entity.RevokedToken) error {
+	if len(revoked) == 0 {
+		return nil
+	}
+	_, err := tx.Model(&revoked).
+		OnConflict("DO NOTHING").
+		Insert()
+	return err
+}
+
+func checkRefreshable(token entity.RefreshToken, now time.Time) error {
+	if !token.RevokedAt.IsZero() || !now.Before(token.ExpiresAt) {
+		return ErrInvalidRefreshToken
+	}
+	return nil
+}
+
+// inFamily makes next the successor of current. The family keeps the expiry
+// of its first token, so refreshing cannot keep a session alive forever.
+func inFamily(next entity.RefreshToken, current entity.RefreshToken) entity.RefreshToken {
+	next.FamilyID = current.FamilyID
+	if next.ExpiresAt.After(current.ExpiresAt) {
+		next.ExpiresAt = current.ExpiresAt
+	}
+	next.CustomerXId = current.CustomerXId
+	next.ClientID = current.ClientID
+	return next
+}
+
+// familyRevocations lists the access tokens of the family that are still
+// valid and so must be revoked.
+func familyRevocations(tokens []entity.RefreshToken, now time.Time) []entity.RevokedToken {
+	var revoked []entity.RevokedToken
+	for _, t := range tokens {
+		if t.AccessExpiresAt.After(now) {
+			revoked = append(revoked, revokedToken(t.AccessJTI, t.CustomerXId, t.AccessExpiresAt, now))
+		}
+	}
+	return revoked
+}
+
+func revokedToken(jti string, customerXId string, expiresAt time.Time, now time.Time) entity.RevokedToken {
+	return entity.RevokedToken{
+		JTI: jti,
+		CustomerXId: customerXId,
+		ExpiresAt: expiresAt,
+		RevokedAt: now,
+	}
+}
@@ -1,194 +1,505 @@
 package repository
 
 import (
-	"errors"
+	"context"
 	"fmt"
-	"sync"
 	"time"
 	"github.com/go-pg/pg/v10"
+	"github.com/Sigaeasu/go-mwe/limits"
 	"github.com/Sigaeasu/go-mwe/models/entity"
 	"github.com/Sigaeasu/go-mwe/models"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrEmptyCustomer = apperror.New(apperror.CodeMissingField, "customer_xid is empty")
+	ErrCustomerNotFound = apperror.New(apperror.CodeCustomerNotFound, "Customer not found")
+	ErrAlreadyEnabled = apperror.New(apperror.CodeWalletAlreadyEnabled, "Already enabled")
+	ErrAlreadyDisabled = apperror.New(apperror.CodeWalletAlreadyDisabled, "Already disabled")
+	ErrInsufficientBalance = apperror.New(apperror.CodeInsufficientFunds, "Balance is insufficient")
+	ErrDuplicateReference = apperror.New(apperror.CodeDuplicateReference, "Duplicate Reference ID")
+	ErrWalletDisabled = apperror.New(apperror.CodeWalletDisabled, "Wallet disabled")
+	ErrTargetNotFound = apperror.New(apperror.CodeTargetNotFound, "Target wallet not found")
+	ErrTargetDisabled = apperror.New(apperror.CodeTargetDisabled, "Target wallet disabled")
+	ErrSelfTransfer = apperror.New(apperror.CodeSelfTransfer, "Cannot transfer to the same wallet")
 )
 
 type MiniWalletRepoInterface interface {
+	WebhookRepoInterface
+	EventRepoInterface
+	AdminRepoInterface
+	AuditRepoInterface
+	TokenRepoInterface
+	ClientRepoInterface
+	CreateMiniWallet(customerXId string) (*entity.Wallet, error)
 	FetchMiniWalletByID(customerXId string) (*entity.Wallet, error)	
-	FetchTransactionByID(customerId string) ([]entity.Transaction, error)	
+	FetchTransactions(filter models.TransactionFilter) ([]entity.Transaction, string, error)
 	ChangeStatusOnMiniWallet(customerXId string, status bool) (*entity.Wallet, error)
-	Deposit(params models.ParamsWallet) (*entity.Wallet, error)	
-	Withdraw(params models.ParamsWallet) (*entity.Wallet, error)
-	NewTransaction(params models.ParamsWallet, transactionType string) (*entity.Transaction, error)
+	TransitionWallet(params models.ParamsTransition) (*entity.Wallet, error)
+	FetchWalletTransitions(customerXId string) ([]entity.WalletTransition, error)
+	Deposit(params models.ParamsWallet) (*entity.Transaction, error)	
+	Withdraw(params models.ParamsWallet) (*entity.Transaction, error)
+	HoldWithdrawal(params models.ParamsWallet, expiresAt time.Time) (*entity.Transaction, error)
+	CaptureWithdrawal(customerXId string, transactionID string) (*entity.Transaction, error)
+	VoidWithdrawal(customerXId string, transactionID string) (*entity.Transaction, error)
+	ExpireHolds(now time.Time) (int, error)
+	Transfer(params models.ParamsTransfer) (*models.TransferResult, error)
+	Reverse(params models.ParamsReversal) (*entity.Transaction, error)
+	ForceReversal(params models.ParamsReversal, action entity.AdminAction) (*entity.Transaction, error)
 	FailedTransaction(params models.ParamsWallet, transactionType string)
-	CheckReferenceID(referenceID string) (*entity.Transaction, error)
+	FetchIdempotentResponse(referenceID string) (*entity.IdempotentResponse, error)
+	SaveIdempotentResponse(response entity.IdempotentResponse) error
+	VerifyLedger() ([]models.LedgerMismatch, error)
+	FetchBalanceDrifts() ([]models.BalanceDrift, error)
+	WriteAdjustment(customerXId string, currency string) (*entity.Transaction, error)
 }
 
 type miniWalletDatabase struct {
-	mutex  sync.RWMutex
 	dbConn *pg.DB
+	limits limits.Policy
 }
 
-func MiniWalletRepository(c *pg.DB) MiniWalletRepoInterface {
-	return &miniWalletDatabase{dbConn: c}
+func MiniWalletRepository(c *pg.DB, policy limits.Policy) MiniWalletRepoInterface {
+	return &miniWalletDatabase{dbConn: c, limits: policy}
+}
+
+// CreateMiniWallet registers a disabled wallet for the customer. Calling it
+// again for the same customer returns the existing wallet untouched.
+func (pdb *miniWalletDatabase) CreateMiniWallet(customerXId string) (*entity.Wallet, error) {
+	if customerXId == "" {
+		return nil, ErrEmptyCustomer
+	}
+
+	err := pdb.dbConn.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		wallet := entity.Wallet{
+			OwnedBy: customerXId,
+		}
+		res, err := tx.Model(&wallet).
+			OnConflict("(owned_by) DO NOTHING").
+			Returning("*").
+			Insert()
+		if err != nil || res.RowsAffected() == 0 {
+			return err
+		}
+		return publishEvent(tx, &wallet, entity.EventWalletCreated, walletEventData(&wallet, time.Now()))
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pdb.FetchMiniWalletByID(customerXId)
 }
 
 func (pdb *miniWalletDatabase) FetchMiniWalletByID(customerXId string) (*entity.Wallet, error) {
 	var wallet entity.Wallet
-	pdb.mutex.Lock()
 	err := pdb.dbConn.Model(&wallet).
-		Where("id = ?", customerXId).
+		Relation("Balances").
+		Where("owned_by = ?", customerXId).
 		Select()
 	if err != nil {
 		if err != pg.ErrNoRows {
 			return nil, err
 		} 
 	}
-	pdb.mutex.Unlock()
 	return &wallet, nil
 }
 
-func (pdb *miniWalletDatabase) FetchTransactionByID(customerId string) ([]entity.Transaction, error) {
-	var transaction []entity.Transaction
-	pdb.mutex.Lock()
-	err := pdb.dbConn.Model(&transaction).
-		Where("created_by = ?", customerId).
+// FetchTransactions returns one page of the customer's transactions ordered by
+// (created_at, id) and the cursor of the next page, empty on the last page.
+func (pdb *miniWalletDatabase) FetchTransactions(filter models.TransactionFilter) ([]entity.Transaction, string, error) {
+	transactions := []entity.Transaction{}
+	query := pdb.dbConn.Model(&transactions).
+		Where("created_by = ?", filter.CreatedBy)
+	if filter.After != nil {
+		query = query.Where("(created_at, id) > (?, ?)", filter.After.CreatedAt, filter.After.ID)
+	}
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.Currency != "" {
+		query = query.Where("currency = ?", filter.Currency)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("created_at < ?", filter.To)
+	}
+	if filter.MinAmount != nil {
+		query = query.Where("amount >= ?", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		query = query.Where("amount <= ?", *filter.MaxAmount)
+	}
+	err := query.
+		Order("created_at ASC", "id ASC").
+		Limit(filter.Limit + 1).
 		Select()
 	if err != nil {
-		if err != pg.ErrNoRows {
-			return nil, err
-		} 
+		return nil, "", err
 	}
-	pdb.mutex.Unlock()
-	return transaction, nil
+	page, next := pageTransactions(transactions, filter.Limit)
+	return page, next, nil
 }
 
+// ChangeStatusOnMiniWallet is the customer enabling or disabling their own
+// wallet.
 func (pdb *miniWalletDatabase) ChangeStatusOnMiniWallet(customerXId string, status bool) (*entity.Wallet, error) {
-	if customerXId == "" {
-		return nil, errors.New("customer_xid is empty")
+	return pdb.TransitionWallet(customerTransition(customerXId, status))
+}
+
+// Deposit checks the limits policy, credits the wallet, writes the
+// transaction row and books the journal entry against the funding account in
+// a single database transaction. The balance is changed relative to the
+// locked row, never from a value read earlier by the caller.
+func (pdb *miniWalletDatabase) Deposit(params models.ParamsWallet) (*entity.Transaction, error) {
+	var transaction *entity.Transaction
+	err := pdb.dbConn.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		wallet, err := lockMiniWallet(tx, params.CreatedBy)
+		if err != nil {
+			return err
+		}
+		if err := CheckActive(wallet); err != nil {
+			return err
+		}
+		err = checkLimits(tx, pdb.limits, params, entity.TransactionTypeDeposit)
+		if err != nil {
+			return err
+		}
+		err = changeBalance(tx, wallet.ID, params.Currency, params.Amount)
+		if err != nil {
+			return err
+		}
+		transaction, err = insertTransaction(tx, buildTransaction(params, "deposit", "success"))
+		if err != nil {
+			return err
+		}
+		err = postJournal(tx, "deposit", transaction.ID, params.Currency,
+			systemLeg(AccountFunding, -params.Amount),
+			walletLeg(wallet.ID, params.Amount),
+		)
+		if err != nil {
+			return err
+		}
+		err = publishEvent(tx, wallet, entity.EventDepositSucceeded, models.NewTransactionEventData(*transaction))
+		if err != nil {
+			return err
+		}
+		return saveResponse(tx, params.Respond, *transaction)
+	})
+	if err != nil {
+		return nil, err
 	}
+	return transaction, nil
+}
 
-	resWallet, err := pdb.FetchMiniWalletByID(customerXId)
+// Withdraw checks the limits policy, debits the wallet, writes the
+// transaction row and books the journal entry against the payout account in
+// a single database transaction. The balance check happens after the wallet
+// row is locked so concurrent withdrawals cannot overdraw it.
+func (pdb *miniWalletDatabase) Withdraw(params models.ParamsWallet) (*entity.Transaction, error) {
+	var transaction *entity.Transaction
+	err := pdb.dbConn.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		wallet, err := lockMiniWallet(tx, params.CreatedBy)
+		if err != nil {
+			return err
+		}
+		if err := CheckActive(wallet); err != nil {
+			return err
+		}
+		err = checkLimits(tx, pdb.limits, params, entity.TransactionTypeWithdraw)
+		if err != nil {
+			return err
+		}
+		err = debitBalance(tx, wallet.ID, params.Currency, params.Amount)
+		if err != nil {
+			return err
+		}
+		transaction, err = insertTransaction(tx, buildTransaction(params, "withdraw", "success"))
+		if err != nil {
+			return err
+		}
+		err = postJournal(tx, "withdraw", transaction.ID, params.Currency,
+			walletLeg(wallet.ID, -params.Amount),
+			systemLeg(AccountPayout, params.Amount),
+		)
+		if err != nil {
+			return err
+		}
+		err = publishEvent(tx, wallet, entity.EventWithdrawalSucceeded, models.NewTransactionEventData(*transaction))
+		if err != nil {
+			return err
+		}
+		return saveResponse(tx, params.Respond, *transaction)
+	})
 	if err != nil {
 		return nil, err
 	}
+	return transaction, nil
+}
 
-	if resWallet != nil {
-		if status && resWallet.IsEnabled {
-			return nil, fmt.Errorf("Already enabled")
-		} else if !status && resWallet.IsEnabled == false {
-			return nil, fmt.Errorf("Already disabled")
-		} else {			
-			wallet := entity.Wallet{}
-			pdb.mutex.Lock()
-			if resWallet.IsEnabled {
-				res, err := pdb.dbConn.Model(&wallet).
-					Where("id = ?", customerXId).
-					Set("is_enabled = ?", status).
-					Set("enabled_at = ?", time.Now()).
-					Update()
-				if err != nil {
-					return nil, err
-				}
-				if res.RowsAffected() == 0 {
-					return nil, fmt.Errorf("Fails to enable wallet")
-				}
-			} else {
-				res, err := pdb.dbConn.Model(&wallet).
-					Where("id = ?", customerXId).
-					Set("is_enabled = ?", status).
-					Set("disabled_at = ?", time.Now()).
-					Update()
-				if err != nil {
-					return nil, err
-				}
-				if res.RowsAffected() == 0 {
-					return nil, fmt.Errorf("Fails to disable wallet")
-				}
-			}			
-			pdb.mutex.Unlock()
-			return &wallet, nil
-		}
-	}
-	return nil, errors.New("Customer not found")
-}
-
-func (pdb *miniWalletDatabase) Deposit(params models.ParamsWallet) (*entity.Wallet, error) {
-	var wallet entity.Wallet
-	pdb.mutex.Lock()
-	res, err := pdb.dbConn.Model(&wallet).
-		Where("owned_by = ? ", params.CreatedBy).
-		Set("balance = ?", params.Balance+params.Amount).
-		Update()
+// Transfer debits the caller and credits the target wallet in one database
+// transaction. Both wallets are locked in owned_by order so two opposite
+// transfers cannot deadlock each other. The caller's withdraw limits apply.
+func (pdb *miniWalletDatabase) Transfer(params models.ParamsTransfer) (*models.TransferResult, error) {
+	var result models.TransferResult
+	err := pdb.dbConn.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		target, err := findTransferTarget(tx, params)
+		if err != nil {
+			return err
+		}
+		if target.OwnedBy == params.CreatedBy {
+			return ErrSelfTransfer
+		}
+
+		var source *entity.Wallet
+		if params.CreatedBy < target.OwnedBy {
+			source, err = lockMiniWallet(tx, params.CreatedBy)
+			if err == nil {
+				target, err = lockMiniWallet(tx, target.OwnedBy)
+			}
+		} else {
+			target, err = lockMiniWallet(tx, target.OwnedBy)
+			if err == nil {
+				source, err = lockMiniWallet(tx, params.CreatedBy)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := CheckActive(source); err != nil {
+			return err
+		}
+		if target.Status != entity.WalletStatusActive {
+			return ErrTargetDisabled
+		}
+		err = checkLimits(tx, pdb.limits, transferLimitParams(params), entity.TransactionTypeWithdraw)
+		if err != nil {
+			return err
+		}
+		err = debitBalance(tx, source.ID, params.Currency, params.Amount)
+		if err != nil {
+			return err
+		}
+		err = changeBalance(tx, target.ID, params.Currency, params.Amount)
+		if err != nil {
+			return err
+		}
+
+		var creditReferenceID string
+		_, err = tx.QueryOne(pg.Scan(&result.TransferID, &creditReferenceID), "SELECT gen_random_uuid(), gen_random_uuid()")
+		if err != nil {
+			return err
+		}
+
+		debit := buildTransaction(models.ParamsWallet{
+			Amount: params.Amount,
+			Currency: params.Currency,
+			ReferenceID: params.ReferenceID,
+			CreatedBy: source.OwnedBy,
+		}, "transfer_out", "success")
+		debit.TransferID = result.TransferID
+		result.Debit, err = insertTransaction(tx, debit)
+		if err != nil {
+			return err
+		}
+
+		credit := buildTransaction(models.ParamsWallet{
+			Amount: params.Amount,
+			Currency: params.Currency,
+			ReferenceID: creditReferenceID,
+			CreatedBy: target.OwnedBy,
+		}, "transfer_in", "success")
+		credit.TransferID = result.TransferID
+		result.Credit, err = insertTransaction(tx, credit)
+		if err != nil {
+			return err
+		}
+		err = postJournal(tx, "transfer", result.Debit.ID, params.Currency,
+			walletLeg(source.ID, -params.Amount),
+			walletLeg(target.ID, params.Amount),
+		)
+		if err != nil {
+			return err
+		}
+		err = publishEvent(tx, source, entity.EventTransferSent, models.NewTransactionEventData(*result.Debit))
+		if err != nil {
+			return err
+		}
+		err = publishEvent(tx, target, entity.EventTransferReceived, models.NewTransactionEventData(*result.Credit))
+		if err != nil || params.Respond == nil {
+			return err
+		}
+		response, err := params.Respond(result)
+		if err != nil {
+			return err
+		}
+		return insertResponse(tx, response)
+	})
 	if err != nil {
 		return nil, err
 	}
-	if res.RowsAffected() == 0 {
-		return nil, fmt.Errorf("Deposit Failed")
+	return &result, nil
+}
+
+// FailedTransaction records a refused attempt and announces it to webhook
+// subscribers. Errors are only logged, the caller is already failing.
+func (pdb *miniWalletDatabase) FailedTransaction(params models.ParamsWallet, transactionType string) {
+	err := pdb.dbConn.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		transaction, err := insertTransaction(tx, buildTransaction(params, transactionType, "failed"))
+		if err != nil {
+			return err
+		}
+		if event := failedEvent(transactionType); event != "" {
+			return enqueueWebhooks(tx, params.CreatedBy, event, models.NewTransactionEventData(*transaction))
+		}
+		return nil
+	})
+	if err != nil {
+		logrus.Errorf("Fail to record failed %s %s: %v", transactionType, params.ReferenceID, err)
 	}
-	pdb.mutex.Unlock()
-	return &wallet, nil
 }
 
-func (pdb *miniWalletDatabase) Withdraw(params models.ParamsWallet) (*entity.Wallet, error) {
-	var wallet entity.Wallet
-	pdb.mutex.Lock()
-	res, err := pdb.dbConn.Model(&wallet).
-		Where("id = ? ", params.CreatedBy).
-		Set("balance = ?", params.Balance-params.Amount).
-		Update()
+// FetchIdempotentResponse returns the response stored for a reference ID, or
+// nil when the reference has not completed yet.
+func (pdb *miniWalletDatabase) FetchIdempotentResponse(referenceID string) (*entity.IdempotentResponse, error) {
+	var result entity.IdempotentResponse
+	err := pdb.dbConn.Model(&result).
+		Where("reference_id = ?", referenceID).
+		Select()
 	if err != nil {
+		if err == pg.ErrNoRows {
+			return nil, nil
+		}
 		return nil, err
 	}
-	if res.RowsAffected() == 0 {
-		return nil, fmt.Errorf("Withdraw Failed")
+	return &result, nil
+}
+
+// SaveIdempotentResponse stores the first response sent for a reference ID.
+// Later saves for the same reference are ignored. Responses of successful
+// requests are stored with the booking instead, see saveResponse.
+func (pdb *miniWalletDatabase) SaveIdempotentResponse(response entity.IdempotentResponse) error {
+	response.CreatedAt = time.Now()
+	_, err := pdb.dbConn.Model(&response).
+		OnConflict("(reference_id) DO NOTHING").
+		Insert()
+	return err
+}
+
+// saveResponse stores the response respond builds for the booked transaction
+// in tx, so a retry never finds the booking without its response.
+func saveResponse(tx *pg.Tx, respond models.Respond, transaction entity.Transaction) error {
+	if respond == nil {
+		return nil
 	}
-	pdb.mutex.Unlock()
-	return &wallet, nil
+	response, err := respond(transaction)
+	if err != nil {
+		return err
+	}
+	return insertResponse(tx, response)
+}
+
+func insertResponse(tx *pg.Tx, response *entity.IdempotentResponse) error {
+	response.CreatedAt = time.Now()
+	_, err := tx.Model(response).
+		OnConflict("(reference_id) DO NOTHING").
+		Insert()
+	return err
 }
 
-func (pdb *miniWalletDatabase) NewTransaction(params models.ParamsWallet, transactionType string) (*entity.Transaction, error) {
-	var result entity.Transaction
-	transaction := entity.Transaction{
+// transferLimitParams is the debit of a transfer as the withdraw limits see
+// it.
+func transferLimitParams(params models.ParamsTransfer) models.ParamsWallet {
+	return models.ParamsWallet{
 		Amount: params.Amount,
-		Type: transactionType,
-		Status: "success",
+		Currency: params.Currency,
 		ReferenceID: params.ReferenceID,
 		CreatedBy: params.CreatedBy,
-		CreatedAt: time.Now(),
 	}
-	pdb.mutex.Lock()
-	res, err := pdb.dbConn.Model(&transaction).Insert()
+}
+
+// lockMiniWallet selects the customer's wallet with FOR UPDATE so the row
+// stays locked until the surrounding transaction ends.
+func lockMiniWallet(tx *pg.Tx, customerXId string) (*entity.Wallet, error) {
+	var wallet entity.Wallet
+	err := tx.Model(&wallet).
+		Where("owned_by = ?", customerXId).
+		For("UPDATE").
+		Select()
 	if err != nil {
+		if err == pg.ErrNoRows {
+			return nil, ErrCustomerNotFound
+		}
 		return nil, err
 	}
-	if res.RowsAffected() == 0 {
-		return nil, fmt.Errorf("Fail to create transaction log")
+	return &wallet, nil
+}
+
+func findTransferTarget(tx *pg.Tx, params models.ParamsTransfer) (*entity.Wallet, error) {
+	var wallet entity.Wallet
+	query := tx.Model(&wallet)
+	if params.ToCustomerXId != "" {
+		query = query.Where("owned_by = ?", params.ToCustomerXId)
+	} else {
+		query = query.Where("id = ?", params.ToWalletID)
 	}
-	pdb.mutex.Unlock()
-	return &result, nil
+	err := query.Select()
+	if err != nil {
+		if err == pg.ErrNoRows {
+			return nil, ErrTargetNotFound
+		}
+		return nil, err
+	}
+	return &wallet, nil
 }
 
-func (pdb *miniWalletDatabase) FailedTransaction(params models.ParamsWallet, transactionType string) {
-	transaction := entity.Transaction{
+// pageTransactions trims a result fetched with limit+1 rows down to the page
+// and builds the cursor of the following page.
+func pageTransactions(transactions []entity.Transaction, limit int) ([]entity.Transaction, string) {
+	if len(transactions) <= limit {
+		return transactions, ""
+	}
+	transactions = transactions[:limit]
+	last := transactions[limit-1]
+	cursor := models.TransactionCursor{
+		CreatedAt: last.CreatedAt,
+		ID: last.ID,
+	}
+	return transactions, cursor.Encode()
+}
+
+func buildTransaction(params models.ParamsWallet, transactionType string, status string) entity.Transaction {
+	return entity.Transaction{
 		Amount: params.Amount,
+		Currency: params.Currency,
 		Type: transactionType,
-		Status: "failed",
+		Status: status,
 		ReferenceID: params.ReferenceID,
 		CreatedBy: params.CreatedBy,
 		CreatedAt: time.Now(),
 	}
-	pdb.mutex.Lock()
-	pdb.dbConn.Model(&transaction).Insert()
-	pdb.mutex.Unlock()
 }
 
-func (pdb *miniWalletDatabase) CheckReferenceID(referenceID string) (*entity.Transaction, error) {
-	var result entity.Transaction
-	pdb.mutex.Lock()
-	err := pdb.dbConn.Model(&result).
-		Where("reference_id = ?", referenceID).
-		Select()
-	pdb.mutex.Unlock()
-	if err != nil && err == pg.ErrNoRows {
-		return &result, nil
+func insertTransaction(db pg.DBI, transaction entity.Transaction) (*entity.Transaction, error) {
+	res, err := db.Model(&transaction).Returning("*").Insert()
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrDuplicateReference
+		}
+		return nil, err
+	}
+	if res.RowsAffected() == 0 {
+		return nil, fmt.Errorf("Fail to create transaction log")
 	}
-	return nil, err
-}
\ No newline at end of file
+	return &transaction, nil
+}
+
+func isUniqueViolation(err error) bool {
+	pgErr, ok := err.(pg.Error)
+	return ok && pgErr.Field('C') == "23505"
+}
@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+	"github.com/go-pg/pg/v10"
+	"github.com/Sigaeasu/go-mwe/models"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
+)
+
+var ErrWebhookNotFound = apperror.New(apperror.CodeWebhookNotFound, "Webhook subscription not found")
+
+// WebhookRepoInterface stores webhook subscriptions and the outbox of
+// deliveries. Deliveries are enqueued by the wallet methods themselves, in
+// the same transaction as the change they announce.
+type WebhookRepoInterface interface {
+	CreateWebhook(subscription entity.WebhookSubscription) (*entity.WebhookSubscription, error)
+	FetchWebhooks(customerXId string) ([]entity.WebhookSubscription, error)
+	DeleteWebhook(customerXId string, subscriptionID string) error
+	FetchWebhookDeliveries(customerXId string, subscriptionID string, limit int) ([]entity.WebhookDelivery, error)
+	ClaimWebhookDeliveries(now time.Time, leaseUntil time.Time, limit int) ([]models.DueDelivery, error)
+	SaveWebhookDelivery(delivery entity.WebhookDelivery) error
+}
+
+func (pdb *miniWalletDatabase) CreateWebhook(subscription entity.WebhookSubscription) (*entity.WebhookSubscription, error) {
+	subscription.CreatedAt = time.Now()
+	_, err := pdb.dbConn.Model(&subscription).Returning("*").Insert()
+	if err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func (pdb *miniWalletDatabase) FetchWebhooks(customerXId string) ([]entity.WebhookSubscription, error) {
+	subscriptions := []entity.WebhookSubscription{}
+	err := pdb.dbConn.Model(&subscriptions).
+		Where("customer_xid = ?", customerXId).
+		Where("deleted_at IS NULL").
+		Order("created_at ASC").
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return subscriptions, nil
+}
+
+// DeleteWebhook stops a subscription. Its pending deliveries fail at once;
+// the delivery log is kept.
+func (pdb *miniWalletDatabase) DeleteWebhook(customerXId string, subscriptionID string) error {
+	return pdb.dbConn.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		res, err := tx.Model((*entity.WebhookSubscription)(nil)).
+			Set("deleted_at = ?", time.Now()).
+			Where("id = ?", subscriptionID).
+			Where("customer_xid = ?", customerXId).
+			Where("deleted_at IS NULL").
+			Update()
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return ErrWebhookNotFound
+		}
+		_, err = tx.Model((*entity.WebhookDelivery)(nil)).
+			Set("status = ?", entity.WebhookStatusFailed).
+			Set("last_error = ?", "Subscription deleted").
+			Where("subscription_id = ?", subscriptionID).
+			Where("status = ?", entity.WebhookStatusPending).
+			Update()
+		return err
+	})
+}
+
+// FetchWebhookDeliveries returns the latest deliveries of one of the
+// customer's subscriptions, newest first.
+func (pdb *miniWalletDatabase) FetchWebhookDeliveries(customerXId string, subscriptionID string, limit int) ([]entity.WebhookDelivery, error) {
+	exists, err := pdb.dbConn.Model((*entity.WebhookSubscription)(nil)).
+		Where("id = ?", subscriptionID).
+		Where("customer_xid = ?", customerXId).
+		Exists()
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, ErrWebhookNotFound
+	}
+
+	deliveries := []entity.WebhookDelivery{}
+	err = pdb.dbConn.Model(&deliveries).
+		Where("subscription_id = ?", subscriptionID).
+		Order("created_at DESC", "id DESC").
+		Limit(limit).
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// ClaimWebhookDeliveries leases up to limit pending deliveries that are due
+// by pushing their next attempt to leaseUntil. SKIP LOCKED lets several
+// dispatchers share the outbox; a dispatcher that dies before saving the
+// result only delays the delivery until the lease ends.
+func (pdb *miniWalletDatabase) ClaimWebhookDeliveries(now time.Time, leaseUntil time.Time, limit int) ([]models.DueDelivery, error) {
+	var deliveries []entity.WebhookDelivery
+	_, err := pdb.dbConn.Query(&deliveries, `
+		UPDATE webhook_deliveries d SET next_attempt_at = ?
+		FROM (
+			SELECT id FROM webhook_deliveries
+			WHERE status = ? AND next_attempt_at <= ?
+			ORDER BY next_attempt_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED
+		) due
+		WHERE d.id = due.id
+		RETURNING d.*`,
+		leaseUntil, entity.WebhookStatusPending, now, limit,
+	)
+	if err != nil || len(deliveries) == 0 {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(deliveries))
+	for _, d := range deliveries {
+		ids = append(ids, d.SubscriptionID)
+	}
+	var subscriptions []entity.WebhookSubscription
+	err = pdb.dbConn.Model(&subscriptions).
+		Where("id IN (?)", pg.In(ids)).
+		Select()
+	if err != nil {
+		return nil, err
+	}
+	return dueDeliveries(deliveries, subscriptions), nil
+}
+
+// SaveWebhookDelivery stores the outcome of a delivery attempt.
+func (pdb *miniWalletDatabase) SaveWebhookDelivery(delivery entity.WebhookDelivery) error {
+	_, err := pdb.dbConn.Model(&delivery).
+		Column("status", "attempts", "next_attempt_at", "last_status_code", "last_error", "delivered_at").
+		WherePK().
+		Update()
+	return err
+}
+
+// enqueueWebhooks writes one outbox row per subscription of the customer that
+// asks for the event type. Call it with the transaction of the wallet change.
+func enqueueWebhooks(db pg.DBI, customerXId string, eventType string, data interface{}) error {
+	var subscriptions []entity.WebhookSubscription
+	err := db.Model(&subscriptions).
+		Where("customer_xid = ?", customerXId).
+		Where("deleted_at IS NULL").
+		Where("? = ANY(events)", eventType).
+		Select()
+	if err != nil || len(subscriptions) == 0 {
+		return err
+	}
+	deliveries, err := buildDeliveries(subscriptions, eventType, data)
+	if err != nil {
+		return err
+	}
+	_, err = db.Model(&deliveries).Insert()
+	return err
+}
+
+func buildDeliveries(subscriptions []entity.WebhookSubscription, eventType string, data interface{}) ([]entity.WebhookDelivery, error) {
+	event := models.WebhookEvent{
+		ID: newUUID(),
+		Type: eventType,
+		CreatedAt: time.Now(),
+		Data: data,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	deliveries := make([]entity.WebhookDelivery, 0, len(subscriptions))
+	for _, s := range subscriptions {
+		deliveries = append(deliveries, entity.WebhookDelivery{
+			SubscriptionID: s.ID,
+			EventID: event.ID,
+			EventType: eventType,
+			Payload: payload,
+			Status: entity.WebhookStatusPending,
+			NextAttemptAt: event.CreatedAt,
+			CreatedAt: event.CreatedAt,
+		})
+	}
+	return deliveries, nil
+}
+
+func dueDeliveries(deliveries []entity.WebhookDelivery, subscriptions []entity.WebhookSubscription) []models.DueDelivery {
+	byID := map[string]entity.WebhookSubscription{}
+	for _, s := range subscriptions {
+		byID[s.ID] = s
+	}
+	due := make([]models.DueDelivery, 0, len(deliveries))
+	for _, d := range deliveries {
+		s := byID[d.SubscriptionID]
+		due = append(due, models.DueDelivery{
+			Delivery: d,
+			URL: s.URL,
+			Secret: s.Secret,
+		})
+	}
+	return due
+}
+
+// failedEvent is the event announcing a failed attempt of the transaction
+// type, if there is one.
+func failedEvent(transactionType string) string {
+	switch transactionType {
+	case entity.TransactionTypeDeposit:
+		return entity.EventDepositFailed
+	case entity.TransactionTypeWithdraw:
+		return entity.EventWithdrawalFailed
+	}
+	return ""
+}
+
+func walletEventData(wallet *entity.Wallet, at time.Time) models.WalletEventData {
+	return models.WalletEventData{
+		ID: wallet.ID,
+		CustomerXId: wallet.OwnedBy,
+		Status: wallet.StatusName(),
+		ChangedAt: at,
+	}
+}
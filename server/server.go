@@ -7,49 +7,71 @@ import (
 	"os"
 	"os/signal"
 	"time"
+	"github.com/Sigaeasu/go-mwe/audit"
 	"github.com/Sigaeasu/go-mwe/config"
-	"github.com/Sigaeasu/go-mwe/config/database"
 	"github.com/Sigaeasu/go-mwe/service"
 	"github.com/Sigaeasu/go-mwe/repository"
 	"github.com/Sigaeasu/go-mwe/handler"
+	"github.com/Sigaeasu/go-mwe/realtime"
+	"github.com/Sigaeasu/go-mwe/webhook"
 	"github.com/gorilla/mux"
 	"github.com/sirupsen/logrus"
 )
 
 func RunServer() {
-	postgresConfig := config.Config.PostgresCfg
-	configDatabase := database.ParametersConnection{
-		Username: postgresConfig.Username,
-		Password: postgresConfig.Password,
-		Host: postgresConfig.Host,
-		Port: postgresConfig.Port,
-		Database: postgresConfig.Database,
-		MaxConnection: postgresConfig.MaxConn,
-		MinIdleConnection: postgresConfig.MinIdleConn,
-		MaxRetries: postgresConfig.MaxRetries,
+	if _, err := service.Keys(); err != nil {
+		logrus.Fatalf("Invalid JWT keys: %v", err)
 	}
-
-	db := database.DatabaseConnection(configDatabase)
-
-	err := db.Ping(context.Background())
-	if err != nil {
-		logrus.Fatalf("Ping DB error: %v", err)
-	}
-
 	m := mux.NewRouter()
-	miniWalletDatabase := repository.MiniWalletRepository(db)
-	handlerAPI := handler.MiniWalletHandler(miniWalletDatabase)
+	m.HandleFunc("/.well-known/jwks.json", handler.JWKS).Methods(http.MethodGet)
+	miniWalletDatabase := repository.NewMiniWalletRepository()
+	hub := realtime.NewHub(miniWalletDatabase)
+	handlerAPI := handler.MiniWalletHandler(miniWalletDatabase, hub)
 
 	api := m.PathPrefix("/api/v1").Subrouter()
 	api.HandleFunc("/init", handlerAPI.AuthMiniWallet).Methods(http.MethodPost)
+	api.HandleFunc("/token/refresh", handlerAPI.RefreshToken).Methods(http.MethodPost)
+	api.HandleFunc("/logout", handlerAPI.Logout).Methods(http.MethodPost)
 	api.HandleFunc("/wallet", handlerAPI.ViewMiniWalletBalance).Methods(http.MethodGet)
 	api.HandleFunc("/wallet/transactions", handlerAPI.ViewTransactions).Methods(http.MethodGet)
+	api.HandleFunc("/wallet/events", handlerAPI.StreamEvents).Methods(http.MethodGet)
+	api.HandleFunc("/wallet/ws", handlerAPI.WalletSocket).Methods(http.MethodGet)
+	api.HandleFunc("/wallet/transactions/{id}/reversal", handlerAPI.ReverseTransaction).Methods(http.MethodPost)
 	api.HandleFunc("/wallet", handlerAPI.EnableMiniWallet).Methods(http.MethodPost)
 	api.HandleFunc("/wallet", handlerAPI.DisableMiniWallet).Methods(http.MethodPatch)
+	api.HandleFunc("/wallet/close", handlerAPI.CloseMiniWallet).Methods(http.MethodPost)
 	api.HandleFunc("/wallet/deposits", handlerAPI.DepositToMiniWallet).Methods(http.MethodPost)
 	api.HandleFunc("/wallet/withdrawals", handlerAPI.WithdrawFromMiniWallet).Methods(http.MethodPost)
+	api.HandleFunc("/wallet/withdrawals/{id}/capture", handlerAPI.CaptureWithdrawal).Methods(http.MethodPost)
+	api.HandleFunc("/wallet/withdrawals/{id}/void", handlerAPI.VoidWithdrawal).Methods(http.MethodPost)
+	api.HandleFunc("/wallet/transfers", handlerAPI.TransferFromMiniWallet).Methods(http.MethodPost)
+	api.HandleFunc("/wallet/webhooks", handlerAPI.CreateWebhook).Methods(http.MethodPost)
+	api.HandleFunc("/wallet/webhooks", handlerAPI.ViewWebhooks).Methods(http.MethodGet)
+	api.HandleFunc("/wallet/webhooks/{id}", handlerAPI.DeleteWebhook).Methods(http.MethodDelete)
+	api.HandleFunc("/wallet/webhooks/{id}/deliveries", handlerAPI.ViewWebhookDeliveries).Methods(http.MethodGet)
+	api.Use(service.AuthMiddlewareService(miniWalletDatabase, miniWalletDatabase))
+	api.Use(audit.Middleware(miniWalletDatabase))
+
+	adminAPI := handler.AdminHandler(miniWalletDatabase)
+	admin := m.PathPrefix("/admin/v1").Subrouter()
+	admin.HandleFunc("/wallets", adminAPI.SearchWallets).Methods(http.MethodGet)
+	admin.HandleFunc("/wallets/{customer_xid}/transactions", adminAPI.ViewWalletTransactions).Methods(http.MethodGet)
+	admin.HandleFunc("/wallets/{customer_xid}/enable", adminAPI.EnableWallet).Methods(http.MethodPost)
+	admin.HandleFunc("/wallets/{customer_xid}/disable", adminAPI.DisableWallet).Methods(http.MethodPost)
+	admin.HandleFunc("/wallets/{customer_xid}/freeze", adminAPI.FreezeWallet).Methods(http.MethodPost)
+	admin.HandleFunc("/wallets/{customer_xid}/close", adminAPI.CloseWallet).Methods(http.MethodPost)
+	admin.HandleFunc("/wallets/{customer_xid}/transitions", adminAPI.ViewWalletTransitions).Methods(http.MethodGet)
+	admin.HandleFunc("/wallets/{customer_xid}/adjustments", adminAPI.AdjustBalance).Methods(http.MethodPost)
+	admin.HandleFunc("/wallets/{customer_xid}/transactions/{id}/reversal", adminAPI.ReverseTransaction).Methods(http.MethodPost)
+	admin.HandleFunc("/clients", adminAPI.CreateClient).Methods(http.MethodPost)
+	admin.HandleFunc("/clients", adminAPI.ViewClients).Methods(http.MethodGet)
+	admin.HandleFunc("/clients/{client_id}/revoke", adminAPI.RevokeClient).Methods(http.MethodPost)
+	admin.HandleFunc("/clients/{client_id}/customers", adminAPI.AssignCustomer).Methods(http.MethodPost)
+	admin.HandleFunc("/audit", adminAPI.ViewAuditLog).Methods(http.MethodGet)
+	admin.HandleFunc("/audit/verify", adminAPI.VerifyAuditLog).Methods(http.MethodGet)
+	admin.Use(service.AdminAuthMiddleware())
+	admin.Use(audit.Middleware(miniWalletDatabase))
 	m.Use(mux.CORSMethodMiddleware(m))
-	m.Use(service.AuthMiddlewareService())
 
 	srvr := &http.Server{
 		Handler:      m,
@@ -59,6 +81,11 @@ func RunServer() {
 	}
 	logrus.Info("Starting on port 5000")
 
+	go expireHolds(miniWalletDatabase, config.Config.HoldsCfg.ExpiryInterval)
+	go webhook.NewDispatcher(miniWalletDatabase).Run()
+	go hub.Run()
+	go purgeTokens(miniWalletDatabase, config.Config.JWTCfg.PurgeInterval)
+
 	go func() {
 		if err := srvr.ListenAndServe(); err != nil {
 			log.Println(err)
@@ -72,4 +99,39 @@ func RunServer() {
 	defer cancel()
 	srvr.Shutdown(ctx)
 	os.Exit(0)
-}
\ No newline at end of file
+}
+
+// expireHolds releases stale withdrawal holds every interval. Running it on
+// several instances at once is safe, each hold is released only once.
+func expireHolds(repo repository.MiniWalletRepoInterface, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	for range time.Tick(interval) {
+		expired, err := repo.ExpireHolds(time.Now())
+		if err != nil {
+			logrus.Errorf("Fail to expire withdrawal holds: %v", err)
+			continue
+		}
+		if expired > 0 {
+			logrus.Infof("Expired %d withdrawal holds", expired)
+		}
+	}
+}
+
+// purgeTokens deletes expired refresh tokens and revocations every interval.
+func purgeTokens(repo repository.MiniWalletRepoInterface, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+	for range time.Tick(interval) {
+		purged, err := repo.PurgeExpiredTokens(time.Now())
+		if err != nil {
+			logrus.Errorf("Fail to purge expired tokens: %v", err)
+			continue
+		}
+		if purged > 0 {
+			logrus.Infof("Purged %d expired tokens", purged)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"github.com/Sigaeasu/go-mwe/config"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
+	"github.com/Sigaeasu/go-mwe/utils/response"
+)
+
+var ErrInvalidAdminKey = apperror.New(apperror.CodeInvalidToken, "Invalid admin key")
+
+// AdminAuthMiddleware accepts "Authorization: Admin <key>" where the SHA-256
+// of key is one of the admin keys in the config, and stores the name the key
+// is listed under as the Admin of the request.
+func AdminAuthMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Admin ")
+			if !ok || key == "" {
+				response.WriteError(w, ErrInvalidAdminKey)
+				return
+			}
+			name, ok := adminName(key)
+			if !ok {
+				response.WriteError(w, ErrInvalidAdminKey)
+				return
+			}
+			ctxt := context.WithValue(r.Context(), Admin, name)
+			next.ServeHTTP(w, r.WithContext(ctxt))
+		})
+	}
+}
+
+// AdminFromContext returns the name of the admin making the request.
+func AdminFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(Admin).(string)
+	return name
+}
+
+func adminName(key string) (string, bool) {
+	sum := sha256.Sum256([]byte(key))
+	digest := hex.EncodeToString(sum[:])
+	for name, want := range config.Config.AdminCfg.Keys {
+		if subtle.ConstantTimeCompare([]byte(digest), []byte(strings.ToLower(want))) == 1 {
+			return name, true
+		}
+	}
+	return "", false
+}
@@ -2,74 +2,78 @@ package service
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
 	"net/http"
 	"strings"
-	"github.com/Sigaeasu/go-mwe/config"
+	"time"
 	"github.com/Sigaeasu/go-mwe/utils"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
 	"github.com/Sigaeasu/go-mwe/utils/response"
-	"github.com/golang-jwt/jwt/v4"
 )
 
 type key int
 
 const (
 	Customer key = iota
+	Admin
+	Client
 )
 
-func AuthMiddlewareService() func(http.Handler) http.Handler {
+var (
+	ErrInvalidToken = apperror.New(apperror.CodeInvalidToken, "Invalid Token")
+	ErrTokenRevoked = apperror.New(apperror.CodeTokenRevoked, "Token revoked")
+	ErrTokenExpired = apperror.New(apperror.CodeInvalidToken, "Token expired")
+	ErrTokenNotValidYet = apperror.New(apperror.CodeInvalidToken, "Token not valid yet")
+	ErrTokenIssuer = apperror.New(apperror.CodeInvalidToken, "Token issued by someone else")
+	ErrTokenAudience = apperror.New(apperror.CodeInvalidToken, "Token meant for someone else")
+	ErrTokenClaims = apperror.New(apperror.CodeInvalidToken, "Token lacks exp, customer_xid or jti")
+)
+
+// TokenRevocations tells whether the access token with the jti was revoked.
+type TokenRevocations interface {
+	IsTokenRevoked(jti string) (bool, error)
+}
+
+// AuthMiddlewareService accepts "Authorization: Token <access token>" when
+// the token passes ParseToken and was not revoked, and stores its claims as
+// the Customer of the request. /init takes the credentials of an API client
+// instead, whose ID is stored as the Client of the request.
+func AuthMiddlewareService(revocations TokenRevocations, clients APIClients) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			jwtConfig := config.Config.JWTCfg
-			authorizationHeader := r.Header.Get("Authorization")
-			url_to_skip_auth_check := []string{"/api/v1/init",}
+			if r.URL.Path == "/api/v1/init" {
+				clientID, err := authenticateClient(clients, r)
+				if err != nil {
+					response.WriteError(w, err)
+					return
+				}
+				ctxt := context.WithValue(r.Context(), Client, clientID)
+				next.ServeHTTP(w, r.WithContext(ctxt))
+				return
+			}
+			url_to_skip_auth_check := []string{"/api/v1/token/refresh",}
 			skip_check := utils.Contains(r.URL.Path, url_to_skip_auth_check)
 			if skip_check {
 				next.ServeHTTP(w, r)
 				return
 			}
-			if !strings.Contains(authorizationHeader, "Token") {
-				w.Header().Set("Content-type", "application/json")
-				w.WriteHeader(http.StatusUnauthorized)
-				json.NewEncoder(w).Encode(response.ResponseAPI{
-					Error_: &response.ApiError{
-						Error: "Invalid Token",
-					},
-				})
+			tokenString, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Token ")
+			if !ok || tokenString == "" {
+				response.WriteError(w, ErrInvalidToken)
 				return
 			}
-			tokenString := strings.Replace(authorizationHeader, "Token ", "", -1)
-
-			token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-				if method, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, fmt.Errorf("Signing Method Invalid")
-				} else if method != JWT_SIGNING_METHOD {
-					return nil, fmt.Errorf("Signing Method Invalid")
-				}
 
-				return []byte(jwtConfig.SignKey), nil
-			})
+			claims, err := ParseToken(tokenString, time.Now())
 			if err != nil {
-				w.Header().Set("Content-type", "application/json")
-				w.WriteHeader(http.StatusUnauthorized)
-				json.NewEncoder(w).Encode(response.ResponseAPI{
-					Error_: &response.ApiError{
-						Error: err.Error(),
-					},
-				})
+				response.WriteError(w, err)
 				return
 			}
-
-			claims, ok := token.Claims.(jwt.MapClaims)
-			if !ok || !token.Valid {
-				w.Header().Set("Content-type", "application/json")
-				w.WriteHeader(http.StatusUnauthorized)
-				json.NewEncoder(w).Encode(response.ResponseAPI{
-					Error_: &response.ApiError{
-						Error: err.Error(),
-					},
-				})
+			revoked, err := revocations.IsTokenRevoked(claims.ID)
+			if err != nil {
+				response.WriteError(w, err)
+				return
+			}
+			if revoked {
+				response.WriteError(w, ErrTokenRevoked)
 				return
 			}
 
@@ -79,3 +83,18 @@ func AuthMiddlewareService() func(http.Handler) http.Handler {
 		})
 	}
 }
+
+// ClaimsFromContext returns the claims of the access token of the request.
+func ClaimsFromContext(ctx context.Context) (*MyClaims, bool) {
+	claims, ok := ctx.Value(Customer).(*MyClaims)
+	return claims, ok
+}
+
+// CustomerFromContext returns the customer_xid of the access token of the
+// request, or "" without one.
+func CustomerFromContext(ctx context.Context) string {
+	if claims, ok := ClaimsFromContext(ctx); ok {
+		return claims.CustomerXId
+	}
+	return ""
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
+	"github.com/Sigaeasu/go-mwe/utils/validation"
+)
+
+var ErrInvalidClient = apperror.New(apperror.CodeInvalidClient, "Invalid client credentials")
+
+// APIClients looks up the API clients that may call /init.
+type APIClients interface {
+	FetchAPIClient(clientID string) (*entity.APIClient, error)
+}
+
+// NewAPIClient returns a random client secret and the record the server
+// keeps of the client, which only holds the secret's hash.
+func NewAPIClient(name string, now time.Time) (string, entity.APIClient, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", entity.APIClient{}, err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(raw)
+	return secret, entity.APIClient{
+		ID: newUUID(),
+		Name: name,
+		SecretHash: HashClientSecret(secret),
+		CreatedAt: now,
+	}, nil
+}
+
+// HashClientSecret is what is stored of a client secret.
+func HashClientSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// ClientFromContext returns the ID of the API client making the request.
+func ClientFromContext(ctx context.Context) string {
+	clientID, _ := ctx.Value(Client).(string)
+	return clientID
+}
+
+// authenticateClient checks "Authorization: Basic" with the client ID as
+// user and its secret as password, and returns the client ID. Unknown and
+// revoked clients get the same answer as a wrong secret.
+func authenticateClient(clients APIClients, r *http.Request) (string, error) {
+	clientID, secret, ok := r.BasicAuth()
+	if !ok || !validation.IsUUID(clientID) || secret == "" {
+		return "", ErrInvalidClient
+	}
+	clientID = strings.ToLower(clientID)
+	client, err := clients.FetchAPIClient(clientID)
+	if apperror.CodeOf(err) == apperror.CodeClientNotFound {
+		return "", ErrInvalidClient
+	}
+	if err != nil {
+		return "", err
+	}
+	digest := HashClientSecret(secret)
+	if subtle.ConstantTimeCompare([]byte(digest), []byte(client.SecretHash)) != 1 || !client.RevokedAt.IsZero() {
+		return "", ErrInvalidClient
+	}
+	return client.ID, nil
+}
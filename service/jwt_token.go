@@ -1,37 +1,177 @@
 package service
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
 	"time"
 	"github.com/Sigaeasu/go-mwe/config"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/utils/validation"
 	"github.com/golang-jwt/jwt/v4"
 )
 
-var JWT_SIGNING_METHOD = jwt.SigningMethodHS256
+const (
+	DefaultIssuer = "mini wallet JWT App"
+	DefaultAudience = "mini-wallet"
+	DefaultAccessTTL = 15 * time.Minute
+	DefaultRefreshTTL = 30 * 24 * time.Hour
+)
 
 type MyClaims struct {
 	jwt.RegisteredClaims
 	CustomerXId string `json:"customer_xid"`
 }
 
-func GenerateToken(customerXId string) (string, error) {
-	jwtConfig := config.Config.JWTCfg
+// GenerateToken signs an access token for the customer with the current key
+// of the rotation schedule, named by the kid header. jti names the token in
+// the revocation list.
+func GenerateToken(customerXId string, jti string, expiresAt time.Time) (string, error) {
+	keys, err := Keys()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	key, err := keys.Signing(now)
+	if err != nil {
+		return "", err
+	}
 	claims := MyClaims{
 		RegisteredClaims: jwt.RegisteredClaims{
-			Issuer: jwtConfig.Issuer,
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Duration(jwtConfig.Exp) * time.Hour)),
+			ID: jti,
+			Issuer: issuer(),
+			Audience: jwt.ClaimStrings{audience()},
+			IssuedAt: jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
 		},
 		CustomerXId: customerXId,
 	}
 
 	token := jwt.NewWithClaims(
-		JWT_SIGNING_METHOD,
+		key.Method,
 		claims,
 	)
+	token.Header["kid"] = key.ID
 
-	signedToken, err := token.SignedString([]byte(jwtConfig.SignKey))
+	signedToken, err := token.SignedString(key.Private)
 	if err != nil {
 		return "", err
 	}
 
 	return signedToken, nil
 }
+
+// ParseToken verifies the signature of an access token against the key named
+// by its kid and its claims at now: exp, nbf and iat within jwt.leeway, iss,
+// aud and that exp, customer_xid and jti are set.
+func ParseToken(tokenString string, now time.Time) (*MyClaims, error) {
+	keys, err := Keys()
+	if err != nil {
+		return nil, err
+	}
+	claims := &MyClaims{}
+	// The claims are checked below, with leeway.
+	parser := jwt.NewParser(jwt.WithoutClaimsValidation())
+	_, err = parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keys.Verifying(kid, now)
+		if !ok {
+			return nil, fmt.Errorf("Unknown key %q", kid)
+		}
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, fmt.Errorf("Signing Method Invalid")
+		}
+
+		return key.Private.Public(), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if err := claims.verify(now); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (c *MyClaims) verify(now time.Time) error {
+	leeway := config.Config.JWTCfg.Leeway
+	switch {
+	case c.ExpiresAt == nil, !validation.IsUUID(c.CustomerXId), !validation.IsUUID(c.ID):
+		return ErrTokenClaims
+	case !c.VerifyExpiresAt(now.Add(-leeway), true):
+		return ErrTokenExpired
+	case !c.VerifyNotBefore(now.Add(leeway), false), !c.VerifyIssuedAt(now.Add(leeway), false):
+		return ErrTokenNotValidYet
+	case !c.VerifyIssuer(issuer(), true):
+		return ErrTokenIssuer
+	case !c.VerifyAudience(audience(), true):
+		return ErrTokenAudience
+	}
+	return nil
+}
+
+// NewRefreshToken returns a random refresh token and the record the server
+// keeps of it, in a family of its own. The record also names the access
+// token to issue with it, valid for jwt.access_ttl.
+func NewRefreshToken(now time.Time) (string, entity.RefreshToken, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", entity.RefreshToken{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(secret)
+	id := newUUID()
+	return token, entity.RefreshToken{
+		ID: id,
+		FamilyID: id,
+		TokenHash: HashRefreshToken(token),
+		AccessJTI: newUUID(),
+		AccessExpiresAt: now.Add(accessTTL()),
+		CreatedAt: now,
+		ExpiresAt: now.Add(refreshTTL()),
+	}, nil
+}
+
+// HashRefreshToken is what is stored of a refresh token.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func issuer() string {
+	if iss := config.Config.JWTCfg.Issuer; iss != "" {
+		return iss
+	}
+	return DefaultIssuer
+}
+
+func audience() string {
+	if aud := config.Config.JWTCfg.Audience; aud != "" {
+		return aud
+	}
+	return DefaultAudience
+}
+
+func accessTTL() time.Duration {
+	if ttl := config.Config.JWTCfg.AccessTTL; ttl > 0 {
+		return ttl
+	}
+	return DefaultAccessTTL
+}
+
+func refreshTTL() time.Duration {
+	if ttl := config.Config.JWTCfg.RefreshTTL; ttl > 0 {
+		return ttl
+	}
+	return DefaultRefreshTTL
+}
+
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+	"github.com/Sigaeasu/go-mwe/config"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	testCustomer = "3f5c2e2a-7d1b-4c8e-9a6f-1b2c3d4e5f60"
+	testJTI = "9b1d7c3e-2f4a-4b6c-8d0e-1a2b3c4d5e6f"
+)
+
+// useKeys makes Keys return set for the rest of the test binary.
+func useKeys(set *KeySet) {
+	keysOnce.Do(func() {})
+	keySet, keysErr = set, nil
+}
+
+// useJWTConfig sets the jwt section of the config for one test.
+func useJWTConfig(t *testing.T, leeway time.Duration) {
+	saved := config.Config.JWTCfg
+	t.Cleanup(func() { config.Config.JWTCfg = saved })
+	config.Config.JWTCfg.Issuer = ""
+	config.Config.JWTCfg.Audience = ""
+	config.Config.JWTCfg.Leeway = leeway
+}
+
+// validClaims were issued at epoch and expire 15 minutes later.
+func validClaims() MyClaims {
+	return MyClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID: testJTI,
+			Issuer: DefaultIssuer,
+			Audience: jwt.ClaimStrings{DefaultAudience},
+			IssuedAt: jwt.NewNumericDate(epoch),
+			NotBefore: jwt.NewNumericDate(epoch),
+			ExpiresAt: jwt.NewNumericDate(epoch.Add(15 * time.Minute)),
+		},
+		CustomerXId: testCustomer,
+	}
+}
+
+func TestVerifyClaims(t *testing.T) {
+	useJWTConfig(t, 30*time.Second)
+	tests := []struct {
+		name string
+		change func(c *MyClaims)
+		at time.Duration
+		want error
+	}{
+		{"valid", func(c *MyClaims) {}, time.Minute, nil},
+		{"expired within leeway", func(c *MyClaims) {}, 15*time.Minute + 29*time.Second, nil},
+		{"expired", func(c *MyClaims) {}, 15*time.Minute + 31*time.Second, ErrTokenExpired},
+		{"issued within leeway", func(c *MyClaims) {}, -29 * time.Second, nil},
+		{"not valid yet", func(c *MyClaims) { c.IssuedAt = nil }, -31 * time.Second, ErrTokenNotValidYet},
+		{"issued in the future", func(c *MyClaims) { c.NotBefore = nil }, -31 * time.Second, ErrTokenNotValidYet},
+		{"no nbf or iat", func(c *MyClaims) { c.NotBefore, c.IssuedAt = nil, nil }, time.Minute, nil},
+		{"no exp", func(c *MyClaims) { c.ExpiresAt = nil }, time.Minute, ErrTokenClaims},
+		{"no customer", func(c *MyClaims) { c.CustomerXId = "" }, time.Minute, ErrTokenClaims},
+		{"customer not a UUID", func(c *MyClaims) { c.CustomerXId = "cust-1" }, time.Minute, ErrTokenClaims},
+		{"no jti", func(c *MyClaims) { c.ID = "" }, time.Minute, ErrTokenClaims},
+		{"other issuer", func(c *MyClaims) { c.Issuer = "someone else" }, time.Minute, ErrTokenIssuer},
+		{"no issuer", func(c *MyClaims) { c.Issuer = "" }, time.Minute, ErrTokenIssuer},
+		{"other audience", func(c *MyClaims) { c.Audience = jwt.ClaimStrings{"billing"} }, time.Minute, ErrTokenAudience},
+		{"one of several audiences", func(c *MyClaims) { c.Audience = jwt.ClaimStrings{"billing", DefaultAudience} }, time.Minute, nil},
+		{"no audience", func(c *MyClaims) { c.Audience = nil }, time.Minute, ErrTokenAudience},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := validClaims()
+			tt.change(&claims)
+			if err := claims.verify(epoch.Add(tt.at)); err != tt.want {
+				t.Errorf("got %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseToken(t *testing.T) {
+	useJWTConfig(t, 0)
+	set := rotation(t)
+	useKeys(set)
+	sign := func(kid string, method jwt.SigningMethod, claims MyClaims) string {
+		t.Helper()
+		key, _ := set.Verifying(kid, epoch)
+		token := jwt.NewWithClaims(method, claims)
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(key.Private)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	valid := sign("old", jwt.SigningMethodEdDSA, validClaims())
+	tampered := []byte(valid)
+	tampered[len(tampered)-2] ^= 1
+	otherCustomer := validClaims()
+	otherCustomer.CustomerXId = "00000000-0000-4000-8000-000000000000"
+	swapped := sign("old", jwt.SigningMethodEdDSA, otherCustomer)
+	unknownKid := jwt.NewWithClaims(jwt.SigningMethodEdDSA, validClaims())
+	unknownKid.Header["kid"] = "unknown"
+	unknown, _ := unknownKid.SignedString(set.keys[0].Private)
+	none, _ := jwt.NewWithClaims(jwt.SigningMethodNone, validClaims()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+
+	tests := []struct {
+		name string
+		token string
+		at time.Duration
+		want error
+	}{
+		{"valid", valid, time.Minute, nil},
+		{"expired", valid, time.Hour, ErrTokenExpired},
+		{"tampered signature", string(tampered), time.Minute, ErrInvalidToken},
+		{"signature of another token", valid[:strings.LastIndex(valid, ".")] + swapped[strings.LastIndex(swapped, "."):], time.Minute, ErrInvalidToken},
+		{"unknown kid", unknown, time.Minute, ErrInvalidToken},
+		{"unsigned", none, time.Minute, ErrInvalidToken},
+		{"key no longer published", valid, 12 * time.Hour, ErrInvalidToken},
+		{"garbage", "not.a.token", time.Minute, ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := ParseToken(tt.token, epoch.Add(tt.at))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if err == nil && (claims.CustomerXId != testCustomer || claims.ID != testJTI) {
+				t.Errorf("claims = %+v", claims)
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	"github.com/Sigaeasu/go-mwe/config"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// Signing algorithms a key may use.
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+	AlgorithmEdDSA = "EdDSA"
+)
+
+const minRSABits = 2048
+
+var ErrNoSigningKey = errors.New("no JWT key may sign now, check jwt.keys")
+
+// SigningKey signs tokens from SignFrom until SignUntil, which is zero for a
+// key without a planned end.
+type SigningKey struct {
+	ID string
+	Method jwt.SigningMethod
+	Private crypto.Signer
+	SignFrom time.Time
+	SignUntil time.Time
+}
+
+// KeySet holds the keys of the rotation schedule. A key is published in the
+// JWKS and accepted from Overlap before it starts signing, so verifiers have
+// it cached by then, until Overlap after it stops, so the tokens it signed
+// stay valid until they expire.
+type KeySet struct {
+	keys []SigningKey
+	Overlap time.Duration
+}
+
+var (
+	keysOnce sync.Once
+	keySet *KeySet
+	keysErr error
+)
+
+// Keys returns the key set of the jwt section of the config, loaded once.
+// Without jwt.keys an ephemeral EdDSA key is generated, so tokens do not
+// survive a restart and no other instance accepts them.
+func Keys() (*KeySet, error) {
+	keysOnce.Do(func() {
+		keySet, keysErr = loadKeys()
+	})
+	return keySet, keysErr
+}
+
+func loadKeys() (*KeySet, error) {
+	jwtConfig := config.Config.JWTCfg
+	set := &KeySet{Overlap: jwtConfig.RotationOverlap}
+	// Tokens live for accessTTL, so a shorter overlap would refuse some.
+	if set.Overlap < accessTTL() {
+		set.Overlap = accessTTL()
+	}
+
+	if len(jwtConfig.Keys) == 0 {
+		logrus.Warn("No jwt.keys configured, signing with an ephemeral key")
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		id := make([]byte, 8)
+		rand.Read(id)
+		set.keys = append(set.keys, SigningKey{
+			ID: "ephemeral-" + hex.EncodeToString(id),
+			Method: jwt.SigningMethodEdDSA,
+			Private: private,
+		})
+		return set, nil
+	}
+
+	seen := map[string]bool{}
+	for i, cfg := range jwtConfig.Keys {
+		key, err := loadKey(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("jwt.keys[%d]: %w", i, err)
+		}
+		if seen[key.ID] {
+			return nil, fmt.Errorf("jwt.keys[%d]: kid %q is used twice", i, key.ID)
+		}
+		seen[key.ID] = true
+		set.keys = append(set.keys, *key)
+	}
+	sort.Slice(set.keys, func(i, j int) bool {
+		return set.keys[i].SignFrom.Before(set.keys[j].SignFrom)
+	})
+	return set, nil
+}
+
+func loadKey(cfg config.JWTKey) (*SigningKey, error) {
+	if cfg.ID == "" {
+		return nil, errors.New("kid is empty")
+	}
+	key := &SigningKey{ID: cfg.ID}
+	var err error
+	if cfg.SignFrom != "" {
+		if key.SignFrom, err = time.Parse(time.RFC3339, cfg.SignFrom); err != nil {
+			return nil, fmt.Errorf("sign_from: %w", err)
+		}
+	}
+	if cfg.SignUntil != "" {
+		if key.SignUntil, err = time.Parse(time.RFC3339, cfg.SignUntil); err != nil {
+			return nil, fmt.Errorf("sign_until: %w", err)
+		}
+		if !key.SignUntil.After(key.SignFrom) {
+			return nil, errors.New("sign_until is not after sign_from")
+		}
+	}
+
+	path := cfg.PrivateKeyFile
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(config.GetAppBasePath(), path)
+	}
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch cfg.Algorithm {
+	case AlgorithmRS256:
+		private, err := jwt.ParseRSAPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, err
+		}
+		if private.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA keys need at least %d bits", minRSABits)
+		}
+		key.Method, key.Private = jwt.SigningMethodRS256, private
+	case AlgorithmES256:
+		private, err := jwt.ParseECPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, err
+		}
+		if private.Curve != elliptic.P256() {
+			return nil, errors.New("ES256 needs a P-256 key")
+		}
+		key.Method, key.Private = jwt.SigningMethodES256, private
+	case AlgorithmEdDSA:
+		private, err := jwt.ParseEdPrivateKeyFromPEM(pem)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := private.(ed25519.PrivateKey)
+		if !ok {
+			return nil, errors.New("EdDSA needs an Ed25519 key")
+		}
+		key.Method, key.Private = jwt.SigningMethodEdDSA, signer
+	default:
+		return nil, fmt.Errorf("algorithm %q is not one of %s, %s, %s", cfg.Algorithm, AlgorithmRS256, AlgorithmES256, AlgorithmEdDSA)
+	}
+	return key, nil
+}
+
+// Signing returns the key to sign with at now: of the keys whose schedule
+// covers now, the one that started last.
+func (s *KeySet) Signing(now time.Time) (*SigningKey, error) {
+	var signing *SigningKey
+	for i := range s.keys {
+		k := &s.keys[i]
+		if now.Before(k.SignFrom) || (!k.SignUntil.IsZero() && !now.Before(k.SignUntil)) {
+			continue
+		}
+		signing = k
+	}
+	if signing == nil {
+		return nil, ErrNoSigningKey
+	}
+	return signing, nil
+}
+
+// Verifying returns the key with the kid if tokens it signed are accepted
+// at now.
+func (s *KeySet) Verifying(kid string, now time.Time) (*SigningKey, bool) {
+	for i := range s.keys {
+		if s.keys[i].ID == kid && s.published(s.keys[i], now) {
+			return &s.keys[i], true
+		}
+	}
+	return nil, false
+}
+
+// JWKS is the JSON Web Key Set of the keys published at now.
+func (s *KeySet) JWKS(now time.Time) JSONWebKeySet {
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, k := range s.keys {
+		if s.published(k, now) {
+			set.Keys = append(set.Keys, publicJWK(k))
+		}
+	}
+	return set
+}
+
+func (s *KeySet) published(k SigningKey, now time.Time) bool {
+	if now.Before(k.SignFrom.Add(-s.Overlap)) {
+		return false
+	}
+	return k.SignUntil.IsZero() || now.Before(k.SignUntil.Add(s.Overlap))
+}
+
+// JSONWebKeySet is served at /.well-known/jwks.json, see RFC 7517.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+type JSONWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID string `json:"kid"`
+	Use string `json:"use"`
+	Algorithm string `json:"alg"`
+	Curve string `json:"crv,omitempty"`
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	X string `json:"x,omitempty"`
+	Y string `json:"y,omitempty"`
+}
+
+func publicJWK(k SigningKey) JSONWebKey {
+	jwk := JSONWebKey{
+		KeyID: k.ID,
+		Use: "sig",
+		Algorithm: k.Method.Alg(),
+	}
+	switch public := k.Private.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64URL(public.N.Bytes())
+		jwk.E = base64URL(big.NewInt(int64(public.E)).Bytes())
+	case *ecdsa.PublicKey:
+		jwk.KeyType = "EC"
+		jwk.Curve = "P-256"
+		jwk.X = base64URL(public.X.FillBytes(make([]byte, 32)))
+		jwk.Y = base64URL(public.Y.FillBytes(make([]byte, 32)))
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64URL(public)
+	}
+	return jwk
+}
+
+func base64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
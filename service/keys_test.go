@@ -0,0 +1,216 @@
+package service
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"github.com/Sigaeasu/go-mwe/config"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var epoch = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func edKey(t *testing.T, id string, from time.Time, until time.Time) SigningKey {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return SigningKey{ID: id, Method: jwt.SigningMethodEdDSA, Private: private, SignFrom: from, SignUntil: until}
+}
+
+// rotation has "old" signing until epoch+10h and "new" from then on, each
+// published an hour around its schedule.
+func rotation(t *testing.T) *KeySet {
+	return &KeySet{
+		keys: []SigningKey{
+			edKey(t, "old", time.Time{}, epoch.Add(10*time.Hour)),
+			edKey(t, "new", epoch.Add(10*time.Hour), time.Time{}),
+		},
+		Overlap: time.Hour,
+	}
+}
+
+func TestSigning(t *testing.T) {
+	set := rotation(t)
+	set.keys = append(set.keys, edKey(t, "window", epoch.Add(20*time.Hour), epoch.Add(21*time.Hour)))
+	tests := []struct {
+		at time.Duration
+		want string
+	}{
+		{0, "old"},
+		{10*time.Hour - time.Nanosecond, "old"},
+		{10 * time.Hour, "new"},
+		{20 * time.Hour, "window"},
+		{21 * time.Hour, "new"},
+	}
+	for _, tt := range tests {
+		key, err := set.Signing(epoch.Add(tt.at))
+		if err != nil {
+			t.Fatalf("at %v: %v", tt.at, err)
+		}
+		if key.ID != tt.want {
+			t.Errorf("at %v signs with %s, want %s", tt.at, key.ID, tt.want)
+		}
+	}
+
+	ended := &KeySet{keys: []SigningKey{edKey(t, "ended", time.Time{}, epoch)}}
+	if _, err := ended.Signing(epoch); err != ErrNoSigningKey {
+		t.Errorf("got %v after the last key ended, want %v", err, ErrNoSigningKey)
+	}
+}
+
+func TestVerifyingAndJWKS(t *testing.T) {
+	set := rotation(t)
+	tests := []struct {
+		at time.Duration
+		published []string
+	}{
+		{0, []string{"old"}},
+		{9*time.Hour - time.Nanosecond, []string{"old"}},
+		{9 * time.Hour, []string{"old", "new"}},
+		{11*time.Hour - time.Nanosecond, []string{"old", "new"}},
+		{11 * time.Hour, []string{"new"}},
+	}
+	for _, tt := range tests {
+		now := epoch.Add(tt.at)
+		jwks := set.JWKS(now)
+		var kids []string
+		for _, k := range jwks.Keys {
+			kids = append(kids, k.KeyID)
+		}
+		if strings.Join(kids, ",") != strings.Join(tt.published, ",") {
+			t.Errorf("at %v publishes %v, want %v", tt.at, kids, tt.published)
+		}
+		for _, kid := range []string{"old", "new"} {
+			_, ok := set.Verifying(kid, now)
+			want := strings.Contains(strings.Join(tt.published, ","), kid)
+			if ok != want {
+				t.Errorf("at %v Verifying(%s) = %v, want %v", tt.at, kid, ok, want)
+			}
+		}
+	}
+	if _, ok := set.Verifying("unknown", epoch); ok {
+		t.Error("unknown kid is accepted")
+	}
+}
+
+func TestPublicJWK(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edPrivate, _ := ed25519.GenerateKey(rand.Reader)
+
+	rsaJWK := publicJWK(SigningKey{ID: "r", Method: jwt.SigningMethodRS256, Private: rsaKey})
+	if rsaJWK.KeyType != "RSA" || rsaJWK.Algorithm != "RS256" || rsaJWK.Use != "sig" || rsaJWK.E != "AQAB" {
+		t.Errorf("RSA JWK = %+v", rsaJWK)
+	}
+	if n := new(big.Int).SetBytes(decode(t, rsaJWK.N)); n.Cmp(rsaKey.N) != 0 {
+		t.Error("RSA JWK has the wrong modulus")
+	}
+
+	ecJWK := publicJWK(SigningKey{ID: "e", Method: jwt.SigningMethodES256, Private: ecKey})
+	if ecJWK.KeyType != "EC" || ecJWK.Curve != "P-256" || len(decode(t, ecJWK.X)) != 32 || len(decode(t, ecJWK.Y)) != 32 {
+		t.Errorf("EC JWK = %+v", ecJWK)
+	}
+	if new(big.Int).SetBytes(decode(t, ecJWK.X)).Cmp(ecKey.X) != 0 || new(big.Int).SetBytes(decode(t, ecJWK.Y)).Cmp(ecKey.Y) != 0 {
+		t.Error("EC JWK has the wrong point")
+	}
+
+	edJWK := publicJWK(SigningKey{ID: "o", Method: jwt.SigningMethodEdDSA, Private: edPrivate})
+	if edJWK.KeyType != "OKP" || edJWK.Curve != "Ed25519" || edJWK.Algorithm != "EdDSA" {
+		t.Errorf("Ed25519 JWK = %+v", edJWK)
+	}
+	if string(decode(t, edJWK.X)) != string(edPrivate.Public().(ed25519.PublicKey)) {
+		t.Error("Ed25519 JWK has the wrong public key")
+	}
+}
+
+func decode(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		t.Fatalf("%q is not base64url: %v", s, err)
+	}
+	return b
+}
+
+func TestLoadKey(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, block *pem.Block) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	weakRSA, _ := rsa.GenerateKey(rand.Reader, 1024)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	pkcs8 := func(key interface{}) *pem.Block {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+	rsaFile := write("rsa.pem", &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+	weakFile := write("weak.pem", &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(weakRSA)})
+	ecFile := write("ec.pem", pkcs8(ecKey))
+	p384File := write("p384.pem", pkcs8(p384))
+	edFile := write("ed.pem", pkcs8(edKey))
+
+	tests := []struct {
+		name string
+		cfg config.JWTKey
+		alg string
+		err string
+	}{
+		{"RS256", config.JWTKey{ID: "a", Algorithm: AlgorithmRS256, PrivateKeyFile: rsaFile}, "RS256", ""},
+		{"ES256", config.JWTKey{ID: "a", Algorithm: AlgorithmES256, PrivateKeyFile: ecFile}, "ES256", ""},
+		{"EdDSA", config.JWTKey{ID: "a", Algorithm: AlgorithmEdDSA, PrivateKeyFile: edFile, SignFrom: "2026-01-01T00:00:00Z", SignUntil: "2026-02-01T00:00:00Z"}, "EdDSA", ""},
+		{"no kid", config.JWTKey{Algorithm: AlgorithmEdDSA, PrivateKeyFile: edFile}, "", "kid is empty"},
+		{"short RSA key", config.JWTKey{ID: "a", Algorithm: AlgorithmRS256, PrivateKeyFile: weakFile}, "", "at least 2048 bits"},
+		{"P-384 key", config.JWTKey{ID: "a", Algorithm: AlgorithmES256, PrivateKeyFile: p384File}, "", "P-256"},
+		{"RSA key for EdDSA", config.JWTKey{ID: "a", Algorithm: AlgorithmEdDSA, PrivateKeyFile: rsaFile}, "", "key"},
+		{"HS256", config.JWTKey{ID: "a", Algorithm: "HS256", PrivateKeyFile: edFile}, "", "is not one of"},
+		{"missing file", config.JWTKey{ID: "a", Algorithm: AlgorithmEdDSA, PrivateKeyFile: filepath.Join(dir, "missing.pem")}, "", "no such file"},
+		{"bad sign_from", config.JWTKey{ID: "a", Algorithm: AlgorithmEdDSA, PrivateKeyFile: edFile, SignFrom: "tomorrow"}, "", "sign_from"},
+		{"empty schedule", config.JWTKey{ID: "a", Algorithm: AlgorithmEdDSA, PrivateKeyFile: edFile, SignFrom: "2026-02-01T00:00:00Z", SignUntil: "2026-01-01T00:00:00Z"}, "", "not after sign_from"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := loadKey(tt.cfg)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got %v, want an error containing %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if key.Method.Alg() != tt.alg {
+				t.Errorf("algorithm %s, want %s", key.Method.Alg(), tt.alg)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package apperror
+
+import (
+	"errors"
+	"sort"
+)
+
+// Code is the machine-readable identifier of an error sent to clients.
+type Code string
+
+const (
+	CodeBadRequest Code = "BAD_REQUEST"
+	CodeValidation Code = "VALIDATION_FAILED"
+	CodePayloadTooLarge Code = "PAYLOAD_TOO_LARGE"
+	CodeFieldTooLong Code = "FIELD_TOO_LONG"
+	CodeInvalidUUID Code = "INVALID_UUID"
+	CodeMissingField Code = "MISSING_FIELD"
+	CodeInvalidAmount Code = "INVALID_AMOUNT"
+	CodeUnsupportedCurrency Code = "UNSUPPORTED_CURRENCY"
+	CodeInvalidCursor Code = "INVALID_CURSOR"
+	CodeInvalidToken Code = "INVALID_TOKEN"
+	CodeTokenRevoked Code = "TOKEN_REVOKED"
+	CodeTokenReused Code = "REFRESH_TOKEN_REUSED"
+	CodeInvalidClient Code = "INVALID_CLIENT"
+	CodeClientNotFound Code = "CLIENT_NOT_FOUND"
+	CodeClientRevoked Code = "CLIENT_REVOKED"
+	CodeCustomerNotInScope Code = "CUSTOMER_NOT_IN_SCOPE"
+	CodeCustomerNotFound Code = "CUSTOMER_NOT_FOUND"
+	CodeTargetNotFound Code = "TARGET_WALLET_NOT_FOUND"
+	CodeWalletDisabled Code = "WALLET_DISABLED"
+	CodeTargetDisabled Code = "TARGET_WALLET_DISABLED"
+	CodeWalletAlreadyEnabled Code = "WALLET_ALREADY_ENABLED"
+	CodeWalletAlreadyDisabled Code = "WALLET_ALREADY_DISABLED"
+	CodeWalletFrozen Code = "WALLET_FROZEN"
+	CodeWalletAlreadyFrozen Code = "WALLET_ALREADY_FROZEN"
+	CodeWalletClosed Code = "WALLET_CLOSED"
+	CodeInvalidTransition Code = "INVALID_STATUS_TRANSITION"
+	CodePendingWithdrawals Code = "PENDING_WITHDRAWALS"
+	CodeBalanceNotZero Code = "BALANCE_NOT_ZERO"
+	CodeDuplicateReference Code = "DUPLICATE_REFERENCE"
+	CodeReferenceInProgress Code = "REFERENCE_IN_PROGRESS"
+	CodeInsufficientFunds Code = "INSUFFICIENT_FUNDS"
+	CodeSelfTransfer Code = "SELF_TRANSFER"
+	CodeHoldNotFound Code = "WITHDRAWAL_NOT_FOUND"
+	CodeHoldNotPending Code = "WITHDRAWAL_NOT_PENDING"
+	CodeHoldExpired Code = "WITHDRAWAL_EXPIRED"
+	CodeWebhookNotFound Code = "WEBHOOK_NOT_FOUND"
+	CodeURLNotAllowed Code = "URL_NOT_ALLOWED"
+	CodeTransactionNotFound Code = "TRANSACTION_NOT_FOUND"
+	CodeNotReversible Code = "TRANSACTION_NOT_REVERSIBLE"
+	CodeReversalExceedsOriginal Code = "REVERSAL_EXCEEDS_ORIGINAL"
+	CodeReversalNotAllowed Code = "REVERSAL_NOT_ALLOWED"
+	CodeCurrencyMismatch Code = "CURRENCY_MISMATCH"
+	CodeAmountBelowMinimum Code = "AMOUNT_BELOW_MINIMUM"
+	CodeAmountAboveMaximum Code = "AMOUNT_ABOVE_MAXIMUM"
+	CodeDailyLimitExceeded Code = "DAILY_LIMIT_EXCEEDED"
+	CodeMonthlyLimitExceeded Code = "MONTHLY_LIMIT_EXCEEDED"
+	CodeVelocityLimitExceeded Code = "VELOCITY_LIMIT_EXCEEDED"
+	CodeNoDrift Code = "NO_DRIFT"
+	CodeInternal Code = "INTERNAL_ERROR"
+)
+
+// Error is an error with a code from the catalogue. Packages declare their
+// failures as *Error sentinels and may wrap them with fmt.Errorf("%w") to add
+// detail; errors.As still finds the code.
+type Error struct {
+	Code Code
+	Message string
+	Fields []FieldError
+}
+
+// FieldError explains why one field of a request was rejected.
+type FieldError struct {
+	Field string `json:"field"`
+	Code Code `json:"code"`
+	Message string `json:"message"`
+}
+
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Invalid returns a VALIDATION_FAILED error listing every rejected field.
+func Invalid(fields []FieldError) *Error {
+	sort.SliceStable(fields, func(i, j int) bool {
+		return fields[i].Field < fields[j].Field
+	})
+	return &Error{Code: CodeValidation, Message: "Request validation failed", Fields: fields}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// CodeOf returns the code of err, or INTERNAL_ERROR when it is not part of
+// the catalogue.
+func CodeOf(err error) Code {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr.Code
+	}
+	return CodeInternal
+}
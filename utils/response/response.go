@@ -1,5 +1,13 @@
 package response
 
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
+	"github.com/sirupsen/logrus"
+)
+
 type ResponseAPI struct {
 	Status string `json:"status,omitempty"`
 	Data interface{} `json:"data,omitempty"`
@@ -7,5 +15,97 @@ type ResponseAPI struct {
 }
 
 type ApiError struct {
-	Error string `json: "error`
+	Code apperror.Code `json:"code"`
+	Message string `json:"message"`
+	Fields []apperror.FieldError `json:"fields,omitempty"`
+}
+
+// statusCodes maps every error code to the HTTP status it is sent with.
+// Codes missing here are sent as 500.
+var statusCodes = map[apperror.Code]int{
+	apperror.CodeBadRequest: http.StatusBadRequest,
+	apperror.CodeValidation: http.StatusBadRequest,
+	apperror.CodePayloadTooLarge: http.StatusRequestEntityTooLarge,
+	apperror.CodeMissingField: http.StatusBadRequest,
+	apperror.CodeInvalidAmount: http.StatusBadRequest,
+	apperror.CodeUnsupportedCurrency: http.StatusBadRequest,
+	apperror.CodeInvalidCursor: http.StatusBadRequest,
+	apperror.CodeInvalidToken: http.StatusUnauthorized,
+	apperror.CodeTokenRevoked: http.StatusUnauthorized,
+	apperror.CodeTokenReused: http.StatusUnauthorized,
+	apperror.CodeInvalidClient: http.StatusUnauthorized,
+	apperror.CodeCustomerNotInScope: http.StatusForbidden,
+	apperror.CodeCustomerNotFound: http.StatusNotFound,
+	apperror.CodeTargetNotFound: http.StatusNotFound,
+	apperror.CodeHoldNotFound: http.StatusNotFound,
+	apperror.CodeTransactionNotFound: http.StatusNotFound,
+	apperror.CodeWebhookNotFound: http.StatusNotFound,
+	apperror.CodeClientNotFound: http.StatusNotFound,
+	apperror.CodeNotReversible: http.StatusUnprocessableEntity,
+	apperror.CodeReversalExceedsOriginal: http.StatusUnprocessableEntity,
+	apperror.CodeReversalNotAllowed: http.StatusForbidden,
+	apperror.CodeCurrencyMismatch: http.StatusUnprocessableEntity,
+	apperror.CodeHoldNotPending: http.StatusConflict,
+	apperror.CodeHoldExpired: http.StatusConflict,
+	apperror.CodeWalletDisabled: http.StatusConflict,
+	apperror.CodeTargetDisabled: http.StatusConflict,
+	apperror.CodeWalletAlreadyEnabled: http.StatusConflict,
+	apperror.CodeWalletAlreadyDisabled: http.StatusConflict,
+	apperror.CodeWalletFrozen: http.StatusConflict,
+	apperror.CodeWalletAlreadyFrozen: http.StatusConflict,
+	apperror.CodeWalletClosed: http.StatusConflict,
+	apperror.CodeInvalidTransition: http.StatusConflict,
+	apperror.CodeClientRevoked: http.StatusConflict,
+	apperror.CodePendingWithdrawals: http.StatusConflict,
+	apperror.CodeBalanceNotZero: http.StatusUnprocessableEntity,
+	apperror.CodeDuplicateReference: http.StatusConflict,
+	apperror.CodeReferenceInProgress: http.StatusConflict,
+	apperror.CodeNoDrift: http.StatusConflict,
+	apperror.CodeInsufficientFunds: http.StatusUnprocessableEntity,
+	apperror.CodeSelfTransfer: http.StatusUnprocessableEntity,
+	apperror.CodeAmountBelowMinimum: http.StatusUnprocessableEntity,
+	apperror.CodeAmountAboveMaximum: http.StatusUnprocessableEntity,
+	apperror.CodeDailyLimitExceeded: http.StatusUnprocessableEntity,
+	apperror.CodeMonthlyLimitExceeded: http.StatusUnprocessableEntity,
+	apperror.CodeVelocityLimitExceeded: http.StatusTooManyRequests,
+}
+
+// FromError builds the failure envelope and HTTP status for err. Errors
+// outside the catalogue are logged and reported as INTERNAL_ERROR without
+// their message.
+func FromError(err error) (ResponseAPI, int) {
+	var appErr *apperror.Error
+	if !errors.As(err, &appErr) {
+		logrus.Errorf("Unexpected error: %v", err)
+		appErr = apperror.New(apperror.CodeInternal, "Internal server error")
+		err = appErr
+	}
+	statusCode, ok := statusCodes[appErr.Code]
+	if !ok {
+		statusCode = http.StatusInternalServerError
+	}
+	message := err.Error()
+	if statusCode >= http.StatusInternalServerError {
+		logrus.Errorf("Internal error: %v", err)
+		message = "Internal server error"
+	}
+	return ResponseAPI{
+		Status: "fail",
+		Error_: &ApiError{
+			Code: appErr.Code,
+			Message: message,
+			Fields: appErr.Fields,
+		},
+	}, statusCode
+}
+
+func Write(w http.ResponseWriter, data interface{}, statusCode int) {
+	w.Header().Set("Content-type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(data)
+}
+
+func WriteError(w http.ResponseWriter, err error) {
+	data, statusCode := FromError(err)
+	Write(w, data, statusCode)
 }
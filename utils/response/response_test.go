@@ -0,0 +1,87 @@
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
+)
+
+func TestFromError(t *testing.T) {
+	tests := []struct {
+		name string
+		err error
+		status int
+		code apperror.Code
+		message string
+	}{
+		{"validation", apperror.Invalid([]apperror.FieldError{{Field: "amount", Code: apperror.CodeMissingField}}), http.StatusBadRequest, apperror.CodeValidation, "Request validation failed"},
+		{"payload too large", apperror.New(apperror.CodePayloadTooLarge, "too large"), http.StatusRequestEntityTooLarge, apperror.CodePayloadTooLarge, "too large"},
+		{"invalid token", apperror.New(apperror.CodeInvalidToken, "Invalid Token"), http.StatusUnauthorized, apperror.CodeInvalidToken, "Invalid Token"},
+		{"out of scope", apperror.New(apperror.CodeCustomerNotInScope, "no"), http.StatusForbidden, apperror.CodeCustomerNotInScope, "no"},
+		{"reversal not allowed", apperror.New(apperror.CodeReversalNotAllowed, "no"), http.StatusForbidden, apperror.CodeReversalNotAllowed, "no"},
+		{"not found", apperror.New(apperror.CodeCustomerNotFound, "missing"), http.StatusNotFound, apperror.CodeCustomerNotFound, "missing"},
+		{"conflict", apperror.New(apperror.CodeWalletFrozen, "Wallet frozen"), http.StatusConflict, apperror.CodeWalletFrozen, "Wallet frozen"},
+		{"unprocessable", apperror.New(apperror.CodeInsufficientFunds, "poor"), http.StatusUnprocessableEntity, apperror.CodeInsufficientFunds, "poor"},
+		{"velocity", apperror.New(apperror.CodeVelocityLimitExceeded, "slow down"), http.StatusTooManyRequests, apperror.CodeVelocityLimitExceeded, "slow down"},
+		{"wrapped", fmt.Errorf("%w of 100.00 IDR", apperror.New(apperror.CodeAmountBelowMinimum, "Amount is below the minimum")), http.StatusUnprocessableEntity, apperror.CodeAmountBelowMinimum, "Amount is below the minimum of 100.00 IDR"},
+		{"outside the catalogue", errors.New("pq: connection refused"), http.StatusInternalServerError, apperror.CodeInternal, "Internal server error"},
+		{"code without a status", apperror.New(apperror.Code("SOMETHING_NEW"), "secret detail"), http.StatusInternalServerError, apperror.Code("SOMETHING_NEW"), "Internal server error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, status := FromError(tt.err)
+			if status != tt.status {
+				t.Errorf("status = %d, want %d", status, tt.status)
+			}
+			if data.Status != "fail" || data.Error_ == nil {
+				t.Fatalf("got %+v, want a failure envelope", data)
+			}
+			if data.Error_.Code != tt.code || data.Error_.Message != tt.message {
+				t.Errorf("error = %s %q, want %s %q", data.Error_.Code, data.Error_.Message, tt.code, tt.message)
+			}
+		})
+	}
+}
+
+func TestFromErrorKeepsFields(t *testing.T) {
+	fields := []apperror.FieldError{
+		{Field: "reference_id", Code: apperror.CodeInvalidUUID},
+		{Field: "amount", Code: apperror.CodeMissingField},
+	}
+	data, _ := FromError(apperror.Invalid(fields))
+	if len(data.Error_.Fields) != 2 || data.Error_.Fields[0].Field != "amount" {
+		t.Errorf("fields = %+v, want both sorted by name", data.Error_.Fields)
+	}
+}
+
+// TestStatusCodes makes sure only client errors are mapped; 5xx is reserved
+// for failures whose message is hidden.
+func TestStatusCodes(t *testing.T) {
+	for code, status := range statusCodes {
+		if status < 400 || status >= 500 {
+			t.Errorf("%s is sent as %d, want a 4xx status", code, status)
+		}
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteError(w, apperror.New(apperror.CodeHoldExpired, "Withdrawal hold has expired"))
+	if w.Code != http.StatusConflict {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusConflict)
+	}
+	if got := w.Header().Get("Content-type"); got != "application/json" {
+		t.Errorf("Content-type = %q", got)
+	}
+	var body ResponseAPI
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error_ == nil || body.Error_.Code != apperror.CodeHoldExpired {
+		t.Errorf("body = %s", w.Body)
+	}
+}
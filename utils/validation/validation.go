@@ -0,0 +1,282 @@
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"github.com/Sigaeasu/go-mwe/models/money"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
+)
+
+const (
+	MaxBodyBytes = 64 << 10
+	MaxFieldLength = 256
+)
+
+var (
+	ErrBodyTooLarge = apperror.New(apperror.CodePayloadTooLarge, "Request body is too large")
+	ErrMalformedBody = apperror.New(apperror.CodeBadRequest, "Request body is not a valid JSON object")
+)
+
+// Form holds the fields of a request, whatever encoding they were sent in.
+type Form map[string]string
+
+// ReadForm reads the query string and the request body. Bodies may be
+// application/x-www-form-urlencoded, multipart/form-data or a flat JSON object
+// whose values are strings, numbers or booleans.
+func ReadForm(w http.ResponseWriter, r *http.Request) (Form, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
+
+	form := Form{}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		for name, values := range r.URL.Query() {
+			form[name] = values[0]
+		}
+		if err := readJSON(r, form); err != nil {
+			return nil, err
+		}
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(MaxBodyBytes); err != nil {
+			return nil, bodyError(err)
+		}
+		fallthrough
+	default:
+		if err := r.ParseForm(); err != nil {
+			return nil, bodyError(err)
+		}
+		for name, values := range r.Form {
+			form[name] = values[0]
+		}
+	}
+
+	var fields []apperror.FieldError
+	for name, value := range form {
+		value = strings.TrimSpace(value)
+		form[name] = value
+		if len(value) > MaxFieldLength {
+			fields = append(fields, apperror.FieldError{
+				Field: name,
+				Code: apperror.CodeFieldTooLong,
+				Message: fmt.Sprintf("Must be at most %d characters", MaxFieldLength),
+			})
+		}
+	}
+	if fields != nil {
+		return nil, apperror.Invalid(fields)
+	}
+	return form, nil
+}
+
+func readJSON(r *http.Request, form Form) error {
+	var body map[string]interface{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		return bodyError(err)
+	}
+
+	var fields []apperror.FieldError
+	for name, value := range body {
+		switch v := value.(type) {
+		case nil:
+		case string:
+			form[name] = v
+		case json.Number:
+			form[name] = v.String()
+		case bool:
+			form[name] = strconv.FormatBool(v)
+		default:
+			fields = append(fields, apperror.FieldError{
+				Field: name,
+				Code: apperror.CodeBadRequest,
+				Message: "Must be a string, number or boolean",
+			})
+		}
+	}
+	if fields != nil {
+		return apperror.Invalid(fields)
+	}
+	return nil
+}
+
+func bodyError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return ErrBodyTooLarge
+	}
+	return fmt.Errorf("%w: %v", ErrMalformedBody, err)
+}
+
+// Validator collects field errors so a client learns about every invalid
+// field at once. Its methods return the zero value for rejected fields.
+type Validator struct {
+	fields []apperror.FieldError
+}
+
+// Reject records an error for the field, using the code of err when it is
+// part of the catalogue.
+func (v *Validator) Reject(field string, err error) {
+	code := apperror.CodeBadRequest
+	var appErr *apperror.Error
+	if errors.As(err, &appErr) {
+		code = appErr.Code
+	}
+	v.fields = append(v.fields, apperror.FieldError{
+		Field: field,
+		Code: code,
+		Message: err.Error(),
+	})
+}
+
+func (v *Validator) Required(form Form, field string) string {
+	value := form[field]
+	if value == "" {
+		v.Reject(field, apperror.New(apperror.CodeMissingField, "Missing data for required field."))
+	}
+	return value
+}
+
+// UUID returns the field if it is a UUID. Empty optional fields are accepted.
+func (v *Validator) UUID(form Form, field string, required bool) string {
+	value := form[field]
+	if value == "" {
+		if required {
+			v.Required(form, field)
+		}
+		return ""
+	}
+	if !IsUUID(value) {
+		v.Reject(field, apperror.New(apperror.CodeInvalidUUID, "Must be a UUID"))
+		return ""
+	}
+	return strings.ToLower(value)
+}
+
+// URL returns the field if it is an absolute http or https URL.
+func (v *Validator) URL(form Form, field string) string {
+	value := v.Required(form, field)
+	if value == "" {
+		return ""
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.Reject(field, apperror.New(apperror.CodeBadRequest, "Must be an http or https URL"))
+		return ""
+	}
+	return value
+}
+
+// OneOf splits the comma separated field and returns its values if each is
+// one of allowed.
+func (v *Validator) OneOf(form Form, field string, allowed []string) []string {
+	value := v.Required(form, field)
+	if value == "" {
+		return nil
+	}
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		known := false
+		for _, a := range allowed {
+			known = known || item == a
+		}
+		if !known {
+			v.Reject(field, apperror.New(apperror.CodeBadRequest, fmt.Sprintf("Unknown value %q, expected one of %s", item, strings.Join(allowed, ", "))))
+			return nil
+		}
+		values = append(values, item)
+	}
+	return values
+}
+
+// Bool returns the field as a boolean, or def when it is absent.
+func (v *Validator) Bool(form Form, field string, def bool) bool {
+	value := form[field]
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		v.Reject(field, apperror.New(apperror.CodeBadRequest, "Must be true or false"))
+		return def
+	}
+	return b
+}
+
+// Currency returns the ISO-4217 code in the field, or the default currency
+// when it is absent.
+func (v *Validator) Currency(form Form, field string) string {
+	currency := strings.ToUpper(form[field])
+	if currency == "" {
+		return money.DefaultCurrency
+	}
+	if _, err := money.Exponent(currency); err != nil {
+		v.Reject(field, err)
+		return ""
+	}
+	return currency
+}
+
+// Amount returns the field as a positive amount of the currency. Nothing is
+// checked when the currency itself was rejected.
+func (v *Validator) Amount(form Form, field string, currency string) money.Amount {
+	value := v.Required(form, field)
+	if value == "" || currency == "" {
+		return 0
+	}
+	amount, err := money.Parse(value, currency)
+	if err != nil {
+		v.Reject(field, err)
+		return 0
+	}
+	if amount <= 0 {
+		v.Reject(field, apperror.New(apperror.CodeInvalidAmount, "Amount must be greater than zero"))
+		return 0
+	}
+	return amount
+}
+
+// SignedAmount is Amount for a field that may start with a minus sign.
+func (v *Validator) SignedAmount(form Form, field string, currency string) money.Amount {
+	value, negative := strings.CutPrefix(form[field], "-")
+	amount := v.Amount(Form{field: value}, field, currency)
+	if negative {
+		return -amount
+	}
+	return amount
+}
+
+// Err returns the collected field errors, or nil if there were none.
+func (v *Validator) Err() error {
+	if v.fields == nil {
+		return nil
+	}
+	return apperror.Invalid(v.fields)
+}
+
+// IsUUID reports whether s is a UUID in its 36 character form.
+func IsUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i, c := range s {
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,148 @@
+package validation
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"github.com/Sigaeasu/go-mwe/models/money"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
+)
+
+// fieldCodes returns the code of every rejected field of err.
+func fieldCodes(err error) map[string]apperror.Code {
+	var appErr *apperror.Error
+	if !errors.As(err, &appErr) {
+		return nil
+	}
+	codes := map[string]apperror.Code{}
+	for _, f := range appErr.Fields {
+		codes[f.Field] = f.Code
+	}
+	return codes
+}
+
+func TestReadForm(t *testing.T) {
+	long := strings.Repeat("a", MaxFieldLength)
+	tests := []struct {
+		name string
+		contentType string
+		body string
+		want Form
+		err error
+		fields map[string]apperror.Code
+	}{
+		{"form", "application/x-www-form-urlencoded", "amount=10000&reference_id=+abc+", Form{"amount": "10000", "reference_id": "abc"}, nil, nil},
+		{"json", "application/json", `{"amount": 10000.5, "capture": false, "currency": "IDR", "note": null}`, Form{"amount": "10000.5", "capture": "false", "currency": "IDR"}, nil, nil},
+		{"json with charset", "application/json; charset=utf-8", `{"amount": "1"}`, Form{"amount": "1"}, nil, nil},
+		{"longest field", "application/x-www-form-urlencoded", "note=" + long, Form{"note": long}, nil, nil},
+		{"padded longest field", "application/json", `{"note": "  ` + long + `  "}`, Form{"note": long}, nil, nil},
+		{"field too long", "application/x-www-form-urlencoded", "note=" + long + "a", nil, apperror.New(apperror.CodeValidation, ""), map[string]apperror.Code{"note": apperror.CodeFieldTooLong}},
+		{"nested json", "application/json", `{"amount": {"value": 1}}`, nil, apperror.New(apperror.CodeValidation, ""), map[string]apperror.Code{"amount": apperror.CodeBadRequest}},
+		{"malformed json", "application/json", `{"amount": `, nil, ErrMalformedBody, nil},
+		{"json array", "application/json", `[1]`, nil, ErrMalformedBody, nil},
+		{"body too large", "application/json", `{"note": "` + strings.Repeat("a", MaxBodyBytes) + `"}`, nil, ErrBodyTooLarge, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", tt.contentType)
+			form, err := ReadForm(httptest.NewRecorder(), r)
+			if tt.err == nil {
+				if err != nil {
+					t.Fatalf("unexpected error %v", err)
+				}
+				if len(form) != len(tt.want) {
+					t.Fatalf("got %v, want %v", form, tt.want)
+				}
+				for name, value := range tt.want {
+					if form[name] != value {
+						t.Errorf("%s = %q, want %q", name, form[name], value)
+					}
+				}
+				return
+			}
+			if apperror.CodeOf(err) != apperror.CodeOf(tt.err) {
+				t.Fatalf("got %v, want code %s", err, apperror.CodeOf(tt.err))
+			}
+			for name, code := range tt.fields {
+				if got := fieldCodes(err)[name]; got != code {
+					t.Errorf("field %s rejected with %q, want %q", name, got, code)
+				}
+			}
+		})
+	}
+}
+
+func TestValidator(t *testing.T) {
+	const uuid = "3F5C2E2A-7D1B-4C8E-9A6F-1B2C3D4E5F60"
+	tests := []struct {
+		name string
+		run func(v *Validator) interface{}
+		want interface{}
+		code apperror.Code
+	}{
+		{"uuid", func(v *Validator) interface{} { return v.UUID(Form{"id": uuid}, "id", true) }, strings.ToLower(uuid), ""},
+		{"missing optional uuid", func(v *Validator) interface{} { return v.UUID(Form{}, "id", false) }, "", ""},
+		{"missing required uuid", func(v *Validator) interface{} { return v.UUID(Form{}, "id", true) }, "", apperror.CodeMissingField},
+		{"not a uuid", func(v *Validator) interface{} { return v.UUID(Form{"id": "cust-1"}, "id", true) }, "", apperror.CodeInvalidUUID},
+		{"default currency", func(v *Validator) interface{} { return v.Currency(Form{}, "currency") }, money.DefaultCurrency, ""},
+		{"lower case currency", func(v *Validator) interface{} { return v.Currency(Form{"currency": "usd"}, "currency") }, "USD", ""},
+		{"unknown currency", func(v *Validator) interface{} { return v.Currency(Form{"currency": "EUR"}, "currency") }, "", apperror.CodeUnsupportedCurrency},
+		{"amount", func(v *Validator) interface{} { return v.Amount(Form{"amount": "10.5"}, "amount", "IDR") }, money.Amount(1050), ""},
+		{"zero amount", func(v *Validator) interface{} { return v.Amount(Form{"amount": "0"}, "amount", "IDR") }, money.Amount(0), apperror.CodeInvalidAmount},
+		{"negative amount", func(v *Validator) interface{} { return v.Amount(Form{"amount": "-1"}, "amount", "IDR") }, money.Amount(0), apperror.CodeInvalidAmount},
+		{"missing amount", func(v *Validator) interface{} { return v.Amount(Form{}, "amount", "IDR") }, money.Amount(0), apperror.CodeMissingField},
+		{"amount of a rejected currency", func(v *Validator) interface{} { return v.Amount(Form{"amount": "x"}, "amount", "") }, money.Amount(0), ""},
+		{"signed amount", func(v *Validator) interface{} { return v.SignedAmount(Form{"amount": "-2.5"}, "amount", "IDR") }, money.Amount(-250), ""},
+		{"bool", func(v *Validator) interface{} { return v.Bool(Form{"capture": "false"}, "capture", true) }, false, ""},
+		{"default bool", func(v *Validator) interface{} { return v.Bool(Form{}, "capture", true) }, true, ""},
+		{"not a bool", func(v *Validator) interface{} { return v.Bool(Form{"capture": "maybe"}, "capture", true) }, true, apperror.CodeBadRequest},
+		{"url", func(v *Validator) interface{} { return v.URL(Form{"url": "https://example.com/hook"}, "url") }, "https://example.com/hook", ""},
+		{"relative url", func(v *Validator) interface{} { return v.URL(Form{"url": "/hook"}, "url") }, "", apperror.CodeBadRequest},
+		{"ftp url", func(v *Validator) interface{} { return v.URL(Form{"url": "ftp://example.com"}, "url") }, "", apperror.CodeBadRequest},
+		{"one of", func(v *Validator) interface{} { return strings.Join(v.OneOf(Form{"events": "a, b"}, "events", []string{"a", "b"}), "|") }, "a|b", ""},
+		{"not one of", func(v *Validator) interface{} { return strings.Join(v.OneOf(Form{"events": "a,c"}, "events", []string{"a", "b"}), "|") }, "", apperror.CodeBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v Validator
+			if got := tt.run(&v); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			err := v.Err()
+			if tt.code == "" {
+				if err != nil {
+					t.Errorf("unexpected error %v", err)
+				}
+				return
+			}
+			if len(fieldCodes(err)) != 1 {
+				t.Fatalf("got %v, want one rejected field", err)
+			}
+			for _, code := range fieldCodes(err) {
+				if code != tt.code {
+					t.Errorf("rejected with %q, want %q", code, tt.code)
+				}
+			}
+		})
+	}
+}
+
+func TestIsUUID(t *testing.T) {
+	tests := map[string]bool{
+		"3f5c2e2a-7d1b-4c8e-9a6f-1b2c3d4e5f60": true,
+		"3F5C2E2A-7D1B-4C8E-9A6F-1B2C3D4E5F60": true,
+		"3f5c2e2a7d1b4c8e9a6f1b2c3d4e5f60": false,
+		"3f5c2e2a-7d1b-4c8e-9a6f-1b2c3d4e5f6": false,
+		"3f5c2e2a-7d1b-4c8e-9a6f-1b2c3d4e5f6g": false,
+		"3f5c2e2a_7d1b-4c8e-9a6f-1b2c3d4e5f60": false,
+		"": false,
+	}
+	for s, want := range tests {
+		if got := IsUUID(s); got != want {
+			t.Errorf("IsUUID(%q) = %v, want %v", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"syscall"
+	"time"
+	"github.com/Sigaeasu/go-mwe/config"
+	"github.com/Sigaeasu/go-mwe/utils/apperror"
+	"github.com/sirupsen/logrus"
+)
+
+const resolveTimeout = 5 * time.Second
+
+var (
+	ErrAddressNotAllowed = apperror.New(apperror.CodeURLNotAllowed, "Webhook URL must point to a public address")
+	ErrUnresolvableHost = apperror.New(apperror.CodeURLNotAllowed, "Webhook URL host does not resolve")
+)
+
+// reservedNetworks are the special purpose ranges that the net.IP predicates
+// in publicIP do not cover.
+var reservedNetworks = parseNetworks([]string{
+	"0.0.0.0/8",
+	"100.64.0.0/10",
+	"192.0.0.0/24",
+	"198.18.0.0/15",
+	"240.0.0.0/4",
+	"64:ff9b::/96",
+})
+
+// CheckURL resolves the host of a webhook URL and fails unless every address
+// it resolves to may receive deliveries. The dispatcher checks again when it
+// connects, since DNS answers can change after the subscription is made.
+func CheckURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return ErrUnresolvableHost
+	}
+	allowed := AllowedNetworks()
+	for _, addr := range addrs {
+		if !allowedIP(addr.IP, allowed) {
+			return ErrAddressNotAllowed
+		}
+	}
+	return nil
+}
+
+// AllowedNetworks are the webhooks.allowed_networks of the config: ranges
+// that may receive deliveries although they are not public, e.g. 127.0.0.0/8
+// for a receiver in a test. Invalid entries are logged and skipped.
+func AllowedNetworks() []*net.IPNet {
+	return parseNetworks(config.Config.WebhooksCfg.AllowedNetworks)
+}
+
+// allowedIP reports whether deliveries may be sent to ip: a public unicast
+// address, or one in allowed.
+func allowedIP(ip net.IP, allowed []*net.IPNet) bool {
+	for _, network := range allowed {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return publicIP(ip)
+}
+
+// publicIP is false for loopback, private (RFC 1918 and fc00::/7),
+// link-local including the 169.254.169.254 metadata service, multicast,
+// unspecified and other reserved addresses.
+func publicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// dialControl refuses connections to addresses allowedIP rejects. It runs
+// for every connection the client opens, including those of redirects, after
+// the host is resolved.
+func dialControl(allowed []*net.IPNet) func(network string, address string, c syscall.RawConn) error {
+	return func(network string, address string, c syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		ip := net.ParseIP(host)
+		if ip == nil || !allowedIP(ip, allowed) {
+			return fmt.Errorf("%w, %s is not", ErrAddressNotAllowed, host)
+		}
+		return nil
+	}
+}
+
+func parseNetworks(cidrs []string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			logrus.Errorf("Ignoring network %q: %v", cidr, err)
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
@@ -0,0 +1,181 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+	"github.com/Sigaeasu/go-mwe/config"
+	"github.com/Sigaeasu/go-mwe/models"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+	"github.com/Sigaeasu/go-mwe/repository"
+	"github.com/sirupsen/logrus"
+)
+
+// Headers sent with every delivery. The signature is the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the subscription secret, so receivers can
+// reject both forged and replayed requests.
+const (
+	HeaderEvent = "X-Webhook-Event"
+	HeaderDelivery = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+const (
+	DefaultMaxAttempts = 8
+	DefaultBaseDelay = 30 * time.Second
+	DefaultMaxDelay = time.Hour
+	DefaultTimeout = 10 * time.Second
+	DefaultPollInterval = 5 * time.Second
+	BatchSize = 50
+)
+
+// Dispatcher sends the outbox. A failed attempt is retried after
+// BaseDelay * 2^(attempts-1), capped at MaxDelay, until MaxAttempts.
+type Dispatcher struct {
+	repo repository.MiniWalletRepoInterface
+	client *http.Client
+	MaxAttempts int
+	BaseDelay time.Duration
+	MaxDelay time.Duration
+	PollInterval time.Duration
+}
+
+// NewDispatcher reads the webhooks section of the application config. Its
+// client only connects to addresses CheckURL would accept.
+func NewDispatcher(repo repository.MiniWalletRepoInterface) *Dispatcher {
+	cfg := config.Config.WebhooksCfg
+	timeout := orDefault(cfg.Timeout, DefaultTimeout)
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: dialControl(AllowedNetworks()),
+	}
+	d := &Dispatcher{
+		repo: repo,
+		// No proxy: the dialer must see the receiver's address.
+		client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				DialContext: dialer.DialContext,
+				TLSHandshakeTimeout: timeout,
+				MaxIdleConnsPerHost: 2,
+			},
+		},
+		MaxAttempts: cfg.MaxAttempts,
+		BaseDelay: orDefault(cfg.BaseDelay, DefaultBaseDelay),
+		MaxDelay: orDefault(cfg.MaxDelay, DefaultMaxDelay),
+		PollInterval: orDefault(cfg.PollInterval, DefaultPollInterval),
+	}
+	if d.MaxAttempts <= 0 {
+		d.MaxAttempts = DefaultMaxAttempts
+	}
+	return d
+}
+
+// Run sends due deliveries every PollInterval, forever.
+func (d *Dispatcher) Run() {
+	for range time.Tick(d.PollInterval) {
+		if _, err := d.DeliverDue(time.Now()); err != nil {
+			logrus.Errorf("Fail to dispatch webhooks: %v", err)
+		}
+	}
+}
+
+// DeliverDue claims the deliveries due at now, sends them and stores the
+// outcome of each. It returns how many were attempted.
+func (d *Dispatcher) DeliverDue(now time.Time) (int, error) {
+	// The lease outlives a request that times out, so no other dispatcher
+	// picks the delivery up while it is in flight.
+	due, err := d.repo.ClaimWebhookDeliveries(now, now.Add(2*d.client.Timeout), BatchSize)
+	if err != nil {
+		return 0, err
+	}
+	for _, delivery := range due {
+		result := d.attempt(delivery, time.Now())
+		if err := d.repo.SaveWebhookDelivery(result); err != nil {
+			logrus.Errorf("Fail to save webhook delivery %s: %v", result.ID, err)
+		}
+	}
+	return len(due), nil
+}
+
+func (d *Dispatcher) attempt(due models.DueDelivery, now time.Time) entity.WebhookDelivery {
+	delivery := due.Delivery
+	delivery.Attempts++
+	delivery.LastStatusCode = 0
+	delivery.LastError = ""
+
+	statusCode, err := d.send(due, now)
+	delivery.LastStatusCode = statusCode
+	if err == nil {
+		delivery.Status = entity.WebhookStatusDelivered
+		delivery.DeliveredAt = now
+		return delivery
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= d.MaxAttempts {
+		delivery.Status = entity.WebhookStatusFailed
+		return delivery
+	}
+	delivery.NextAttemptAt = now.Add(d.backoff(delivery.Attempts))
+	return delivery
+}
+
+func (d *Dispatcher) send(due models.DueDelivery, now time.Time) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, due.URL, bytes.NewReader(due.Delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, due.Delivery.EventType)
+	req.Header.Set(HeaderDelivery, due.Delivery.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, "sha256="+Sign(due.Secret, timestamp, due.Delivery.Payload))
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("Receiver answered %s", res.Status)
+	}
+	return res.StatusCode, nil
+}
+
+func (d *Dispatcher) backoff(attempts int) time.Duration {
+	delay := d.BaseDelay
+	for i := 1; i < attempts && delay < d.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > d.MaxDelay {
+		delay = d.MaxDelay
+	}
+	return delay
+}
+
+// Sign returns the hex HMAC-SHA256 of "<timestamp>.<body>" keyed with secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func orDefault(value time.Duration, def time.Duration) time.Duration {
+	if value > 0 {
+		return value
+	}
+	return def
+}
@@ -0,0 +1,203 @@
+package webhook
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"github.com/Sigaeasu/go-mwe/config"
+	"github.com/Sigaeasu/go-mwe/models"
+	"github.com/Sigaeasu/go-mwe/models/entity"
+)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		secret string
+		timestamp int64
+		body string
+		want string
+	}{
+		{"secret", 1700000000, `{"a":1}`, "49f24e537407743fa4a0242bb63b94b9a47ee99cbbe071ccd8a22550ae411686"},
+		{"", 0, "", "b849d5a581847b281957065739df36df2463d1977ea8d6e1e4e6cf33fadc68c3"},
+	}
+	for _, tt := range tests {
+		if got := Sign(tt.secret, tt.timestamp, []byte(tt.body)); got != tt.want {
+			t.Errorf("Sign(%q, %d, %q) = %s, want %s", tt.secret, tt.timestamp, tt.body, got, tt.want)
+		}
+	}
+	// Moving the separator must change the signature.
+	if Sign("secret", 17, []byte("00.x")) == Sign("secret", 170, []byte("0.x")) {
+		t.Error("signature does not bind the timestamp")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := &Dispatcher{BaseDelay: 30 * time.Second, MaxDelay: 5 * time.Minute}
+	want := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for i, w := range want {
+		if got := d.backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %v, want %v", i+1, got, w)
+		}
+	}
+}
+
+func TestAllowedIP(t *testing.T) {
+	_, loopback, _ := net.ParseCIDR("127.0.0.0/8")
+	tests := []struct {
+		ip string
+		allowed bool
+		withLoopback bool
+	}{
+		{"93.184.215.14", true, true},
+		{"2606:2800:21f:cb07:6820:80da:af6b:8b2c", true, true},
+		{"127.0.0.1", false, true},
+		{"::1", false, false},
+		{"::ffff:127.0.0.1", false, true},
+		{"10.1.2.3", false, false},
+		{"172.16.0.1", false, false},
+		{"192.168.1.1", false, false},
+		{"fd00::1", false, false},
+		{"169.254.169.254", false, false},
+		{"::ffff:169.254.169.254", false, false},
+		{"fe80::1", false, false},
+		{"0.0.0.0", false, false},
+		{"::", false, false},
+		{"100.64.0.1", false, false},
+		{"224.0.0.1", false, false},
+		{"255.255.255.255", false, false},
+	}
+	for _, tt := range tests {
+		ip := net.ParseIP(tt.ip)
+		if got := allowedIP(ip, nil); got != tt.allowed {
+			t.Errorf("allowedIP(%s) = %v, want %v", tt.ip, got, tt.allowed)
+		}
+		if got := allowedIP(ip, []*net.IPNet{loopback}); got != tt.withLoopback {
+			t.Errorf("allowedIP(%s) with 127.0.0.0/8 allowed = %v, want %v", tt.ip, got, tt.withLoopback)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	saved := config.Config.WebhooksCfg.AllowedNetworks
+	defer func() { config.Config.WebhooksCfg.AllowedNetworks = saved }()
+
+	config.Config.WebhooksCfg.AllowedNetworks = nil
+	for _, u := range []string{"http://127.0.0.1:9000/hook", "http://localhost/hook", "http://169.254.169.254/latest/meta-data", "http://[::1]/", "http://10.0.0.1/"} {
+		if err := CheckURL(u); !errors.Is(err, ErrAddressNotAllowed) {
+			t.Errorf("CheckURL(%s) = %v, want %v", u, err, ErrAddressNotAllowed)
+		}
+	}
+	if err := CheckURL("http://no-such-host.invalid/"); !errors.Is(err, ErrUnresolvableHost) {
+		t.Errorf("unresolvable host: got %v, want %v", err, ErrUnresolvableHost)
+	}
+	if err := CheckURL("https://93.184.215.14/hook"); err != nil {
+		t.Errorf("public address refused: %v", err)
+	}
+
+	config.Config.WebhooksCfg.AllowedNetworks = []string{"127.0.0.0/8", "not a network"}
+	if err := CheckURL("http://127.0.0.1:9000/hook"); err != nil {
+		t.Errorf("allowed network refused: %v", err)
+	}
+}
+
+// TestSend delivers to a local receiver, which the dial check refuses unless
+// loopback is in webhooks.allowed_networks.
+func TestSend(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer receiver.Close()
+
+	saved := config.Config.WebhooksCfg
+	defer func() { config.Config.WebhooksCfg = saved }()
+	due := models.DueDelivery{
+		Delivery: entity.WebhookDelivery{ID: "delivery-1", EventType: entity.EventDepositSucceeded, Payload: []byte(`{"id":"1"}`)},
+		URL: receiver.URL + "/hook",
+		Secret: "secret",
+	}
+	now := time.Unix(1700000000, 0)
+
+	config.Config.WebhooksCfg.AllowedNetworks = nil
+	if _, err := NewDispatcher(nil).send(due, now); !errors.Is(err, ErrAddressNotAllowed) {
+		t.Fatalf("delivery to loopback: got %v, want %v", err, ErrAddressNotAllowed)
+	}
+	if got != nil {
+		t.Fatal("receiver was reached")
+	}
+
+	config.Config.WebhooksCfg.AllowedNetworks = []string{"127.0.0.0/8", "::1/128"}
+	d := NewDispatcher(nil)
+	status, err := d.send(due, now)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("delivery: got %d %v", status, err)
+	}
+	if string(body) != `{"id":"1"}` {
+		t.Errorf("body = %s", body)
+	}
+	headers := map[string]string{
+		"Content-Type": "application/json",
+		HeaderEvent: entity.EventDepositSucceeded,
+		HeaderDelivery: "delivery-1",
+		HeaderTimestamp: strconv.FormatInt(now.Unix(), 10),
+		HeaderSignature: "sha256=" + Sign("secret", now.Unix(), due.Delivery.Payload),
+	}
+	for name, want := range headers {
+		if got.Header.Get(name) != want {
+			t.Errorf("%s = %q, want %q", name, got.Header.Get(name), want)
+		}
+	}
+
+	due.URL = receiver.URL + "/broken"
+	if status, err := d.send(due, now); err == nil || status != http.StatusBadGateway {
+		t.Errorf("failed delivery: got %d %v", status, err)
+	}
+}
+
+func TestAttempt(t *testing.T) {
+	d := &Dispatcher{
+		client: &http.Client{Transport: roundTripper(func(*http.Request) (*http.Response, error) {
+			return nil, errors.New("connection refused")
+		})},
+		MaxAttempts: 3,
+		BaseDelay: time.Minute,
+		MaxDelay: time.Hour,
+	}
+	now := time.Unix(1700000000, 0)
+	due := models.DueDelivery{URL: "https://93.184.215.14/hook", Delivery: entity.WebhookDelivery{Attempts: 1, LastStatusCode: 500}}
+
+	retried := d.attempt(due, now)
+	if retried.Attempts != 2 || retried.Status == entity.WebhookStatusFailed || !retried.NextAttemptAt.Equal(now.Add(2*time.Minute)) {
+		t.Errorf("second attempt = %+v, want a retry in 2m", retried)
+	}
+	if retried.LastStatusCode != 0 || retried.LastError == "" {
+		t.Errorf("second attempt kept %d %q", retried.LastStatusCode, retried.LastError)
+	}
+
+	due.Delivery = retried
+	if failed := d.attempt(due, now); failed.Status != entity.WebhookStatusFailed {
+		t.Errorf("last attempt status = %q, want %q", failed.Status, entity.WebhookStatusFailed)
+	}
+
+	d.client.Transport = roundTripper(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: http.StatusNoContent, Status: "204 No Content", Body: http.NoBody, Request: r}, nil
+	})
+	if delivered := d.attempt(due, now); delivered.Status != entity.WebhookStatusDelivered || !delivered.DeliveredAt.Equal(now) {
+		t.Errorf("delivered = %+v", delivered)
+	}
+}
+
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}